@@ -0,0 +1,33 @@
+// Package dbtest holds the helpers shared by its subpackages, `postgres` and
+// `sqlite`, which open databases for the tests generated by dbcrudgen
+package dbtest
+
+import (
+	sql "database/sql"
+	"os"
+	"strings"
+	"testing"
+)
+
+// ApplySchema runs the statements in the file at `schemaPath` against `db`,
+// where an empty file leaves the DB empty
+func ApplySchema(
+	t *testing.T,
+	db *sql.DB,
+	schemaPath string,
+) {
+
+	schema, err := os.ReadFile(schemaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.TrimSpace(string(schema)) == "" {
+		return
+	}
+
+	_, err = db.Exec(string(schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
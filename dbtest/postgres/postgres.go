@@ -0,0 +1,143 @@
+// Package postgres opens postgres databases, on an embedded postgres server,
+// for the tests generated by dbcrudgen with the postgres dialect
+package postgres
+
+import (
+	sql "database/sql"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	_ "github.com/lib/pq"
+	"github.com/thecodedproject/dbcrudgen/dbtest"
+)
+
+// Env is the environment variable which must be set (to any non empty value)
+// for `Run` to start a postgres server; when it is not set the tests which use
+// `Open` are skipped, as starting the server downloads postgres
+const Env = "DBTEST_POSTGRES"
+
+var (
+	serverPort uint32
+	dbCounter atomic.Int64
+)
+
+// Run starts an embedded postgres server, runs the tests in `m` against it
+// and stops the server once they are complete.
+//
+// It should be called from `TestMain` in any test package which uses `Open`,
+// returning the exit code to pass to `os.Exit`. Unless `Env` is set it runs
+// the tests without starting a server.
+func Run(m *testing.M) int {
+
+	if os.Getenv(Env) == "" {
+		return m.Run()
+	}
+
+	port, err := freePort()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	runtimePath, err := os.MkdirTemp("", "dbtest_postgres")
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	defer os.RemoveAll(runtimePath)
+
+	pg := embeddedpostgres.NewDatabase(
+		embeddedpostgres.DefaultConfig().
+			Port(port).
+			RuntimePath(runtimePath).
+			Logger(nil),
+	)
+
+	err = pg.Start()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	serverPort = port
+	code := m.Run()
+
+	err = pg.Stop()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return code
+}
+
+// Open creates a new database on the server started by `Run`, applies the
+// schema at `schemaPath` to it and returns a connection to it.
+//
+// The database is dropped when the test completes, and the test is skipped
+// unless `Env` is set.
+func Open(
+	t *testing.T,
+	schemaPath string,
+) *sql.DB {
+
+	if os.Getenv(Env) == "" {
+		t.Skip("dbtest: " + Env + " not set - skipping postgres test")
+	}
+
+	if serverPort == 0 {
+		t.Fatal("dbtest: postgres server not running - call postgres.Run from TestMain")
+	}
+
+	admin, err := sql.Open("postgres", postgresDSN("postgres"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.Close()
+	})
+
+	dbName := fmt.Sprintf("test_%d", dbCounter.Add(1))
+	_, err = admin.Exec("create database " + dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, err := admin.Exec("drop database " + dbName)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	db, err := sql.Open("postgres", postgresDSN(dbName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	dbtest.ApplySchema(t, db, schemaPath)
+
+	return db
+}
+
+func postgresDSN(dbName string) string {
+	return fmt.Sprintf(
+		"host=localhost port=%d user=postgres password=postgres dbname=%s sslmode=disable",
+		serverPort,
+		dbName,
+	)
+}
+
+func freePort() (uint32, error) {
+
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+
+	return uint32(l.Addr().(*net.TCPAddr).Port), nil
+}
@@ -0,0 +1,34 @@
+// Package sqlite opens sqlite databases for the tests generated by dbcrudgen
+// with the sqlite dialect
+package sqlite
+
+import (
+	sql "database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/thecodedproject/dbcrudgen/dbtest"
+)
+
+// Open creates a new sqlite database in a temporary directory, applies
+// the schema at `schemaPath` to it and returns a connection to it.
+//
+// The database is removed when the test completes.
+func Open(
+	t *testing.T,
+	schemaPath string,
+) *sql.DB {
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	dbtest.ApplySchema(t, db, schemaPath)
+
+	return db
+}
@@ -0,0 +1,3 @@
+package column_options
+
+//go:generate go run ../../main.go
@@ -0,0 +1,3 @@
+package column_options_postgres
+
+//go:generate go run ../../main.go --dialect=postgres
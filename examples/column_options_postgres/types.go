@@ -0,0 +1,22 @@
+package column_options_postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/thecodedproject/dbcrudgen/dbcrudgen"
+)
+
+// Contact sets the options of its columns in its field tags
+type Contact struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	InsertedAt time.Time
+	Email string `dbcrudgen:"type=varchar(128),name=email_addr,unique"`
+	DisplayName string `dbcrudgen:"name=display,size=64,default='anon'"`
+	Nickname *string `dbcrudgen:"name=nick"`
+	Score int64 `dbcrudgen:"default=0"`
+	Note *string `dbcrudgen:"varchar(64),notnull,default='a,b'"`
+	Subscribed sql.NullBool `dbcrudgen:"name=is_subscribed,notnull"`
+}
@@ -0,0 +1,3 @@
+package column_options_sqlite
+
+//go:generate go run ../../main.go --dialect=sqlite
@@ -0,0 +1,3 @@
+package foreign_keys
+
+//go:generate go run ../../main.go
@@ -0,0 +1,3 @@
+package foreign_keys_sqlite
+
+//go:generate go run ../../main.go --dialect=sqlite
@@ -0,0 +1,39 @@
+package foreign_keys_sqlite
+
+import (
+	"time"
+
+	"github.com/thecodedproject/dbcrudgen/dbcrudgen"
+)
+
+type Author struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	InsertedAt time.Time
+	Name string
+}
+
+// Book references its author, which deletes the book when deleted, an
+// optional editor, which is unset when deleted, and optionally the book it
+// is a sequel of
+type Book struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	InsertedAt time.Time
+	Title string
+	AuthorID int64 `dbcrudgen:"references=Author,on_delete=cascade"`
+	EditorID *int64 `dbcrudgen:"references=Author,on_delete=set_null"`
+	SequelOfID *int64 `dbcrudgen:"references=Book,on_delete=set_null"`
+}
+
+// Review references a book, and so depends on the authors of books as well
+type Review struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	InsertedAt time.Time
+	BookID int64 `dbcrudgen:"references=Book"`
+	Rating int64
+}
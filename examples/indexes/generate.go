@@ -0,0 +1,3 @@
+package indexes
+
+//go:generate go run ../../main.go
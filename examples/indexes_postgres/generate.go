@@ -0,0 +1,3 @@
+package indexes_postgres
+
+//go:generate go run ../../main.go --dialect=postgres
@@ -0,0 +1,20 @@
+package indexes_sqlite
+
+import (
+	"time"
+
+	"github.com/thecodedproject/dbcrudgen/dbcrudgen"
+)
+
+// Event has an index on a single column, a composite index named
+// `source_time` and a unique key
+type Event struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	InsertedAt time.Time
+	Kind string `dbcrudgen:"varchar(32),index"`
+	Source string `dbcrudgen:"varchar(64),index=source_time"`
+	HappenedAt time.Time `dbcrudgen:"index=source_time"`
+	ExternalRef string `dbcrudgen:"varchar(64),unique"`
+}
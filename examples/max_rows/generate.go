@@ -0,0 +1,3 @@
+package max_rows
+
+//go:generate go run ../../main.go --dialect=sqlite --max_rows=10
@@ -0,0 +1,30 @@
+package max_rows
+
+import (
+	"github.com/thecodedproject/dbcrudgen/dbcrudgen"
+)
+
+// DefaultMaxRows uses the max rows set by the `--max_rows` flag
+type DefaultMaxRows struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	Name string
+	Count int64
+}
+
+type TaggedMaxRows struct {
+	dbcrudgen.DataModel `dbcrudgen:"max_rows=20"`
+
+	ID int64
+	Name string
+	Count int64
+}
+
+type UnlimitedMaxRows struct {
+	dbcrudgen.DataModel `dbcrudgen:"max_rows=unlimited"`
+
+	ID int64
+	Name string
+	Count int64
+}
@@ -0,0 +1,3 @@
+package migrations
+
+//go:generate go run ../../main.go --migrations_dir=migrations
@@ -0,0 +1,20 @@
+create table customer (
+  id bigint primary key auto_increment,
+  inserted_at datetime not null,
+  name varchar(64) not null,
+  nickname varchar(255) not null,
+  region varchar(32) not null,
+  index region (region)
+);
+create table invoice (
+  id bigint primary key auto_increment,
+  inserted_at datetime not null,
+  customer_id bigint not null,
+  amount bigint not null,
+  foreign key (customer_id) references customer (id)
+);
+create table note (
+  id bigint primary key auto_increment,
+  inserted_at datetime not null,
+  text varchar(255) not null
+);
@@ -0,0 +1,3 @@
+package migrations_postgres
+
+//go:generate go run ../../main.go --dialect=postgres --migrations_dir=migrations
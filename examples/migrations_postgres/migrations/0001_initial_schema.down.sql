@@ -0,0 +1,3 @@
+drop table note;
+drop table invoice;
+drop table customer;
@@ -0,0 +1,20 @@
+create table customer (
+  id bigserial primary key,
+  inserted_at timestamptz(0) not null,
+  name varchar(64) not null,
+  nickname varchar(255) not null,
+  region varchar(32) not null
+);
+create index customer_region_idx on customer (region);
+create table invoice (
+  id bigserial primary key,
+  inserted_at timestamptz(0) not null,
+  customer_id bigint not null,
+  amount bigint not null,
+  foreign key (customer_id) references customer (id)
+);
+create table note (
+  id bigserial primary key,
+  inserted_at timestamptz(0) not null,
+  text varchar(255) not null
+);
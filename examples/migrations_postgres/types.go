@@ -0,0 +1,40 @@
+package migrations_postgres
+
+import (
+	"time"
+
+	"github.com/thecodedproject/dbcrudgen/dbcrudgen"
+)
+
+// The data models have changed since the initial migration in
+// migrations/0001_initial_schema.up.sql, which was generated when Customer
+// had a Nickname, Note existed and Shipment did not, and so a migration with
+// the changes is generated
+type Customer struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	InsertedAt time.Time
+	Name string `dbcrudgen:"varchar(128),index=region_name"`
+	Email *string
+	Region string `dbcrudgen:"varchar(32),index=region_name"`
+}
+
+type Invoice struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	InsertedAt time.Time
+	CustomerID int64 `dbcrudgen:"references=Customer"`
+	Amount int64
+	Paid bool
+}
+
+type Shipment struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	InsertedAt time.Time
+	InvoiceID int64 `dbcrudgen:"references=Invoice,on_delete=cascade"`
+	Carrier string
+}
@@ -0,0 +1,3 @@
+package migrations_sqlite
+
+//go:generate go run ../../main.go --dialect=sqlite --migrations_dir=migrations
@@ -0,0 +1,20 @@
+create table customer (
+  id integer primary key autoincrement,
+  inserted_at datetime not null,
+  name varchar(64) not null,
+  nickname text not null,
+  region varchar(32) not null
+);
+create index customer_region_idx on customer (region);
+create table invoice (
+  id integer primary key autoincrement,
+  inserted_at datetime not null,
+  customer_id integer not null,
+  amount integer not null,
+  foreign key (customer_id) references customer (id)
+);
+create table note (
+  id integer primary key autoincrement,
+  inserted_at datetime not null,
+  text text not null
+);
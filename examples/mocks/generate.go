@@ -0,0 +1,3 @@
+package mocks
+
+//go:generate go run ../../main.go --dialect=sqlite --mocks
@@ -0,0 +1,35 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/thecodedproject/dbcrudgen/dbcrudgen"
+)
+
+type Author struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	InsertedAt time.Time
+	Name string
+}
+
+// Book references its author, so its mock has a `SelectWithAuthor` method
+type Book struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	InsertedAt time.Time
+	Title string
+	AuthorID int64 `dbcrudgen:"references=Author"`
+}
+
+// Setting is keyed by the composite key of its scope and name, so its mock
+// returns the `PK` of the rows it inserts
+type Setting struct {
+	dbcrudgen.DataModel
+
+	Scope string `dbcrudgen:"pk,size=64"`
+	Name string `dbcrudgen:"pk,size=64"`
+	Value string
+}
@@ -0,0 +1,3 @@
+package nullable_fields
+
+//go:generate go run ../../main.go
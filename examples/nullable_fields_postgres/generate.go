@@ -0,0 +1,3 @@
+package nullable_fields_postgres
+
+//go:generate go run ../../main.go --dialect=postgres
@@ -0,0 +1,46 @@
+package nullable_fields_postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/thecodedproject/dbcrudgen/dbcrudgen"
+)
+
+type Level int32
+
+const (
+	LevelUnknown Level = 0
+	LevelLow Level = 1
+	LevelHigh Level = 2
+)
+
+// PointerFields has a nullable column for each pointer field
+type PointerFields struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	InsertedAt time.Time
+	SomeString string
+	NullString *string
+	NullInt32 *int32
+	NullInt64 *int64
+	NullFloat *float64
+	NullBool *bool
+	NullTime *time.Time
+	NullLevel *Level
+}
+
+// SqlNullFields has a nullable column for each `sql.Null*` field
+type SqlNullFields struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	SomeInt int64
+	NullString sql.NullString
+	NullInt32 sql.NullInt32
+	NullInt64 sql.NullInt64
+	NullFloat sql.NullFloat64
+	NullBool sql.NullBool
+	NullTime sql.NullTime
+}
@@ -0,0 +1,3 @@
+package nullable_fields_sqlite
+
+//go:generate go run ../../main.go --dialect=sqlite
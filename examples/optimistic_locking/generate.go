@@ -0,0 +1,3 @@
+package optimistic_locking
+
+//go:generate go run ../../main.go
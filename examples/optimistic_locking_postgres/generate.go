@@ -0,0 +1,3 @@
+package optimistic_locking_postgres
+
+//go:generate go run ../../main.go --dialect=postgres
@@ -0,0 +1,30 @@
+package optimistic_locking_postgres
+
+import (
+	"time"
+
+	"github.com/thecodedproject/dbcrudgen/dbcrudgen"
+)
+
+// Account is updated by ID at the version it was read at, so that concurrent
+// updates of the same account are detected
+type Account struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	Email string `dbcrudgen:"unique"`
+	Balance int64
+	Version int64 `dbcrudgen:"version"`
+	UpdatedAt time.Time
+}
+
+// Document is keyed by its slug, and can be soft deleted, which bumps its
+// revision like any other update
+type Document struct {
+	dbcrudgen.DataModel
+
+	Slug string `dbcrudgen:"pk,size=64"`
+	Body string
+	Revision int64 `dbcrudgen:"version"`
+	DeletedAt *time.Time
+}
@@ -0,0 +1,3 @@
+package optimistic_locking_sqlite
+
+//go:generate go run ../../main.go --dialect=sqlite
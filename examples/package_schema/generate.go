@@ -0,0 +1,3 @@
+package package_schema
+
+//go:generate go run ../../main.go --if_not_exists
@@ -0,0 +1,3 @@
+package package_schema_postgres
+
+//go:generate go run ../../main.go --dialect=postgres --if_not_exists
@@ -0,0 +1,35 @@
+package package_schema_postgres
+
+import (
+	"time"
+
+	"github.com/thecodedproject/dbcrudgen/dbcrudgen"
+)
+
+// Comment is declared before the models it references, which are created
+// before it in the package schema
+type Comment struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	InsertedAt time.Time
+	PostID int64 `dbcrudgen:"references=Post,on_delete=cascade"`
+	Body string
+}
+
+type Post struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	InsertedAt time.Time
+	BlogID int64 `dbcrudgen:"references=Blog,on_delete=cascade"`
+	Title string `dbcrudgen:"varchar(128),index"`
+}
+
+type Blog struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	InsertedAt time.Time
+	Name string
+}
@@ -0,0 +1,3 @@
+package package_schema_sqlite
+
+//go:generate go run ../../main.go --dialect=sqlite --if_not_exists
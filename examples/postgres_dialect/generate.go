@@ -0,0 +1,3 @@
+package postgres_dialect
+
+//go:generate go run ../../main.go --dialect=postgres
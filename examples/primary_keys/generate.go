@@ -0,0 +1,3 @@
+package primary_keys
+
+//go:generate go run ../../main.go
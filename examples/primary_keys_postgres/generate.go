@@ -0,0 +1,3 @@
+package primary_keys_postgres
+
+//go:generate go run ../../main.go --dialect=postgres
@@ -0,0 +1,3 @@
+package primary_keys_sqlite
+
+//go:generate go run ../../main.go --dialect=sqlite
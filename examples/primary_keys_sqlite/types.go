@@ -0,0 +1,45 @@
+package primary_keys_sqlite
+
+import (
+	"time"
+
+	"github.com/thecodedproject/dbcrudgen/dbcrudgen"
+)
+
+// Account is keyed by a UUID, which is generated when it is inserted without
+// one
+type Account struct {
+	dbcrudgen.DataModel
+
+	ID string `dbcrudgen:"pk=uuid"`
+	InsertedAt time.Time
+	Name string
+}
+
+type Warehouse struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	City string
+}
+
+// Product is keyed by its natural key, and references a warehouse with an
+// auto increment id
+type Product struct {
+	dbcrudgen.DataModel
+
+	SKU string `dbcrudgen:"pk,size=32"`
+	Name string
+	Price int64
+	WarehouseID int64 `dbcrudgen:"references=Warehouse"`
+}
+
+// Setting is keyed by the composite key of its scope and name
+type Setting struct {
+	dbcrudgen.DataModel
+
+	Scope string `dbcrudgen:"pk,size=64"`
+	Name string `dbcrudgen:"pk,size=64"`
+	Value string
+	UpdatedAt time.Time
+}
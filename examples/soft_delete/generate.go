@@ -0,0 +1,3 @@
+package soft_delete
+
+//go:generate go run ../../main.go
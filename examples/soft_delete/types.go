@@ -0,0 +1,38 @@
+package soft_delete
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/thecodedproject/dbcrudgen/dbcrudgen"
+)
+
+// Post is soft deleted by setting its DeletedAt time
+type Post struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	Title string
+	UpdatedAt time.Time
+	DeletedAt *time.Time
+}
+
+// Comment is soft deleted by setting the time tagged `deleted_at`, and is
+// selected along with its post
+type Comment struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	PostID int64 `dbcrudgen:"references=Post"`
+	Body string
+	RemovedAt sql.NullTime `dbcrudgen:"deleted_at"`
+}
+
+// Draft is keyed by its slug, and is restored and hard deleted by it
+type Draft struct {
+	dbcrudgen.DataModel
+
+	Slug string `dbcrudgen:"pk,size=64"`
+	Body string
+	DeletedAt *time.Time
+}
@@ -0,0 +1,3 @@
+package soft_delete_postgres
+
+//go:generate go run ../../main.go --dialect=postgres
@@ -0,0 +1,3 @@
+package soft_delete_sqlite
+
+//go:generate go run ../../main.go --dialect=sqlite
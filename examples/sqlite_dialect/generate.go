@@ -0,0 +1,3 @@
+package sqlite_dialect
+
+//go:generate go run ../../main.go --dialect=sqlite
@@ -0,0 +1,22 @@
+package sqlite_dialect
+
+import (
+	"time"
+
+	"github.com/thecodedproject/dbcrudgen/dbcrudgen"
+)
+
+type MyDataModel struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	InsertedAt time.Time
+	UpdatedAt time.Time
+	SomeString string
+	SomeInt int64
+	SomeInt32 int32
+	SomeBool bool
+	SomeFloat float64
+	SomeBytes []byte
+	SomeTime time.Time
+}
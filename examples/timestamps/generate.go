@@ -0,0 +1,3 @@
+package timestamps
+
+//go:generate go run ../../main.go
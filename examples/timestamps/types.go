@@ -0,0 +1,37 @@
+package timestamps
+
+import (
+	"time"
+
+	"github.com/thecodedproject/dbcrudgen/dbcrudgen"
+)
+
+// Article has timestamps which are set by the generated methods, with the
+// modified time set on every update
+type Article struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	Created time.Time `dbcrudgen:"created_at"`
+	Modified time.Time `dbcrudgen:"name=modified_time,updated_at"`
+	Title string
+}
+
+// AuditEntry has its creation time set by the DB
+type AuditEntry struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	RecordedAt time.Time `dbcrudgen:"created_at=db"`
+	Message string
+}
+
+// Setting has its modified time set by the DB, which bumps it on every
+// update which changes the row
+type Setting struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	Value string
+	ModifiedAt time.Time `dbcrudgen:"updated_at=db"`
+}
@@ -0,0 +1,3 @@
+package timestamps_postgres
+
+//go:generate go run ../../main.go --dialect=postgres
@@ -0,0 +1,3 @@
+package timestamps_sqlite
+
+//go:generate go run ../../main.go --dialect=sqlite
@@ -0,0 +1,27 @@
+package timestamps_sqlite
+
+import (
+	"time"
+
+	"github.com/thecodedproject/dbcrudgen/dbcrudgen"
+)
+
+// Article has timestamps which are set by the generated methods, with the
+// modified time set on every update
+type Article struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	Created time.Time `dbcrudgen:"created_at"`
+	Modified time.Time `dbcrudgen:"name=modified_time,updated_at"`
+	Title string
+}
+
+// AuditEntry has its creation time set by the DB
+type AuditEntry struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	RecordedAt time.Time `dbcrudgen:"created_at=db"`
+	Message string
+}
@@ -0,0 +1,3 @@
+package unique_keys
+
+//go:generate go run ../../main.go
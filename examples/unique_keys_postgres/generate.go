@@ -0,0 +1,3 @@
+package unique_keys_postgres
+
+//go:generate go run ../../main.go --dialect=postgres
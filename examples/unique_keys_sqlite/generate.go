@@ -0,0 +1,3 @@
+package unique_keys_sqlite
+
+//go:generate go run ../../main.go --dialect=sqlite
@@ -0,0 +1,39 @@
+package unique_keys_sqlite
+
+import (
+	"time"
+
+	"github.com/thecodedproject/dbcrudgen/dbcrudgen"
+)
+
+// Account has a unique key on a single column
+type Account struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	InsertedAt time.Time
+	UpdatedAt time.Time
+	Email string `dbcrudgen:"varchar(128),unique"`
+	Name string
+	Logins int64
+}
+
+// Membership has a unique key on two columns, named `member`
+type Membership struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	GroupName string `dbcrudgen:"varchar(64),unique=member"`
+	UserName string `dbcrudgen:"varchar(64),unique=member"`
+	Role string
+}
+
+// Profile has two unique keys, on `handle` and on `email`
+type Profile struct {
+	dbcrudgen.DataModel
+
+	ID int64
+	Handle string `dbcrudgen:"varchar(64),unique"`
+	Email string `dbcrudgen:"varchar(128),unique"`
+	Bio string
+}
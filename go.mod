@@ -3,7 +3,12 @@ module github.com/thecodedproject/dbcrudgen
 go 1.20
 
 require (
+	github.com/fergusstrange/embedded-postgres v1.25.0
+	github.com/go-sql-driver/mysql v1.7.0
 	github.com/iancoleman/strcase v0.2.0
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.17
+	github.com/pkg/errors v0.8.1
 	github.com/sebdah/goldie/v2 v2.5.3
 	github.com/stretchr/testify v1.8.3
 	github.com/thecodedproject/gopkg v0.0.0-20230715211531-7153ef1b2e7c
@@ -12,11 +17,10 @@ require (
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/go-sql-driver/mysql v1.7.0 // indirect
-	github.com/pkg/errors v0.8.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/sergi/go-diff v1.0.0 // indirect
 	github.com/thecodedproject/gotest v0.0.0-20230703140753-332ed632c616 // indirect
 	github.com/thecodedproject/sqltest v0.0.0-20230808195109-2bfee2b61c18 // indirect
+	github.com/xi2/xz v0.0.0-20171230120015-48954b6210f8 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,627 @@
+package internal
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/iancoleman/strcase"
+	"github.com/thecodedproject/gopkg"
+)
+
+// fieldOptions are the options set for a data model field in its `dbcrudgen`
+// tag, e.g.
+//
+//	Email string `dbcrudgen:"type=varchar(64),name=email_addr,unique,default='x'"`
+//
+// The options are:
+//
+//	type=<sql type>   the SQL type of the column (also set by a bare SQL type,
+//	                  e.g. `dbcrudgen:"varchar(64)"`)
+//	name=<column>     the name of the column, instead of the snake case field name
+//	size=<n>          the length of the `varchar` column of a string field
+//	notnull           makes the column of a nullable (pointer or `sql.Null*`)
+//	                  field not null
+//	unique            adds the column to a unique key named after the column
+//	unique=<key>      adds the column to the unique key `key` (so that fields
+//	                  with the same key are unique together)
+//	index             adds the column to an index named after the column
+//	index=<name>      adds the column to the index `name` (so that fields with
+//	                  the same index name share a composite index)
+//	default=<value>   the default value of the column, as a SQL expression
+//	references=<model>
+//	                  makes the column a foreign key to the id of the data
+//	                  model `model` (in the same package), which may be the
+//	                  data model of the field if the field is nullable
+//	on_delete=<action>
+//	                  the action taken when the row referenced by a foreign key
+//	                  is deleted (cascade, restrict, set_null, set_default or
+//	                  no_action, where set_null requires a nullable field)
+//	created_at        sets the `time.Time` field to the current time when the
+//	                  row is inserted (the default for fields named InsertedAt)
+//	created_at=db     as created_at, but with the time set by the DB as the
+//	                  column default
+//	updated_at        sets the `time.Time` field to the current time when the
+//	                  row is inserted or updated (the default for fields named
+//	                  UpdatedAt)
+//	updated_at=db     as updated_at, but with the time set by the DB with
+//	                  `default current_timestamp on update current_timestamp`
+//	                  (mysql only)
+//	pk                makes the column part of the primary key of the table,
+//	                  instead of the auto increment `id` (the fields of a
+//	                  composite key are tagged `pk` in the order of the key)
+//	pk=uuid           as pk, on a string field which is set to a new random
+//	                  UUID if it is empty when the row is inserted
+//	deleted_at        makes the nullable time field the soft delete time of
+//	                  the row, so that `Delete` sets it rather than deleting
+//	                  the row (the default for nullable time fields named
+//	                  DeletedAt)
+//	version           makes the int64 field the version of the row, which is
+//	                  incremented by every update, and which `UpdateByID` (or
+//	                  `UpdateByPK`) must be given so that concurrent updates
+//	                  of the same row are detected (soft deleted rows are
+//	                  not found by them, whatever their version)
+type fieldOptions struct {
+	// Type is the SQL type of the column, used instead of the type derived
+	// from the go type if set
+	Type string
+
+	// Name is the name of the column, used instead of the snake case field
+	// name if set
+	Name string
+
+	// Size is the length of the `varchar` column of a string field, used
+	// instead of the default length if non-zero
+	Size int
+
+	// NotNull makes the column of a nullable field not null
+	NotNull bool
+
+	// Unique is the name of the unique key the column is part of, if any
+	Unique string
+
+	// Index is the name of the index the column is part of, if any
+	Index string
+
+	// Default is the SQL expression for the default value of the column
+	Default string
+
+	// References is the name of the data model the column is a foreign key
+	// to, if any
+	References string
+
+	// OnDelete is the SQL `on delete` action of the foreign key
+	OnDelete string
+
+	// Timestamp is `created_at` or `updated_at` if the field is set to the
+	// current time automatically
+	Timestamp string
+
+	// TimestampDB is set if the timestamp is set by the DB rather than by
+	// the generated methods
+	TimestampDB bool
+
+	// PK is set if the column is part of the primary key of the table
+	PK bool
+
+	// PKUUID is set if the primary key column is set to a new UUID when it
+	// is empty on insert
+	PKUUID bool
+
+	// DeletedAt is set if the field is the time at which the row was soft
+	// deleted
+	DeletedAt bool
+
+	// Version is set if the field is the version of the row used for
+	// optimistic locking
+	Version bool
+}
+
+const (
+	timestampCreatedAt = "created_at"
+	timestampUpdatedAt = "updated_at"
+)
+
+// onDeleteActions maps the `on_delete` option values to their SQL
+var onDeleteActions = map[string]string{
+	"cascade": "cascade",
+	"restrict": "restrict",
+	"set_null": "set null",
+	"set_default": "set default",
+	"no_action": "no action",
+}
+
+var columnNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func parseFieldOptions(
+	goField gopkg.DeclVar,
+) (fieldOptions, error) {
+
+	var opts fieldOptions
+	seen := make(map[string]bool)
+	for _, opt := range splitTagOptions(goField.StructTag.Get("dbcrudgen")) {
+		key, val, hasVal := strings.Cut(opt, "=")
+
+		if !hasVal && key != "notnull" && key != "unique" && key != "index" &&
+			key != timestampCreatedAt && key != timestampUpdatedAt && key != "pk" &&
+			key != "deleted_at" && key != "version" {
+			// A bare option (other than a flag) is the SQL type of the column
+			key, val, hasVal = "type", opt, true
+		}
+
+		if seen[key] {
+			return fieldOptions{}, errors.New("option '" + key + "' set more than once")
+		}
+		seen[key] = true
+
+		switch key {
+		case "type":
+			if val == "" {
+				return fieldOptions{}, errors.New("option 'type' requires a SQL type")
+			}
+			opts.Type = val
+		case "name":
+			if !columnNameRegexp.MatchString(val) {
+				return fieldOptions{}, errors.New("invalid column name '" + val + "'")
+			}
+			if goField.Name == "ID" {
+				return fieldOptions{}, errors.New("the id column cannot be renamed")
+			}
+			opts.Name = val
+		case "size":
+			size, err := strconv.Atoi(val)
+			if err != nil || size <= 0 {
+				return fieldOptions{}, errors.New("option 'size' must be a positive integer - got '" + val + "'")
+			}
+			opts.Size = size
+		case "notnull":
+			if hasVal {
+				return fieldOptions{}, errors.New("option 'notnull' does not take a value")
+			}
+			opts.NotNull = true
+		case "unique":
+			opts.Unique = columnName(goField)
+			if hasVal {
+				if val == "" {
+					return fieldOptions{}, errors.New("option 'unique' requires a key name if set with '='")
+				}
+				opts.Unique = val
+			}
+		case "index":
+			opts.Index = columnName(goField)
+			if hasVal {
+				if val == "" {
+					return fieldOptions{}, errors.New("option 'index' requires an index name if set with '='")
+				}
+				opts.Index = val
+			}
+		case "default":
+			if val == "" {
+				return fieldOptions{}, errors.New("option 'default' requires a value")
+			}
+			opts.Default = val
+		case "references":
+			if val == "" {
+				return fieldOptions{}, errors.New("option 'references' requires a data model name")
+			}
+			opts.References = val
+		case "on_delete":
+			action, ok := onDeleteActions[val]
+			if !ok {
+				return fieldOptions{}, errors.New("unknown on_delete action '" + val + "'")
+			}
+			opts.OnDelete = action
+		case timestampCreatedAt, timestampUpdatedAt:
+			if opts.Timestamp != "" {
+				return fieldOptions{}, errors.New("options 'created_at' and 'updated_at' cannot both be set")
+			}
+			if hasVal && val != "db" {
+				return fieldOptions{}, errors.New("option '" + key + "' only takes the value 'db' - got '" + val + "'")
+			}
+			opts.Timestamp = key
+			opts.TimestampDB = hasVal
+		case "pk":
+			if hasVal && val != "uuid" {
+				return fieldOptions{}, errors.New("option 'pk' only takes the value 'uuid' - got '" + val + "'")
+			}
+			opts.PK = true
+			opts.PKUUID = hasVal
+		case "deleted_at":
+			if hasVal {
+				return fieldOptions{}, errors.New("option 'deleted_at' does not take a value")
+			}
+			opts.DeletedAt = true
+		case "version":
+			if hasVal {
+				return fieldOptions{}, errors.New("option 'version' does not take a value")
+			}
+			opts.Version = true
+		default:
+			return fieldOptions{}, errors.New("unknown field option '" + key + "'")
+		}
+	}
+
+	if opts.Timestamp != "" {
+		if t, ok := goField.Type.(gopkg.TypeNamed); !ok || t.Name != "Time" || t.Import != "time" {
+			return fieldOptions{}, errors.New("option '" + opts.Timestamp + "' can only be set on time.Time fields")
+		}
+		if opts.TimestampDB && opts.Default != "" {
+			return fieldOptions{}, errors.New("option 'default' cannot be set on timestamps set by the DB")
+		}
+	}
+
+	if opts.Timestamp == "" {
+		// Fields named InsertedAt and UpdatedAt are timestamps by default
+		if goField.Name == "InsertedAt" {
+			opts.Timestamp = timestampCreatedAt
+		} else if goField.Name == "UpdatedAt" {
+			opts.Timestamp = timestampUpdatedAt
+		}
+	}
+
+	if opts.DeletedAt {
+		if !isNullableTime(goField.Type) {
+			return fieldOptions{}, errors.New("option 'deleted_at' can only be set on nullable time.Time fields")
+		}
+		if opts.NotNull || opts.PK || opts.References != "" || opts.Timestamp != "" {
+			return fieldOptions{}, errors.New("option 'deleted_at' cannot be set with 'notnull', 'pk', 'references' or timestamps")
+		}
+	} else if goField.Name == "DeletedAt" && isNullableTime(goField.Type) &&
+		!opts.NotNull && opts.References == "" {
+		// Nullable time fields named DeletedAt are the soft delete time by
+		// default
+		opts.DeletedAt = true
+	}
+
+	if opts.Version {
+		if _, ok := goField.Type.(gopkg.TypeInt64); !ok {
+			return fieldOptions{}, errors.New("option 'version' can only be set on int64 fields")
+		}
+		if opts.PK || opts.Unique != "" || opts.References != "" {
+			return fieldOptions{}, errors.New("option 'version' cannot be set with 'pk', 'unique' or 'references'")
+		}
+	}
+
+	if opts.PK {
+		if _, ok := nullableValueType(goField.Type); ok {
+			return fieldOptions{}, errors.New("option 'pk' cannot be set on nullable fields")
+		}
+		if opts.References != "" || opts.Timestamp != "" {
+			return fieldOptions{}, errors.New("option 'pk' cannot be set on foreign keys or timestamps")
+		}
+		if _, ok := goField.Type.(gopkg.TypeString); opts.PKUUID && !ok {
+			return fieldOptions{}, errors.New("option 'pk=uuid' can only be set on string fields")
+		}
+	}
+
+	if opts.OnDelete != "" && opts.References == "" {
+		return fieldOptions{}, errors.New("option 'on_delete' requires 'references'")
+	}
+
+	if opts.Size != 0 && opts.Type != "" {
+		return fieldOptions{}, errors.New("options 'size' and 'type' cannot both be set")
+	}
+
+	return opts, nil
+}
+
+// validateFieldOptions checks the `dbcrudgen` tags of the fields of all the
+// data models, so that invalid tags are reported before anything is generated
+func validateFieldOptions(models []gopkg.DeclType) error {
+
+	for _, m := range models {
+		mStruct, ok := m.Type.(gopkg.TypeStruct)
+		if !ok {
+			return errors.New("found datamodel which is not of type struct")
+		}
+
+		columns := make(map[string]string)
+		for _, f := range mStruct.Fields {
+			opts, err := parseFieldOptions(f)
+			if err != nil {
+				return errors.New("invalid dbcrudgen tag on " + m.Name + "." + f.Name + ": " + err.Error())
+			}
+
+			if opts.OnDelete == onDeleteActions["set_null"] && !isNullableColumn(f) {
+				return errors.New("invalid dbcrudgen tag on " + m.Name + "." + f.Name + ": option 'on_delete=set_null' requires a nullable field")
+			}
+
+			column := columnName(f)
+			if other, ok := columns[column]; ok {
+				return errors.New("invalid dbcrudgen tag on " + m.Name + "." + f.Name + ": column '" + column + "' is also used by field " + other)
+			}
+			columns[column] = f.Name
+		}
+
+		timestamps := make(map[string]string)
+		for _, f := range mStruct.Fields {
+			kind, _ := timestampOf(f)
+			if kind == "" {
+				continue
+			}
+
+			if other, ok := timestamps[kind]; ok {
+				return errors.New("invalid dbcrudgen tag on " + m.Name + "." + f.Name + ": option '" + kind + "' is also set on field " + other)
+			}
+			timestamps[kind] = f.Name
+		}
+
+		var deletedAt string
+		for _, f := range mStruct.Fields {
+			if !isSoftDeleteField(f) {
+				continue
+			}
+
+			if deletedAt != "" {
+				return errors.New("invalid dbcrudgen tag on " + m.Name + "." + f.Name + ": option 'deleted_at' is also set on field " + deletedAt)
+			}
+			deletedAt = f.Name
+		}
+
+		var version string
+		for _, f := range mStruct.Fields {
+			if !isVersionField(f) {
+				continue
+			}
+
+			if version != "" {
+				return errors.New("invalid dbcrudgen tag on " + m.Name + "." + f.Name + ": option 'version' is also set on field " + version)
+			}
+			version = f.Name
+		}
+
+		// The ID of a model with a primary key set by `pk` options is not
+		// auto incremented, and so must be part of the key if it exists
+		if hasCustomPrimaryKey(mStruct) {
+			for _, f := range mStruct.Fields {
+				if f.Name == "ID" && !isPKField(f) {
+					return errors.New("invalid dbcrudgen tag on " + m.Name + ".ID: the ID field must be tagged 'pk' when other fields of the model are")
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// columnName returns the name of the column of a data model field
+func columnName(f gopkg.DeclVar) string {
+
+	for _, opt := range splitTagOptions(f.StructTag.Get("dbcrudgen")) {
+		if name, ok := strings.CutPrefix(opt, "name="); ok {
+			return name
+		}
+	}
+
+	return strcase.ToSnake(f.Name)
+}
+
+// tableKey is a unique key or index on one or more columns of a table
+type tableKey struct {
+	Name string
+	// Fields are the names of the data model fields of the columns in the key
+	Fields []string
+	Columns []string
+}
+
+// uniqueKeys returns the unique keys declared on the fields of `modelStruct`,
+// in the order of the first field of each key
+func uniqueKeys(
+	modelStruct gopkg.TypeStruct,
+) ([]tableKey, error) {
+
+	return tableKeys(modelStruct, func(opts fieldOptions) string {
+		return opts.Unique
+	})
+}
+
+// indexes returns the indexes declared on the fields of `modelStruct`, in the
+// order of the first field of each index
+func indexes(
+	modelStruct gopkg.TypeStruct,
+) ([]tableKey, error) {
+
+	return tableKeys(modelStruct, func(opts fieldOptions) string {
+		return opts.Index
+	})
+}
+
+// tableKeys groups the fields of `modelStruct` into keys by the key name
+// returned by `keyName` for the options of each field, ignoring fields for
+// which the name is empty
+func tableKeys(
+	modelStruct gopkg.TypeStruct,
+	keyName func(fieldOptions) string,
+) ([]tableKey, error) {
+
+	var keys []tableKey
+	for _, f := range modelStruct.Fields {
+		opts, err := parseFieldOptions(f)
+		if err != nil {
+			return nil, err
+		}
+
+		name := keyName(opts)
+		if name == "" {
+			continue
+		}
+
+		found := false
+		for i := range keys {
+			if keys[i].Name == name {
+				keys[i].Fields = append(keys[i].Fields, f.Name)
+				keys[i].Columns = append(keys[i].Columns, columnName(f))
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			keys = append(keys, tableKey{
+				Name: name,
+				Fields: []string{f.Name},
+				Columns: []string{columnName(f)},
+			})
+		}
+	}
+
+	return keys, nil
+}
+
+// isUniqueField returns true if `f` is part of any unique key
+func isUniqueField(f gopkg.DeclVar) bool {
+
+	opts, err := parseFieldOptions(f)
+	if err != nil {
+		return false
+	}
+
+	return opts.Unique != ""
+}
+
+// hasUniqueFields returns true if any field of `modelStruct` is part of a
+// unique key
+func hasUniqueFields(modelStruct gopkg.TypeStruct) bool {
+
+	for _, f := range modelStruct.Fields {
+		if isUniqueField(f) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// timestampOf returns the kind of timestamp (`created_at` or `updated_at`)
+// of `f`, or an empty string if it is not set automatically, and whether it is
+// set by the DB
+func timestampOf(f gopkg.DeclVar) (string, bool) {
+
+	opts, err := parseFieldOptions(f)
+	if err != nil {
+		return "", false
+	}
+
+	return opts.Timestamp, opts.TimestampDB
+}
+
+// isTimestampField returns true if `f` is set to the current time
+// automatically, either by the generated methods or the DB
+func isTimestampField(f gopkg.DeclVar) bool {
+
+	kind, _ := timestampOf(f)
+	return kind != ""
+}
+
+// isAppTimestampField returns true if `f` is set to the current time by the
+// generated methods
+func isAppTimestampField(f gopkg.DeclVar) bool {
+
+	kind, dbSide := timestampOf(f)
+	return kind != "" && !dbSide
+}
+
+// isDBTimestampField returns true if `f` is set to the current time by the
+// DB
+func isDBTimestampField(f gopkg.DeclVar) bool {
+
+	kind, dbSide := timestampOf(f)
+	return kind != "" && dbSide
+}
+
+// hasDBTimestampFields returns true if any field of `modelStruct` is a
+// timestamp set by the DB
+func hasDBTimestampFields(modelStruct gopkg.TypeStruct) bool {
+
+	for _, f := range modelStruct.Fields {
+		if isDBTimestampField(f) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isNullableColumn returns true if the column of `f` can be null, which is
+// the case for nullable go types unless tagged `notnull`
+func isNullableColumn(f gopkg.DeclVar) bool {
+
+	if _, ok := nullableValueType(f.Type); !ok {
+		return false
+	}
+
+	opts, err := parseFieldOptions(f)
+	if err != nil {
+		return false
+	}
+
+	return !opts.NotNull
+}
+
+// isNullableTime returns true if `t` is a nullable (pointer or
+// `sql.NullTime`) `time.Time`
+func isNullableTime(t gopkg.Type) bool {
+
+	valueType, ok := nullableValueType(t)
+	if !ok {
+		return false
+	}
+
+	named, ok := valueType.(gopkg.TypeNamed)
+	return ok && named.Name == "Time" && named.Import == "time"
+}
+
+// isSoftDeleteField returns true if `f` is the time at which a row was soft
+// deleted
+func isSoftDeleteField(f gopkg.DeclVar) bool {
+
+	opts, err := parseFieldOptions(f)
+	if err != nil {
+		return false
+	}
+
+	return opts.DeletedAt
+}
+
+// softDeleteField returns the field of `modelStruct` which holds the time at
+// which a row was soft deleted, if the model has one
+func softDeleteField(
+	modelStruct gopkg.TypeStruct,
+) (gopkg.DeclVar, bool) {
+
+	for _, f := range modelStruct.Fields {
+		if isSoftDeleteField(f) {
+			return f, true
+		}
+	}
+
+	return gopkg.DeclVar{}, false
+}
+
+// isVersionField returns true if `f` is the version of a row used for
+// optimistic locking
+func isVersionField(f gopkg.DeclVar) bool {
+
+	opts, err := parseFieldOptions(f)
+	if err != nil {
+		return false
+	}
+
+	return opts.Version
+}
+
+// versionField returns the field of `modelStruct` which holds the version of
+// a row, if the model has one
+func versionField(
+	modelStruct gopkg.TypeStruct,
+) (gopkg.DeclVar, bool) {
+
+	for _, f := range modelStruct.Fields {
+		if isVersionField(f) {
+			return f, true
+		}
+	}
+
+	return gopkg.DeclVar{}, false
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/iancoleman/strcase"
 	"github.com/thecodedproject/gopkg"
@@ -23,47 +25,44 @@ func fileDBCrud(d pkgDef) func() ([]gopkg.FileContents, error) {
 			imports := tmpl.UnnamedImports(
 				"errors",
 				"fmt",
+				"github.com/thecodedproject/dbcrudgen/lib",
+				d.Dialect.driverErrorsImport(),
 			)
 
-			if d.UseDBContext {
-				imports = append(imports, tmpl.UnnamedImports(
-					"github.com/thecodedproject/dbcrudgen/lib",
-				)...)
-			}
-
 			modelName := model.Name
 			modelStruct, ok := model.Type.(gopkg.TypeStruct)
 			if !ok {
 				return nil, errors.New("found datamodel which is not of type struct")
 			}
 
+			keys, err := uniqueKeys(modelStruct)
+			if err != nil {
+				return nil, err
+			}
+
+			if len(keys) > 0 {
+				imports = append(imports, tmpl.UnnamedImports("strings")...)
+			}
+
 			for _, field := range modelStruct.Fields {
-				if field.Name == "InsertedAt" || field.Name == "UpdatedAt" {
-					imports = append(
-						imports,
-						gopkg.ImportAndAlias{
-							Import: "github.com/thecodedproject/gotest/time",
-						},
-					)
+				if isAppTimestampField(field) || isSoftDeleteField(field) {
+					imports = append(imports, d.Dialect.timeNowImports()...)
 					break
 				}
 			}
 
+			functions, types, err := dbCrudMethods(d, modelName, modelStruct, keys)
+			if err != nil {
+				return nil, err
+			}
+
 			files = append(files, gopkg.FileContents{
 				Filepath: filepath.Join(d.OutputPath, strcase.ToSnake(model.Name), "db_crud.go"),
 				PackageName: dbcrudDir,
 				PackageImportPath: dbcrudImport,
 				Imports: imports,
-				Functions: []gopkg.DeclFunc{
-					insertMethod(d, modelName, modelStruct),
-					selectByIDMethod(d, modelName, modelStruct),
-					selectMethod(d, modelName, modelStruct),
-					updateMethod(d, modelName, modelStruct),
-					updateByIDMethod(d, modelName, modelStruct),
-					deleteMethod(d, modelName, modelStruct),
-					deleteByIDMethod(d, modelName, modelStruct),
-					modelContainsFieldMethod(d, modelName, modelStruct),
-				},
+				Types: types,
+				Functions: functions,
 			})
 		}
 
@@ -71,45 +70,150 @@ func fileDBCrud(d pkgDef) func() ([]gopkg.FileContents, error) {
 	}
 }
 
+// dbCrudMethods returns the methods of the `db_crud.go` of a model, along
+// with the types they use
+func dbCrudMethods(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+	keys []tableKey,
+) ([]gopkg.DeclFunc, []gopkg.DeclType, error) {
+
+	customPK := hasCustomPrimaryKey(modelStruct)
+
+	insertMany, err := insertManyMethod(d, modelName, modelStruct)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	selectPage, err := selectPageMethod(d, modelName, modelStruct)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	selectIncludingDeleted, err := selectIncludingDeletedMethods(d, modelName, modelStruct)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	functions := []gopkg.DeclFunc{
+		createTableMethod(d),
+		insertMethod(d, modelName, modelStruct),
+		insertMany,
+	}
+	// Models with a custom primary key are selected by it instead of
+	// by ID, and have no upsert, as it returns the ID of the upserted row
+	if customPK {
+		functions = append(
+			functions,
+			selectByKeyMethod(d, modelName, modelStruct, "SelectByPK", primaryKey(modelStruct)),
+		)
+	} else {
+		functions = append(functions, upsertMethods(d, modelName, modelStruct, keys)...)
+		functions = append(
+			functions,
+			selectByIDMethod(d, modelName, modelStruct),
+		)
+	}
+	functions = append(functions, selectByKeyMethods(d, modelName, modelStruct, keys)...)
+	functions = append(
+		functions,
+		selectMethod(d, modelName, modelStruct),
+		selectPage,
+	)
+	functions = append(functions, selectIncludingDeleted...)
+	functions = append(functions, forEachMethod(d, modelName, modelStruct))
+
+	joinMethods, joinTypes, err := selectWithMethods(d, modelName, modelStruct)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	functions = append(functions, joinMethods...)
+	if customPK {
+		functions = append(functions, updateMethods(d, modelName, modelStruct)...)
+		functions = append(
+			functions,
+			updateByPKMethod(d, modelName, modelStruct),
+			deleteMethod(d, modelName, modelStruct),
+			deleteByPKMethod(d, modelName, modelStruct),
+		)
+	} else {
+		functions = append(functions, updateMethods(d, modelName, modelStruct)...)
+		functions = append(
+			functions,
+			updateByIDMethod(d, modelName, modelStruct),
+			deleteMethod(d, modelName, modelStruct),
+			deleteByIDMethod(d, modelName, modelStruct),
+		)
+	}
+	functions = append(functions, softDeleteMethods(d, modelName, modelStruct)...)
+	functions = append(
+		functions,
+		modelContainsFieldMethod(d, modelName, modelStruct),
+		scanRowMethod(d, modelName, modelStruct),
+	)
+
+	return functions, append(primaryKeyTypes(modelStruct), joinTypes...), nil
+}
+
+// createTableMethod returns the `CreateTable` method, which applies the
+// embedded `schema.sql` of the model, creating its table along with the
+// tables it references which do not exist
+func createTableMethod(
+	d pkgDef,
+) gopkg.DeclFunc {
+
+	return gopkg.DeclFunc{
+		Name: "CreateTable",
+		Args: dbMethodArgs(d.UseDBContext),
+		ReturnArgs: tmpl.UnnamedReturnArgs(
+			gopkg.TypeError{},
+		),
+		BodyTmpl: dbContextExtractionCode(d) + `
+	return lib.ExecSchema(ctx, db, Schema)
+`,
+	}
+}
+
 func insertMethod(
 	d pkgDef,
 	modelName string,
 	modelStruct gopkg.TypeStruct,
 ) gopkg.DeclFunc {
 
-	query := "insert into " + strcase.ToSnake(modelName) + " set "
+	columns := make([]string, 0, len(modelStruct.Fields))
 	queryArgs := make([]string, 0, len(modelStruct.Fields))
 
-	for iF, field := range modelStruct.Fields {
+	for _, field := range modelStruct.Fields {
 
-		if field.Name == "ID" {
+		if isAutoIDField(field) || isDBTimestampField(field) {
 			continue
 		}
 
-		if field.Name == "InsertedAt" || field.Name == "UpdatedAt" {
-			queryArgs = append(queryArgs, "time.Now()")
+		if isAppTimestampField(field) {
+			queryArgs = append(queryArgs, d.Dialect.timeNowCode())
 		} else {
 			queryArgs = append(queryArgs, "d." + field.Name)
 		}
 
-		query += strcase.ToSnake(field.Name) + "=?"
-
-		if iF < len(modelStruct.Fields)-1 {
-			query += ", "
-		}
+		columns = append(columns, columnName(field))
 	}
 
+	customPK := hasCustomPrimaryKey(modelStruct)
+	query := d.Dialect.insertQuery(strcase.ToSnake(modelName), columns, !customPK)
+
 	dbContextExtraction := ""
 	if d.UseDBContext {
 		dbContextExtraction = `
-	db, err := lib.DBFromContext(ctx)
+	db, err := lib.DBTXFromContext(ctx)
 	if err != nil {
 		{{FuncReturnDefaultsWithErr}}
 	}
 `
 	}
 
-	return gopkg.DeclFunc{
+	insert := gopkg.DeclFunc{
 		Name: "Insert",
 		Args: dbMethodArgs(
 			d.UseDBContext,
@@ -130,7 +234,73 @@ func insertMethod(
 		}{
 			DBInsertArgs: queryArgs,
 		},
-		BodyTmpl: dbContextExtraction + `
+		BodyTmpl: dbContextExtraction + insertExecCode(d, query),
+	}
+
+	if customPK {
+		// Rows with a custom primary key are inserted with the key set by the
+		// caller (or a new UUID), which is returned instead of an ID
+		insert.ReturnArgs = tmpl.UnnamedReturnArgs(
+			primaryKeyType(modelStruct),
+			gopkg.TypeError{},
+		)
+		uuidDefaults := ""
+		if code := uuidDefaultsCode(modelStruct, "d", "\t"); code != "" {
+			uuidDefaults = "\n" + code
+		}
+
+		// err is already declared when the DB is extracted from the context
+		assignErr := ":="
+		if d.UseDBContext {
+			assignErr = "="
+		}
+
+		insert.BodyTmpl = dbContextExtraction + uuidDefaults + `
+	_, err ` + assignErr + ` db.ExecContext(
+		ctx,
+		"` + query + `",
+{{- range .BodyData.DBInsertArgs}}
+		{{.}},
+{{- end}}
+	)
+	if err != nil {
+		return ` + primaryKeyZeroCode(modelStruct) + `, ` + d.Dialect.mapDriverErrorCode("err") + `
+	}
+
+	return ` + primaryKeyValueCode(modelStruct, "d", "") + `, nil
+`
+	}
+
+	return insert
+}
+
+// insertExecCode returns the code block which runs the insert `query` and
+// returns the ID of the inserted row
+func insertExecCode(
+	d pkgDef,
+	query string,
+) string {
+
+	if d.Dialect == dialectPostgres {
+		// The postgres driver does not support `LastInsertId` so the ID is
+		// returned by the insert query itself
+		return `
+	var id int64
+	if err := db.QueryRowContext(
+		ctx,
+		"` + query + `",
+{{- range .BodyData.DBInsertArgs}}
+		{{.}},
+{{- end}}
+	).Scan(&id); err != nil {
+		return 0, ` + d.Dialect.mapDriverErrorCode("err") + `
+	}
+
+	return id, nil
+`
+	}
+
+	return `
 	r, err := db.ExecContext(
 		ctx,
 		"` + query + `",
@@ -139,7 +309,7 @@ func insertMethod(
 {{- end}}
 	)
 	if err != nil {
-		{{FuncReturnDefaultsWithErr}}
+		return 0, ` + d.Dialect.mapDriverErrorCode("err") + `
 	}
 
 	id, err := r.LastInsertId()
@@ -148,146 +318,628 @@ func insertMethod(
 	}
 
 	return id, nil
-`,
-	}
+`
 }
 
-func selectByIDMethod(
+func insertManyMethod(
 	d pkgDef,
 	modelName string,
 	modelStruct gopkg.TypeStruct,
-) gopkg.DeclFunc {
+) (gopkg.DeclFunc, error) {
 
-	dbcrudDir := strcase.ToSnake(modelName)
-	dbcrudImport := path.Join(d.Import.Import, dbcrudDir)
+	columns := make([]string, 0, len(modelStruct.Fields))
+	rowArgs := make([]string, 0, len(modelStruct.Fields))
 
-	dbModelType := d.Import.Alias + "." + modelName
+	// postgres doesn't guarantee the order of the ids returned by a multi row
+	// insert, so the ids are taken from the id sequence and inserted with the
+	// rows instead
+	idColumn := ""
 
-	query := "select "
-	scanArgs := make([]string, 0, len(modelStruct.Fields))
+	for _, field := range modelStruct.Fields {
 
-	for iF, field := range modelStruct.Fields {
-		scanArgs = append(scanArgs, "&d." + field.Name)
+		if isAutoIDField(field) && d.Dialect == dialectPostgres {
+			idColumn = columnName(field)
+			rowArgs = append(rowArgs, "chunkIDs[i]")
+			columns = append(columns, idColumn)
+			continue
+		}
 
-		_, isBool := field.Type.(gopkg.TypeBool)
-		if isBool {
-			// The golang sql driver doesn't convert bools nicely
-			// Running the select query as:
-			//  `select (my_bool = '1') from my_table`
-			// is the easiest way I've found to solve the issue
-			//
-			// See: https://github.com/go-sql-driver/mysql/issues/440
-			query += "(" + strcase.ToSnake(field.Name) + " = '1')"
+		if isAutoIDField(field) || isDBTimestampField(field) {
+			continue
+		}
+
+		if isAppTimestampField(field) {
+			rowArgs = append(rowArgs, d.Dialect.timeNowCode())
 		} else {
-			query += strcase.ToSnake(field.Name)
+			rowArgs = append(rowArgs, "d." + field.Name)
 		}
 
-		if iF < len(modelStruct.Fields)-1 {
-			query += ", "
+		columns = append(columns, columnName(field))
+	}
+
+	query := "insert into " + strcase.ToSnake(modelName) +
+		" (" + strings.Join(columns, ", ") + ") values "
+
+	chunkSize := strconv.Itoa(insertManyChunkSize(d, len(columns)))
+
+	// The IDs of the inserted rows are returned, or the primary keys of rows
+	// with a custom primary key
+	idType := gopkg.Type(gopkg.TypeInt64{})
+	idsInit := `
+	ids := make([]int64, 0, len(ds))
+`
+	chunkCode := ""
+	rowCode := ""
+	execCode := insertManyExecCode(d)
+	if idColumn != "" {
+		chunkCode = insertManyIDsCode(strcase.ToSnake(modelName), idColumn)
+		execCode = `
+		_, err = db.ExecContext(ctx, q, args...)
+		if err != nil {
+			return nil, ` + d.Dialect.mapDriverErrorCode("err") + `
 		}
+`
 	}
+	if hasCustomPrimaryKey(modelStruct) {
+		idType = primaryKeyType(modelStruct)
+		idTypeCode, err := idType.FullType(map[string]string{
+			d.Import.Import: d.Import.Alias,
+			"time": "time",
+		})
+		if err != nil {
+			return gopkg.DeclFunc{}, err
+		}
 
-	query += " from " + strcase.ToSnake(modelName) + " where id=?"
+		idsInit = `
+	ids := make([]` + idTypeCode + `, 0, len(ds))
+`
+		rowCode = uuidDefaultsCode(modelStruct, "d", "\t\t\t") + `			ids = append(ids, ` + primaryKeyValueCode(modelStruct, "d", "") + `)
 
-	selectCtxAndDbArgs := `
-		ctx,
-		db,`
-	if d.UseDBContext {
-		selectCtxAndDbArgs = `
-		ctx,`
+`
+		execCode = `
+		_, err := db.ExecContext(ctx, q, args...)
+		if err != nil {
+			return nil, ` + d.Dialect.mapDriverErrorCode("err") + `
+		}
+`
 	}
 
 	return gopkg.DeclFunc{
-		Name: "SelectByID",
+		Name: "InsertMany",
 		Args: dbMethodArgs(
 			d.UseDBContext,
 			gopkg.DeclVar{
-				Name: "id",
-				Type: gopkg.TypeInt64{},
+				Name: "ds",
+				Type: gopkg.TypeArray{
+					ValueType: gopkg.TypeNamed{
+						Name: modelName,
+						Import: d.Import.Import,
+					},
+				},
 			},
 		),
 		ReturnArgs: tmpl.UnnamedReturnArgs(
-			gopkg.TypeNamed{
-				Name: dbModelType,
-				Import: dbcrudImport,
-				ValueType: gopkg.TypeStruct{},
+			gopkg.TypeArray{
+				ValueType: idType,
 			},
 			gopkg.TypeError{},
 		),
-		BodyData: scanArgs,
-		BodyTmpl: `
-	r, err := Select(` + selectCtxAndDbArgs + `
-		map[string]any{
-			"id": id,
-		},
-	)
-	if err != nil {
-		return ` + dbModelType + `{}, err
-	}
+		BodyData: rowArgs,
+		BodyTmpl: dbContextExtractionCode(d) + idsInit + `
+	// The rows are inserted in chunks to keep the number of query args under
+	// the max number of placeholders supported by the database
+	chunkSize := ` + chunkSize + `
+	for start := 0; start < len(ds); start += chunkSize {
+
+		end := start + chunkSize
+		if end > len(ds) {
+			end = len(ds)
+		}
+		chunk := ds[start:end]
+` + chunkCode + `
+		q := "` + query + `"
+		args := make([]any, 0, len(chunk)*` + strconv.Itoa(len(columns)) + `)
+		for i, d := range chunk {
+			if i > 0 {
+				q += ", "
+			}
+			q += ` + d.Dialect.placeholdersCode() + `.Row(len(args), ` + strconv.Itoa(len(columns)) + `)
 
-	if len(r) == 0 {
-		return ` + dbModelType + `{}, errors.New("SelectByID: id not found - " + fmt.Sprint(id))
-	}
+` + rowCode + `			args = append(
+				args,
+{{- range .BodyData}}
+				{{.}},
+{{- end}}
+			)
+		}
+` + execCode + `	}
 
-	if len(r) > 1 {
-		return ` + dbModelType + `{}, errors.New("found more than one entry with id")
+	return ids, nil
+`,
+	}, nil
+}
+
+// insertManyIDsCode returns the code which takes the IDs of the rows in
+// `chunk` from the sequence of the `idColumn` of `table` (for postgres, which
+// doesn't return the IDs of the inserted rows in order) as `chunkIDs`, and
+// appends them to `ids`
+func insertManyIDsCode(
+	table string,
+	idColumn string,
+) string {
+
+	return `
+		chunkIDs := make([]int64, 0, len(chunk))
+		r, err := db.QueryContext(
+			ctx,
+			"select nextval(pg_get_serial_sequence('` + table + `', '` + idColumn + `')) from generate_series(1, $1)",
+			len(chunk),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		for r.Next() {
+			var id int64
+			err := r.Scan(&id)
+			if err != nil {
+				r.Close()
+				return nil, err
+			}
+
+			chunkIDs = append(chunkIDs, id)
+		}
+
+		err = r.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		err = r.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, chunkIDs...)
+`
+}
+
+// insertManyExecCode returns the code which runs the insert query `q` for
+// the rows in `chunk` and appends the IDs of the inserted rows to `ids`,
+// for mysql and sqlite (which assign consecutive IDs to the rows inserted by
+// a single statement)
+func insertManyExecCode(
+	d pkgDef,
+) string {
+
+	firstID := `
+		// mysql returns the ID of the first row inserted by a multi row
+		// insert as the last insert ID
+		firstID := lastID`
+	if d.Dialect == dialectSqlite {
+		firstID = `
+		// sqlite returns the ID of the last row inserted as the last insert
+		// ID
+		firstID := lastID - int64(len(chunk)) + 1`
 	}
 
-	return r[0], nil
-`,
+	return `
+		r, err := db.ExecContext(ctx, q, args...)
+		if err != nil {
+			return nil, ` + d.Dialect.mapDriverErrorCode("err") + `
+		}
+
+		lastID, err := r.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+` + firstID + `
+		for i := range chunk {
+			ids = append(ids, firstID + int64(i))
+		}
+`
+}
+
+// insertManyChunkSize returns the max number of rows, each with `numColumns`
+// values, to insert in a single query
+func insertManyChunkSize(
+	d pkgDef,
+	numColumns int,
+) int {
+
+	if numColumns == 0 {
+		return 1
 	}
+
+	return d.Dialect.maxPlaceholders() / numColumns
 }
 
-func selectMethod(
+// upsertMethods returns the `Upsert` method, which inserts a row or updates
+// the existing row with the same unique key, if the model has any unique keys
+//
+// mysql updates the row on a conflict with any unique key, but postgres and
+// sqlite only support a single conflict target so only the first key is used,
+// and a conflict on any other key returns `lib.ErrDuplicateKey`.
+func upsertMethods(
 	d pkgDef,
 	modelName string,
 	modelStruct gopkg.TypeStruct,
-) gopkg.DeclFunc {
+	keys []tableKey,
+) []gopkg.DeclFunc {
 
-	dbcrudDir := strcase.ToSnake(modelName)
-	dbcrudImport := path.Join(d.Import.Import, dbcrudDir)
+	if len(keys) == 0 {
+		return nil
+	}
 
-	dbModelType := d.Import.Alias + "." + modelName
+	columns := make([]string, 0, len(modelStruct.Fields))
+	placeholders := make([]string, 0, len(modelStruct.Fields))
+	queryArgs := make([]string, 0, len(modelStruct.Fields))
+	overwriteDefault := make([]string, 0, len(modelStruct.Fields))
 
-	query := "select "
-	scanArgs := make([]string, 0, len(modelStruct.Fields))
+	for _, field := range modelStruct.Fields {
 
-	for iF, field := range modelStruct.Fields {
-		scanArgs = append(scanArgs, "&d." + field.Name)
+		if field.Name == "ID" || isDBTimestampField(field) {
+			continue
+		}
 
-		_, isBool := field.Type.(gopkg.TypeBool)
-		if isBool {
-			// The golang sql driver doesn't convert bools nicely
-			// Running the select query as:
-			//  `select (my_bool = '1') from my_table`
-			// is the easiest way I've found to solve the issue
-			//
-			// See: https://github.com/go-sql-driver/mysql/issues/440
-			query += "(" + strcase.ToSnake(field.Name) + " = '1')"
+		column := columnName(field)
+		columns = append(columns, column)
+
+		if d.Dialect == dialectPostgres {
+			placeholders = append(placeholders, "$" + strconv.Itoa(len(columns)))
 		} else {
-			query += strcase.ToSnake(field.Name)
+			placeholders = append(placeholders, "?")
 		}
 
-		if iF < len(modelStruct.Fields)-1 {
-			query += ", "
+		if isAppTimestampField(field) {
+			queryArgs = append(queryArgs, d.Dialect.timeNowCode())
+		} else {
+			queryArgs = append(queryArgs, "d." + field.Name)
 		}
-	}
 
-	query += " from " + strcase.ToSnake(modelName)
+		if kind, _ := timestampOf(field); kind != timestampCreatedAt && !isUniqueField(field) && !isVersionField(field) {
+			overwriteDefault = append(overwriteDefault, `"` + column + `"`)
+		}
+	}
 
-	dbContextExtraction := ""
-	if d.UseDBContext {
-		dbContextExtraction = `
-	db, err := lib.DBFromContext(ctx)
-	if err != nil {
-		{{FuncReturnDefaultsWithErr}}
+	if len(overwriteDefault) == 0 {
+		// Something must be set when the row is updated, so the key is
+		// overwritten with its own value
+		overwriteDefault = append(overwriteDefault, `"` + keys[0].Columns[0] + `"`)
 	}
+
+	query := "insert into " + strcase.ToSnake(modelName) +
+		" (" + strings.Join(columns, ", ") + ") values (" + strings.Join(placeholders, ", ") + ")"
+
+	setsInit := `make([]string, 0, len(overwrite))`
+	setCode := `column + "=excluded." + column`
+
+	// The version of an existing row is incremented when it is upserted,
+	// rather than being overwritten
+	overwriteCheck := `column == "id"`
+	versionCode := ""
+	if f, ok := versionField(modelStruct); ok {
+		column := columnName(f)
+		overwriteCheck = `column == "id" || column == "` + column + `"`
+		versionCode = `
+	sets = append(sets, "` + column + `=` + strcase.ToSnake(modelName) + `.` + column + ` + 1")
+`
+		if d.Dialect == dialectMysql {
+			versionCode = `
+	sets = append(sets, "` + column + `=` + column + ` + 1")
 `
+		}
+	}
+	conflictQuery := `" on conflict (` + strings.Join(keys[0].Columns, ", ") + `) do update set " + strings.Join(sets, ", ") + " returning id"`
+	// err is already declared when the DB is taken from the context
+	assignErr := ":="
+	if d.UseDBContext {
+		assignErr = "="
 	}
 
-	return gopkg.DeclFunc{
-		Name: "Select",
-		Args: dbMethodArgs(
+	execCode := `
+	var id int64
+	err ` + assignErr + ` db.QueryRowContext(
+		ctx,
+		q,
+{{- range .BodyData}}
+		{{.}},
+{{- end}}
+	).Scan(&id)
+	if err != nil {
+		return 0, ` + d.Dialect.mapDriverErrorCode("err") + `
+	}
+
+	return id, nil
+`
+	if d.Dialect == dialectMysql {
+		// Setting the ID with `last_insert_id` makes mysql return the ID of
+		// the updated row as the last insert ID
+		setsInit = `[]string{"id=last_insert_id(id)"}`
+		setCode = `column + "=values(" + column + ")"`
+		conflictQuery = `" on duplicate key update " + strings.Join(sets, ", ")`
+		execCode = `
+	r, err := db.ExecContext(
+		ctx,
+		q,
+{{- range .BodyData}}
+		{{.}},
+{{- end}}
+	)
+	if err != nil {
+		return 0, ` + d.Dialect.mapDriverErrorCode("err") + `
+	}
+
+	return r.LastInsertId()
+`
+	}
+
+	return []gopkg.DeclFunc{
+		{
+			Name: "Upsert",
+			Args: dbMethodArgs(
+				d.UseDBContext,
+				gopkg.DeclVar{
+					Name: "d",
+					Type: gopkg.TypeNamed{
+						Name: modelName,
+						Import: d.Import.Import,
+					},
+				},
+				gopkg.DeclVar{
+					Name: "overwrite",
+					Type: gopkg.TypeArray{
+						ValueType: gopkg.TypeString{},
+					},
+				},
+			),
+			VariadicLastArg: true,
+			ReturnArgs: tmpl.UnnamedReturnArgs(
+				gopkg.TypeInt64{},
+				gopkg.TypeError{},
+			),
+			BodyData: queryArgs,
+			BodyTmpl: dbContextExtractionCode(d) + `
+	if len(overwrite) == 0 {
+		overwrite = []string{` + strings.Join(overwriteDefault, ", ") + `}
+	}
+
+	sets := ` + setsInit + `
+	for _, column := range overwrite {
+		if !modelContainsField(column) {
+			return 0, fmt.Errorf("Upsert: %w", &lib.UnknownFieldError{Field: column})
+		}
+
+		if ` + overwriteCheck + ` {
+			return 0, errors.New("Upsert: cannot overwrite field - " + column)
+		}
+
+		sets = append(sets, ` + setCode + `)
+	}
+` + versionCode + `
+	q := "` + query + `" +
+		` + conflictQuery + `
+` + execCode,
+		},
+	}
+}
+
+func selectByIDMethod(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) gopkg.DeclFunc {
+
+	dbcrudDir := strcase.ToSnake(modelName)
+	dbcrudImport := path.Join(d.Import.Import, dbcrudDir)
+
+	dbModelType := d.Import.Alias + "." + modelName
+
+	query := "select "
+	scanArgs := make([]string, 0, len(modelStruct.Fields))
+
+	for iF, field := range modelStruct.Fields {
+		scanArgs = append(scanArgs, "&d." + field.Name)
+
+		if isBoolField(field.Type) {
+			// The golang sql driver doesn't convert bools nicely
+			// Running the select query as:
+			//  `select (my_bool = '1') from my_table`
+			// is the easiest way I've found to solve the issue
+			//
+			// See: https://github.com/go-sql-driver/mysql/issues/440
+			query += "(" + columnName(field) + " = '1')"
+		} else {
+			query += columnName(field)
+		}
+
+		if iF < len(modelStruct.Fields)-1 {
+			query += ", "
+		}
+	}
+
+	query += " from " + strcase.ToSnake(modelName) + " where id=?"
+
+	selectCtxAndDbArgs := `
+		ctx,
+		db,`
+	if d.UseDBContext {
+		selectCtxAndDbArgs = `
+		ctx,`
+	}
+
+	return gopkg.DeclFunc{
+		Name: "SelectByID",
+		Args: dbMethodArgs(
+			d.UseDBContext,
+			gopkg.DeclVar{
+				Name: "id",
+				Type: gopkg.TypeInt64{},
+			},
+		),
+		ReturnArgs: tmpl.UnnamedReturnArgs(
+			gopkg.TypeNamed{
+				Name: dbModelType,
+				Import: dbcrudImport,
+				ValueType: gopkg.TypeStruct{},
+			},
+			gopkg.TypeError{},
+		),
+		BodyData: scanArgs,
+		BodyTmpl: `
+	r, err := Select(` + selectCtxAndDbArgs + `
+		map[string]any{
+			"id": id,
+		},
+	)
+	if err != nil {
+		return ` + dbModelType + `{}, err
+	}
+
+	if len(r) == 0 {
+		return ` + dbModelType + `{}, fmt.Errorf("SelectByID: id %v: %w", id, lib.ErrNotFound)
+	}
+
+	if len(r) > 1 {
+		return ` + dbModelType + `{}, fmt.Errorf("SelectByID: found more than one entry with id: %w", lib.ErrTooManyRows)
+	}
+
+	return r[0], nil
+`,
+	}
+}
+
+// selectByKeyMethods returns a `SelectBy<Fields>` method for each unique key
+// of the model, which selects the one row with the given key
+func selectByKeyMethods(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+	keys []tableKey,
+) []gopkg.DeclFunc {
+
+	methods := make([]gopkg.DeclFunc, 0, len(keys))
+	for _, k := range keys {
+		methods = append(
+			methods,
+			selectByKeyMethod(d, modelName, modelStruct, "SelectBy" + strings.Join(k.Fields, "And"), k),
+		)
+	}
+
+	return methods
+}
+
+// selectByKeyMethod returns the method `methodName`, which selects the one
+// row with the given value of the key `k`
+func selectByKeyMethod(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+	methodName string,
+	k tableKey,
+) gopkg.DeclFunc {
+
+	dbcrudDir := strcase.ToSnake(modelName)
+	dbcrudImport := path.Join(d.Import.Import, dbcrudDir)
+
+	dbModelType := d.Import.Alias + "." + modelName
+
+	selectCtxAndDbArgs := `
+		ctx,
+		db,`
+	if d.UseDBContext {
+		selectCtxAndDbArgs = `
+		ctx,`
+	}
+
+	fieldTypes := make(map[string]gopkg.Type, len(modelStruct.Fields))
+	for _, f := range modelStruct.Fields {
+		fieldTypes[f.Name] = f.Type
+	}
+
+	args := make([]gopkg.DeclVar, 0, len(k.Fields))
+	for _, field := range k.Fields {
+		args = append(args, gopkg.DeclVar{
+			Name: keyArgName(field),
+			Type: fieldTypes[field],
+		})
+	}
+
+	return gopkg.DeclFunc{
+		Name: methodName,
+		Args: dbMethodArgs(d.UseDBContext, args...),
+		ReturnArgs: tmpl.UnnamedReturnArgs(
+			gopkg.TypeNamed{
+				Name: dbModelType,
+				Import: dbcrudImport,
+				ValueType: gopkg.TypeStruct{},
+			},
+			gopkg.TypeError{},
+		),
+		BodyData: struct{
+			Key tableKey
+			Args []gopkg.DeclVar
+		}{
+			Key: k,
+			Args: args,
+		},
+		BodyTmpl: `
+	r, err := Select(` + selectCtxAndDbArgs + `
+		map[string]any{
+{{- range $i, $arg := .BodyData.Args}}
+			"{{index $.BodyData.Key.Columns $i}}": {{$arg.Name}},
+{{- end}}
+		},
+	)
+	if err != nil {
+		return ` + dbModelType + `{}, err
+	}
+
+	if len(r) == 0 {
+		return ` + dbModelType + `{}, fmt.Errorf("` + methodName + `: ` + strings.Join(k.Columns, ", ") + ` ` + strings.TrimSuffix(strings.Repeat("%v, ", len(k.Columns)), ", ") + `: %w",
+{{- range .BodyData.Args}} {{.Name}},{{end}} lib.ErrNotFound)
+	}
+
+	if len(r) > 1 {
+		return ` + dbModelType + `{}, fmt.Errorf("` + methodName + `: found more than one entry with ` + strings.Join(k.Columns, ", ") + `: %w", lib.ErrTooManyRows)
+	}
+
+	return r[0], nil
+`,
+	}
+}
+
+// keyArgName returns the name of the arg for the value of `field` in a
+// generated method, which must not shadow the `ctx` and `db` args
+func keyArgName(field string) string {
+
+	name := strcase.ToLowerCamel(field)
+	if name == "ctx" || name == "db" {
+		return name + "Value"
+	}
+
+	return name
+}
+
+func selectMethod(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) gopkg.DeclFunc {
+
+	dbcrudDir := strcase.ToSnake(modelName)
+	dbcrudImport := path.Join(d.Import.Import, dbcrudDir)
+
+	dbModelType := d.Import.Alias + "." + modelName
+
+	ctxAndDbArgs := `ctx, db`
+	if d.UseDBContext {
+		ctxAndDbArgs = `ctx`
+	}
+
+	return gopkg.DeclFunc{
+		Name: "Select",
+		Args: dbMethodArgs(
 			d.UseDBContext,
 			gopkg.DeclVar{
 				Name: "queryParams",
@@ -296,7 +948,9 @@ func selectMethod(
 					ValueType: gopkg.TypeAny{},
 				},
 			},
+			condsArg(),
 		),
+		VariadicLastArg: true,
 		ReturnArgs: tmpl.UnnamedReturnArgs(
 			gopkg.TypeArray{
 				ValueType: gopkg.TypeNamed{
@@ -307,27 +961,460 @@ func selectMethod(
 			},
 			gopkg.TypeError{},
 		),
-		BodyData: scanArgs,
-		BodyTmpl: dbContextExtraction + `
+		BodyTmpl: `
+	return SelectPage(` + ctxAndDbArgs + `, lib.SelectOptions{}, queryParams, conds...)
+`,
+	}
+}
+
+func selectPageMethod(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) (gopkg.DeclFunc, error) {
+
+	if _, ok := softDeleteField(modelStruct); !ok {
+		return selectPageQueryMethod(d, modelName, modelStruct, "SelectPage")
+	}
+
+	// Models with soft deletes select the rows which are not deleted from
+	// the rows selected by `SelectPageIncludingDeleted`
+	m, err := selectPageQueryMethod(d, modelName, modelStruct, "SelectPage")
+	if err != nil {
+		return gopkg.DeclFunc{}, err
+	}
+
+	ctxAndDbArgs := `ctx, db`
+	if d.UseDBContext {
+		ctxAndDbArgs = `ctx`
+	}
+
+	m.BodyTmpl = `
+	return SelectPageIncludingDeleted(` + ctxAndDbArgs + `, opts, queryParams, withDeletedAtCond(conds, lib.OpIsNull)...)
+`
+
+	return m, nil
+}
+
+// selectPageQueryMethod returns the method `methodName` which selects a page
+// of rows, which is `SelectPage`, or `SelectPageIncludingDeleted` for models
+// with soft deletes
+func selectPageQueryMethod(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+	methodName string,
+) (gopkg.DeclFunc, error) {
+
+	dbcrudDir := strcase.ToSnake(modelName)
+	dbcrudImport := path.Join(d.Import.Import, dbcrudDir)
+
+	dbModelType := d.Import.Alias + "." + modelName
+
+	query := selectAllQuery(d, modelName, modelStruct)
+
+	pageAfter, err := pageAfterCode(d, modelStruct)
+	if err != nil {
+		return gopkg.DeclFunc{}, err
+	}
+
+	dbContextExtraction := ""
+	if d.UseDBContext {
+		dbContextExtraction = `
+	db, err := lib.DBTXFromContext(ctx)
+	if err != nil {
+		{{FuncReturnDefaultsWithErr}}
+	}
+`
+	}
+
+	// Rows are ordered by `id` in `OrderAndLimit` by default, so models with
+	// a custom primary key set their own default order
+	defaultOrder := ""
+	if hasCustomPrimaryKey(modelStruct) {
+		defaultOrder = `
+	if len(opts.OrderBy) == 0 {
+		opts.OrderBy = ` + primaryKeyOrderByCode(modelStruct, "\t\t") + `
+	}
+`
+	}
+
+	return gopkg.DeclFunc{
+		Name: methodName,
+		Args: dbMethodArgs(
+			d.UseDBContext,
+			gopkg.DeclVar{
+				Name: "opts",
+				Type: gopkg.TypeNamed{
+					Name: "SelectOptions",
+					Import: "github.com/thecodedproject/dbcrudgen/lib",
+				},
+			},
+			gopkg.DeclVar{
+				Name: "queryParams",
+				Type: gopkg.TypeMap{
+					KeyType: gopkg.TypeString{},
+					ValueType: gopkg.TypeAny{},
+				},
+			},
+			condsArg(),
+		),
+		VariadicLastArg: true,
+		ReturnArgs: tmpl.UnnamedReturnArgs(
+			gopkg.TypeArray{
+				ValueType: gopkg.TypeNamed{
+					Name: dbModelType,
+					Import: dbcrudImport,
+					ValueType: gopkg.TypeStruct{},
+				},
+			},
+			gopkg.TypeError{},
+		),
+		BodyTmpl: dbContextExtraction + pageAfter + `
+	q := "` + query + `"
+
+	where, queryVals, err := lib.Where(
+		` + d.Dialect.placeholdersCode() + `,
+		modelContainsField,
+		nil,
+		queryParams,
+		opts.PageConds(conds)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Select: %w", err)
+	}
+	q += where
+
+	maxRows, err := opts.MaxRowsOr(` + d.maxRowsCode(modelName) + `)
+	if err != nil {
+		return nil, fmt.Errorf("Select: %w", err)
+	}
+` + defaultOrder + `
+	orderAndLimit, err := opts.OrderAndLimit(modelContainsField, maxRows)
+	if err != nil {
+		return nil, fmt.Errorf("Select: %w", err)
+	}
+	q += orderAndLimit
+
+	r, err := db.QueryContext(
+		ctx,
+		q,
+		queryVals...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	res := make([]` + dbModelType + `, 0)
+	for r.Next() {
+
+		if maxRows != lib.UnlimitedRows && int64(len(res)) >= maxRows {
+			return nil, fmt.Errorf("Select: %w", lib.ErrTooManyRows)
+		}
+
+		d, err := scanRow(r)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, d)
+	}
+
+	err = r.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+`,
+	}, nil
+}
+
+func forEachMethod(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) gopkg.DeclFunc {
+
+	dbcrudDir := strcase.ToSnake(modelName)
+	dbcrudImport := path.Join(d.Import.Import, dbcrudDir)
+
+	dbModelType := d.Import.Alias + "." + modelName
+
+	query := selectAllQuery(d, modelName, modelStruct)
+
+	return gopkg.DeclFunc{
+		Name: "ForEach",
+		Args: dbMethodArgs(
+			d.UseDBContext,
+			gopkg.DeclVar{
+				Name: "queryParams",
+				Type: gopkg.TypeMap{
+					KeyType: gopkg.TypeString{},
+					ValueType: gopkg.TypeAny{},
+				},
+			},
+			gopkg.DeclVar{
+				Name: "fn",
+				Type: gopkg.TypeFunc{
+					Args: tmpl.UnnamedReturnArgs(
+						gopkg.TypeNamed{
+							Name: dbModelType,
+							Import: dbcrudImport,
+							ValueType: gopkg.TypeStruct{},
+						},
+					),
+					ReturnArgs: tmpl.UnnamedReturnArgs(
+						gopkg.TypeError{},
+					),
+				},
+			},
+			condsArg(),
+		),
+		VariadicLastArg: true,
+		ReturnArgs: tmpl.UnnamedReturnArgs(
+			gopkg.TypeError{},
+		),
+		BodyTmpl: dbContextExtractionCode(d) + `
 	q := "` + query + `"
 
-	if len(queryParams) > 0 {
-		q += " where "
+	where, queryVals, err := lib.Where(
+		` + d.Dialect.placeholdersCode() + `,
+		modelContainsField,
+		nil,
+		queryParams,
+		` + notDeletedCondsCode(modelStruct) + `,
+	)
+	if err != nil {
+		return fmt.Errorf("ForEach: %w", err)
+	}
+	q += where + " order by ` + strings.Join(primaryKey(modelStruct).Columns, ", ") + `"
+
+	r, err := db.QueryContext(
+		ctx,
+		q,
+		queryVals...,
+	)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for r.Next() {
+
+		d, err := scanRow(r)
+		if err != nil {
+			return err
+		}
+
+		err = fn(d)
+		if errors.Is(err, lib.ErrStopIteration) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return r.Err()
+`,
+	}
+}
+
+func scanRowMethod(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) gopkg.DeclFunc {
+
+	dbcrudDir := strcase.ToSnake(modelName)
+	dbcrudImport := path.Join(d.Import.Import, dbcrudDir)
+
+	dbModelType := d.Import.Alias + "." + modelName
+
+	scanArgs := make([]string, 0, len(modelStruct.Fields))
+	for _, field := range modelStruct.Fields {
+		scanArgs = append(scanArgs, "&d." + field.Name)
+	}
+
+	return gopkg.DeclFunc{
+		Name: "scanRow",
+		Args: []gopkg.DeclVar{
+			{
+				Name: "r",
+				Type: gopkg.TypePointer{
+					ValueType: gopkg.TypeNamed{
+						Name: "Rows",
+						Import: "database/sql",
+					},
+				},
+			},
+		},
+		ReturnArgs: tmpl.UnnamedReturnArgs(
+			gopkg.TypeNamed{
+				Name: dbModelType,
+				Import: dbcrudImport,
+				ValueType: gopkg.TypeStruct{},
+			},
+			gopkg.TypeError{},
+		),
+		BodyData: scanArgs,
+		BodyTmpl: `
+	var d ` + dbModelType + `
+	err := r.Scan(
+{{- range .BodyData}}
+		{{.}},
+{{- end}}
+	)
+	if err != nil {
+		return ` + dbModelType + `{}, err
+	}
+
+	return d, nil
+`,
+	}
+}
+
+// selectAllQuery returns the query selecting every column of the `modelName`
+// table, in the order they are scanned by `scanRow`
+func selectAllQuery(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) string {
+
+	query := "select "
+	for iF, field := range modelStruct.Fields {
+		query += d.Dialect.selectColumn(columnName(field), isBoolField(field.Type))
+
+		if iF < len(modelStruct.Fields)-1 {
+			query += ", "
+		}
+	}
+
+	return query + " from " + strcase.ToSnake(modelName)
+}
+
+// selectWithMethods returns a `SelectWith<Parent>` method for each foreign
+// key of the model, which selects rows along with the row they reference, and
+// the types of the rows they return.
+//
+// Rows which reference a soft deleted row are left out, as are soft deleted
+// rows of the model itself.
+func selectWithMethods(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) ([]gopkg.DeclFunc, []gopkg.DeclType, error) {
+
+	keys, err := foreignKeys(modelStruct)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The rows are ordered by the primary key of the model
+	pkColumns := make([]string, 0, len(primaryKey(modelStruct).Columns))
+	for _, c := range primaryKey(modelStruct).Columns {
+		pkColumns = append(pkColumns, "c." + c)
+	}
+
+	methods := make([]gopkg.DeclFunc, 0, len(keys))
+	types := make([]gopkg.DeclType, 0, len(keys))
+	for _, k := range keys {
+
+		var parentStruct gopkg.TypeStruct
+		for _, m := range d.DBDataModels {
+			if m.Name == k.Model {
+				parentStruct, _ = m.Type.(gopkg.TypeStruct)
+			}
+		}
+
+		rowType := "With" + k.Name()
+
+		joinCond := "p.id = c." + k.Column
+		if f, ok := softDeleteField(parentStruct); ok {
+			joinCond += " and p." + columnName(f) + " is null"
+		}
+
+		columns := make([]string, 0, len(modelStruct.Fields) + len(parentStruct.Fields))
+		scanArgs := make([]string, 0, len(modelStruct.Fields) + len(parentStruct.Fields))
+		for _, field := range modelStruct.Fields {
+			columns = append(columns, d.Dialect.selectColumn("c." + columnName(field), isBoolField(field.Type)))
+			scanArgs = append(scanArgs, "&row." + modelName + "." + field.Name)
+		}
+		for _, field := range parentStruct.Fields {
+			columns = append(columns, d.Dialect.selectColumn("p." + columnName(field), isBoolField(field.Type)))
+			scanArgs = append(scanArgs, "&row." + k.Name() + "." + field.Name)
+		}
+
+		types = append(types, gopkg.DeclType{
+			Name: rowType,
+			Type: gopkg.TypeStruct{
+				Fields: []gopkg.DeclVar{
+					{
+						Name: modelName,
+						Type: gopkg.TypeNamed{
+							Name: modelName,
+							Import: d.Import.Import,
+						},
+					},
+					{
+						Name: k.Name(),
+						Type: gopkg.TypeNamed{
+							Name: k.Model,
+							Import: d.Import.Import,
+						},
+					},
+				},
+			},
+		})
+
+		// The rows are selected in a subquery so that the conditions apply to
+		// the unqualified columns of the table, and are limited after the join
+		// so that rows which are left out by it do not use up the max rows
+		methods = append(methods, gopkg.DeclFunc{
+			Name: "SelectWith" + k.Name(),
+			Args: dbMethodArgs(
+				d.UseDBContext,
+				gopkg.DeclVar{
+					Name: "queryParams",
+					Type: gopkg.TypeMap{
+						KeyType: gopkg.TypeString{},
+						ValueType: gopkg.TypeAny{},
+					},
+				},
+				condsArg(),
+			),
+			VariadicLastArg: true,
+			ReturnArgs: tmpl.UnnamedReturnArgs(
+				gopkg.TypeArray{
+					ValueType: gopkg.TypeNamed{
+						Name: rowType,
+					},
+				},
+				gopkg.TypeError{},
+			),
+			BodyData: scanArgs,
+			BodyTmpl: dbContextExtractionCode(d) + `
+	q := "select ` + strings.Join(columns, ", ") + ` from (select * from ` + strcase.ToSnake(modelName) + `"
+
+	where, queryVals, err := lib.Where(
+		` + d.Dialect.placeholdersCode() + `,
+		modelContainsField,
+		nil,
+		queryParams,
+		` + notDeletedCondsCode(modelStruct) + `,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("SelectWith` + k.Name() + `: %w", err)
 	}
+	q += where
 
-	queryVals := make([]any, 0, len(queryParams))
-	i := 0
-	for k, v := range queryParams {
-		if !modelContainsField(k) {
-			return nil, errors.New("Select: no such field to query - " + k)
-		}
+	q += ") c join ` + k.Table() + ` p on ` + joinCond + ` order by ` + strings.Join(pkColumns, ", ") + `"
 
-		q += k + "=?"
-		i++
-		if i < len(queryParams) {
-			q += " and "
-		}
-		queryVals = append(queryVals, v)
+	maxRows := int64(` + d.maxRowsCode(modelName) + `)
+	if maxRows != lib.UnlimitedRows {
+		q += fmt.Sprintf(" limit %d", maxRows+1)
 	}
 
 	r, err := db.QueryContext(
@@ -338,17 +1425,16 @@ func selectMethod(
 	if err != nil {
 		return nil, err
 	}
+	defer r.Close()
 
-	// TODO: make this a configurable param
-	maxResponses := 1000
-	res := make([]` + dbModelType + `, 0, maxResponses)
+	res := make([]` + rowType + `, 0)
 	for r.Next() {
 
-		if len(res) >= maxResponses {
-			return nil, errors.New("select query exceeded max responses")
+		if maxRows != lib.UnlimitedRows && int64(len(res)) >= maxRows {
+			return nil, fmt.Errorf("SelectWith` + k.Name() + `: %w", lib.ErrTooManyRows)
 		}
 
-		var d ` + dbModelType + `
+		var row ` + rowType + `
 		err := r.Scan(
 {{- range .BodyData}}
 			{{.}},
@@ -358,23 +1444,63 @@ func selectMethod(
 			return nil, err
 		}
 
-		res = append(res, d)
+		res = append(res, row)
+	}
+
+	err = r.Err()
+	if err != nil {
+		return nil, err
 	}
 
 	return res, nil
 `,
+		})
 	}
+
+	return methods, types, nil
 }
 
-func updateMethod(
+// updateMethods returns the `Update` method, along with the unexported
+// `updateIncludingDeleted` for models with soft deletes
+func updateMethods(
 	d pkgDef,
 	modelName string,
 	modelStruct gopkg.TypeStruct,
-) gopkg.DeclFunc {
+) []gopkg.DeclFunc {
 
 	dbTable := strcase.ToSnake(modelName)
 
-	return gopkg.DeclFunc{
+	// The updated_at timestamp is set on every update, unless it is set
+	// explicitly
+	updatedAtCode := ""
+	for _, field := range modelStruct.Fields {
+		if kind, dbSide := timestampOf(field); kind != timestampUpdatedAt || dbSide {
+			continue
+		}
+
+		column := columnName(field)
+		updatedAtCode = `
+
+	if _, ok := updates["` + column + `"]; !ok {
+		query += ` + d.Dialect.eqPlaceholderCode(`", ` + column + `"`, "queryArgs") + `
+		queryArgs = append(queryArgs, ` + d.Dialect.timeNowCode() + `)
+	}`
+		break
+	}
+
+	// The version is incremented by every update, unless it is set
+	// explicitly
+	versionCode := ""
+	if f, ok := versionField(modelStruct); ok {
+		column := columnName(f)
+		versionCode = `
+
+	if _, ok := updates["` + column + `"]; !ok {
+		query += ", ` + column + `=` + column + ` + 1"
+	}`
+	}
+
+	update := gopkg.DeclFunc{
 		Name: "Update",
 		Args: dbMethodArgs(
 			d.UseDBContext,
@@ -392,7 +1518,9 @@ func updateMethod(
 					ValueType: gopkg.TypeAny{},
 				},
 			},
+			condsArg(),
 		),
+		VariadicLastArg: true,
 		ReturnArgs: tmpl.UnnamedReturnArgs(
 			gopkg.TypeInt64{},
 			gopkg.TypeError{},
@@ -407,35 +1535,29 @@ func updateMethod(
 	i := 0
 	for k, v := range updates {
 		if !modelContainsField(k) {
-			return 0, errors.New("Update: no such field to update - " + k)
+			return 0, fmt.Errorf("Update: %w", &lib.UnknownFieldError{Field: k})
 		}
 
-		query += k + "=?"
+		query += ` + d.Dialect.eqPlaceholderCode("k", "queryArgs") + `
 		i++
 		if i < len(updates) {
 			query += ", "
 		}
 
 		queryArgs = append(queryArgs, v)
+	}` + updatedAtCode + versionCode + `
+
+	where, queryArgs, err := lib.Where(
+		` + d.Dialect.placeholdersCode() + `,
+		modelContainsField,
+		queryArgs,
+		queryParams,
+		conds...,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("Update: %w", err)
 	}
-
-	if len(queryParams) > 0 {
-		query += " where "
-	}
-	i = 0
-	for k, v := range queryParams {
-		if !modelContainsField(k) {
-			return 0, errors.New("Update: no such field to query - " + k)
-		}
-
-		query += k + "=?"
-		i++
-		if i < len(queryParams) {
-			query += " and "
-		}
-
-		queryArgs = append(queryArgs, v)
-	}
+	query += where
 
 	r, err := db.ExecContext(
 		ctx,
@@ -443,7 +1565,7 @@ func updateMethod(
 		queryArgs...,
 	)
 	if err != nil {
-		return 0, err
+		return 0, ` + d.Dialect.mapDriverErrorCode("err") + `
 	}
 
 	count, err := r.RowsAffected()
@@ -454,6 +1576,24 @@ func updateMethod(
 	return count, nil
 `,
 	}
+
+	// Soft deleted rows are left out of updates, other than by `Restore`,
+	// which updates them with `updateIncludingDeleted`
+	if _, ok := softDeleteField(modelStruct); ok {
+		updateIncludingDeleted := update
+		updateIncludingDeleted.Name = "updateIncludingDeleted"
+		update.BodyTmpl = `
+	return updateIncludingDeleted(` + updateCtxAndDbArgsCode(d) + `
+		updates,
+		queryParams,
+		withDeletedAtCond(conds, lib.OpIsNull)...,
+	)
+`
+
+		return []gopkg.DeclFunc{update, updateIncludingDeleted}
+	}
+
+	return []gopkg.DeclFunc{update}
 }
 
 func updateByIDMethod(
@@ -462,42 +1602,103 @@ func updateByIDMethod(
 	modelStruct gopkg.TypeStruct,
 ) gopkg.DeclFunc {
 
-	updateCtxAndDbArgs := `
-		ctx,
-		db,`
-	if d.UseDBContext {
-		updateCtxAndDbArgs = `
-		ctx,`
+	args := []gopkg.DeclVar{
+		{
+			Name: "id",
+			Type: gopkg.TypeInt64{},
+		},
 	}
+	args = append(args, versionArgs(modelStruct)...)
 
 	return gopkg.DeclFunc{
 		Name: "UpdateByID",
 		Args: dbMethodArgs(
 			d.UseDBContext,
-			gopkg.DeclVar{
-				Name: "id",
-				Type: gopkg.TypeInt64{},
-			},
-			gopkg.DeclVar{
-				Name: "updates",
-				Type: gopkg.TypeMap{
-					KeyType: gopkg.TypeString{},
-					ValueType: gopkg.TypeAny{},
+			append(
+				args,
+				gopkg.DeclVar{
+					Name: "updates",
+					Type: gopkg.TypeMap{
+						KeyType: gopkg.TypeString{},
+						ValueType: gopkg.TypeAny{},
+					},
 				},
+			)...,
+		),
+		ReturnArgs: tmpl.UnnamedReturnArgs(
+			gopkg.TypeError{},
+		),
+		BodyData: []pkQueryParam{
+			{
+				Column: "id",
+				Arg: "id",
 			},
+		},
+		BodyTmpl: updateByKeyCode(d, modelName, modelStruct, "UpdateByID"),
+	}
+}
+
+// updateByPKMethod returns the `UpdateByPK` method of models with a custom
+// primary key, which updates the one row with the given key
+func updateByPKMethod(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) gopkg.DeclFunc {
+
+	args := append(primaryKeyArgs(modelStruct), versionArgs(modelStruct)...)
+
+	return gopkg.DeclFunc{
+		Name: "UpdateByPK",
+		Args: dbMethodArgs(
+			d.UseDBContext,
+			append(
+				args,
+				gopkg.DeclVar{
+					Name: "updates",
+					Type: gopkg.TypeMap{
+						KeyType: gopkg.TypeString{},
+						ValueType: gopkg.TypeAny{},
+					},
+				},
+			)...,
 		),
 		ReturnArgs: tmpl.UnnamedReturnArgs(
 			gopkg.TypeError{},
 		),
-		BodyTmpl: `
+		BodyData: pkQueryParams(modelStruct),
+		BodyTmpl: updateByKeyCode(d, modelName, modelStruct, "UpdateByPK"),
+	}
+}
+
+// updateByKeyCode returns the body of the method `methodName`, which updates
+// the one row with the key in its `BodyData` (as `[]pkQueryParam`), returning
+// `lib.ErrNotFound` if there is no such row (or it is soft deleted).
+//
+// For models with a version, only the row at the version given is updated,
+// in the one update statement, so when no row is updated the row is looked
+// up again to tell a missing row from one which has been updated since its
+// version was read.
+func updateByKeyCode(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+	methodName string,
+) string {
+
+	f, ok := versionField(modelStruct)
+	if !ok {
+		return `
 	if len(updates) == 0 {
 		return nil
 	}
 
-	n, err := Update(` + updateCtxAndDbArgs + `
+	n, err := Update(` + updateCtxAndDbArgsCode(d) + `
 		updates,
 		map[string]any{
-			"id": id,
+{{- range .BodyData}}
+			"{{.Column}}": {{.Arg}},
+{{- end}}
 		},
 	)
 	if err != nil {
@@ -505,11 +1706,72 @@ func updateByIDMethod(
 	}
 
 	if n == 0 {
-		return errors.New("UpdateByID: no such ID")
+		return fmt.Errorf("` + methodName + `: %w", lib.ErrNotFound)
 	}
 
 	return nil
-`,
+`
+	}
+
+	// Soft deleted rows are not found, as `Update` and `Select` leave them
+	// out
+	return `
+	if len(updates) == 0 {
+		return nil
+	}
+
+	n, err := Update(` + updateCtxAndDbArgsCode(d) + `
+		updates,
+		map[string]any{
+{{- range .BodyData}}
+			"{{.Column}}": {{.Arg}},
+{{- end}}
+			"` + columnName(f) + `": ` + keyArgName(f.Name) + `,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		rows, err := Select(` + strings.ReplaceAll(updateCtxAndDbArgsCode(d), "\n", "\n\t") + `
+			map[string]any{
+{{- range .BodyData}}
+				"{{.Column}}": {{.Arg}},
+{{- end}}
+			},
+		)
+		if err != nil {
+			return err
+		}
+
+		if len(rows) > 0 {
+			return fmt.Errorf("` + methodName + `: %w", lib.ErrConcurrentModification)
+		}
+
+		return fmt.Errorf("` + methodName + `: %w", lib.ErrNotFound)
+	}
+
+	return nil
+`
+}
+
+// versionArgs returns the arg for the expected version of the row taken by
+// the update by key methods of models with a version, or nil for other models
+func versionArgs(
+	modelStruct gopkg.TypeStruct,
+) []gopkg.DeclVar {
+
+	f, ok := versionField(modelStruct)
+	if !ok {
+		return nil
+	}
+
+	return []gopkg.DeclVar{
+		{
+			Name: keyArgName(f.Name),
+			Type: f.Type,
+		},
 	}
 }
 
@@ -519,10 +1781,42 @@ func deleteMethod(
 	modelStruct gopkg.TypeStruct,
 ) gopkg.DeclFunc {
 
+	f, ok := softDeleteField(modelStruct)
+	if !ok {
+		return hardDeleteMethod(d, modelName, modelStruct, "Delete")
+	}
+
+	// Rows are soft deleted by setting their deleted_at time, leaving the
+	// time of rows which are already deleted as it is (as `Update` leaves
+	// them out)
+	m := hardDeleteMethod(d, modelName, modelStruct, "Delete")
+	m.BodyTmpl = `
+	return Update(` + updateCtxAndDbArgsCode(d) + `
+		map[string]any{
+			"` + columnName(f) + `": ` + d.Dialect.timeNowCode() + `,
+		},
+		queryParams,
+		conds...,
+	)
+`
+
+	return m
+}
+
+// hardDeleteMethod returns the method `methodName` which deletes the rows
+// from the table, which is `Delete`, or `HardDelete` for models with soft
+// deletes
+func hardDeleteMethod(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+	methodName string,
+) gopkg.DeclFunc {
+
 	dbTable := strcase.ToSnake(modelName)
 
 	return gopkg.DeclFunc{
-		Name: "Delete",
+		Name: methodName,
 		Args: dbMethodArgs(
 			d.UseDBContext,
 			gopkg.DeclVar{
@@ -532,7 +1826,9 @@ func deleteMethod(
 					ValueType: gopkg.TypeAny{},
 				},
 			},
+			condsArg(),
 		),
+		VariadicLastArg: true,
 		ReturnArgs: tmpl.UnnamedReturnArgs(
 			gopkg.TypeInt64{},
 			gopkg.TypeError{},
@@ -540,24 +1836,17 @@ func deleteMethod(
 		BodyTmpl: dbContextExtractionCode(d) + `
 	query := "delete from ` + dbTable + `"
 
-	if len(queryParams) > 0 {
-		query += " where "
-	}
-	i := 0
-	queryArgs := make([]any, 0, len(queryParams))
-	for k, v := range queryParams {
-		if !modelContainsField(k) {
-			return 0, errors.New("Delete: no such field to query - " + k)
-		}
-
-		query += k + "=?"
-		i++
-		if i < len(queryParams) {
-			query += " and "
-		}
-
-		queryArgs = append(queryArgs, v)
+	where, queryArgs, err := lib.Where(
+		` + d.Dialect.placeholdersCode() + `,
+		modelContainsField,
+		nil,
+		queryParams,
+		conds...,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("` + methodName + `: %w", err)
 	}
+	query += where
 
 	r, err := db.ExecContext(
 		ctx,
@@ -615,7 +1904,60 @@ func deleteByIDMethod(
 	}
 
 	if n == 0 {
-		return errors.New("DeleteByID: no such ID")
+		return fmt.Errorf("DeleteByID: %w", lib.ErrNotFound)
+	}
+
+	return nil
+`,
+	}
+}
+
+// deleteByPKMethod returns the `DeleteByPK` method of models with a custom
+// primary key, which deletes the one row with the given key
+func deleteByPKMethod(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) gopkg.DeclFunc {
+
+	return byKeyMethod(d, modelStruct, "DeleteByPK", "Delete")
+}
+
+// byKeyMethod returns the method `methodName`, which calls the method
+// `fn` (which takes query params and conds, and returns the number of rows
+// affected) with the primary key of one row, returning `lib.ErrNotFound` if
+// no row was affected
+func byKeyMethod(
+	d pkgDef,
+	modelStruct gopkg.TypeStruct,
+	methodName string,
+	fn string,
+) gopkg.DeclFunc {
+
+	return gopkg.DeclFunc{
+		Name: methodName,
+		Args: dbMethodArgs(
+			d.UseDBContext,
+			primaryKeyArgs(modelStruct)...,
+		),
+		ReturnArgs: tmpl.UnnamedReturnArgs(
+			gopkg.TypeError{},
+		),
+		BodyData: pkQueryParams(modelStruct),
+		BodyTmpl: `
+	n, err := ` + fn + `(` + updateCtxAndDbArgsCode(d) + `
+		map[string]any{
+{{- range .BodyData}}
+			"{{.Column}}": {{.Arg}},
+{{- end}}
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return fmt.Errorf("` + methodName + `: %w", lib.ErrNotFound)
 	}
 
 	return nil
@@ -623,6 +1965,135 @@ func deleteByIDMethod(
 	}
 }
 
+// selectIncludingDeletedMethods returns the `SelectIncludingDeleted` and
+// `SelectPageIncludingDeleted` methods of models with soft deletes, which
+// select rows whether they have been deleted or not
+func selectIncludingDeletedMethods(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) ([]gopkg.DeclFunc, error) {
+
+	if _, ok := softDeleteField(modelStruct); !ok {
+		return nil, nil
+	}
+
+	ctxAndDbArgs := `ctx, db`
+	if d.UseDBContext {
+		ctxAndDbArgs = `ctx`
+	}
+
+	selectIncludingDeleted := selectMethod(d, modelName, modelStruct)
+	selectIncludingDeleted.Name = "SelectIncludingDeleted"
+	selectIncludingDeleted.BodyTmpl = `
+	return SelectPageIncludingDeleted(` + ctxAndDbArgs + `, lib.SelectOptions{}, queryParams, conds...)
+`
+
+	selectPage, err := selectPageQueryMethod(d, modelName, modelStruct, "SelectPageIncludingDeleted")
+	if err != nil {
+		return nil, err
+	}
+
+	return []gopkg.DeclFunc{
+		selectIncludingDeleted,
+		selectPage,
+	}, nil
+}
+
+// softDeleteMethods returns the `Restore` and `HardDelete` methods (along
+// with their by primary key variants) of models with soft deletes, and the
+// helper which adds the condition on the deleted_at column to queries
+func softDeleteMethods(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) []gopkg.DeclFunc {
+
+	f, ok := softDeleteField(modelStruct)
+	if !ok {
+		return nil
+	}
+
+	byKey := "ByID"
+	if hasCustomPrimaryKey(modelStruct) {
+		byKey = "ByPK"
+	}
+
+	restore := hardDeleteMethod(d, modelName, modelStruct, "Restore")
+	restore.BodyTmpl = `
+	return updateIncludingDeleted(` + updateCtxAndDbArgsCode(d) + `
+		map[string]any{
+			"` + columnName(f) + `": nil,
+		},
+		queryParams,
+		withDeletedAtCond(conds, lib.OpIsNotNull)...,
+	)
+`
+
+	return []gopkg.DeclFunc{
+		restore,
+		byKeyMethod(d, modelStruct, "Restore" + byKey, "Restore"),
+		hardDeleteMethod(d, modelName, modelStruct, "HardDelete"),
+		byKeyMethod(d, modelStruct, "HardDelete" + byKey, "HardDelete"),
+		{
+			Name: "withDeletedAtCond",
+			Args: []gopkg.DeclVar{
+				{
+					Name: "conds",
+					Type: condsArg().Type,
+				},
+				{
+					Name: "op",
+					Type: gopkg.TypeNamed{
+						Name: "Op",
+						Import: "github.com/thecodedproject/dbcrudgen/lib",
+					},
+				},
+			},
+			ReturnArgs: tmpl.UnnamedReturnArgs(
+				condsArg().Type,
+			),
+			BodyTmpl: `
+	// The conds are copied so that the slice of the caller is not modified
+	res := make([]lib.Cond, 0, len(conds) + 1)
+	res = append(res, conds...)
+
+	return append(res, lib.Cond{
+		Column: "` + columnName(f) + `",
+		Op: op,
+	})
+`,
+		},
+	}
+}
+
+// notDeletedCondsCode returns the code for the conds passed to `lib.Where`
+// by the methods which query rows, which leave out soft deleted rows for
+// models with soft deletes
+func notDeletedCondsCode(modelStruct gopkg.TypeStruct) string {
+
+	if _, ok := softDeleteField(modelStruct); ok {
+		return "withDeletedAtCond(conds, lib.OpIsNull)..."
+	}
+
+	return "conds..."
+}
+
+// updateCtxAndDbArgsCode returns the leading ctx (and db) args of the calls
+// to `Update` and `Delete` from the other generated methods, each on its own
+// line
+func updateCtxAndDbArgsCode(d pkgDef) string {
+
+	if d.UseDBContext {
+		return `
+		ctx,`
+	}
+
+	return `
+		ctx,
+		db,`
+}
+
 func modelContainsFieldMethod(
 	d pkgDef,
 	modelName string,
@@ -633,7 +2104,7 @@ func modelContainsFieldMethod(
 	for _, f := range modelStruct.Fields {
 		modelFields = append(
 			modelFields,
-			strcase.ToSnake(f.Name),
+			columnName(f),
 		)
 	}
 
@@ -674,10 +2145,22 @@ func ctxArg() gopkg.DeclVar {
 func dbArg() gopkg.DeclVar {
 	return gopkg.DeclVar{
 		Name: "db",
-		Type: gopkg.TypePointer{
+		Type: gopkg.TypeNamed{
+			Name: "DBTX",
+			Import: "github.com/thecodedproject/dbcrudgen/lib",
+		},
+	}
+}
+
+// condsArg returns the variadic `...lib.Cond` arg of the methods which
+// query rows
+func condsArg() gopkg.DeclVar {
+	return gopkg.DeclVar{
+		Name: "conds",
+		Type: gopkg.TypeArray{
 			ValueType: gopkg.TypeNamed{
-				Name: "DB",
-				Import: "database/sql",
+				Name: "Cond",
+				Import: "github.com/thecodedproject/dbcrudgen/lib",
 			},
 		},
 	}
@@ -687,11 +2170,11 @@ func dbArg() gopkg.DeclVar {
 //
 // The arguments will always be (in this order):
 // - `context.Context`
-// - `*sql.DB`, if `useDBContext == false`
+// - `lib.DBTX`, if `useDBContext == false`
 // - all the additional parameters passed in the `args` var.
 //
 // This is a convenience method to make it easier to build the args with the optional
-// `sql.DB` depending on whether the DB context is being used.
+// `lib.DBTX` depending on whether the DB context is being used.
 func dbMethodArgs(
 	useDBContext bool,
 	args ...gopkg.DeclVar,
@@ -707,7 +2190,7 @@ func dbMethodArgs(
 	return append(retArgs, args...)
 }
 
-// dbContextExtractionCode returns the code block required to extract the `sql.DB`
+// dbContextExtractionCode returns the code block required to extract the `lib.DBTX`
 // type from the context (or an empty string if db context is not enabled)
 func dbContextExtractionCode(
 	d pkgDef,
@@ -715,7 +2198,7 @@ func dbContextExtractionCode(
 
 	if d.UseDBContext {
 		return `
-	db, err := lib.DBFromContext(ctx)
+	db, err := lib.DBTXFromContext(ctx)
 	if err != nil {
 		{{FuncReturnDefaultsWithErr}}
 	}
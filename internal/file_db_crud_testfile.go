@@ -4,6 +4,7 @@ import (
 	"errors"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/iancoleman/strcase"
@@ -30,11 +31,13 @@ func fileDBCrudTest(d pkgDef) func() ([]gopkg.FileContents, error) {
 
 			imports := tmpl.UnnamedImports(
 				"context",
+				"database/sql",
+				"errors",
 				"fmt",
 				"github.com/stretchr/testify/require",
-				"github.com/thecodedproject/sqltest",
 				"github.com/thecodedproject/gotest/assert",
 			)
+			imports = append(imports, testDBImports(d)...)
 			imports = append(imports,
 				gopkg.ImportAndAlias{
 					Import: dbcrudImport,
@@ -47,10 +50,13 @@ func fileDBCrudTest(d pkgDef) func() ([]gopkg.FileContents, error) {
 				},
 			)
 
-			if d.UseDBContext {
-				imports = append(imports, tmpl.UnnamedImports(
-					"github.com/thecodedproject/dbcrudgen/lib",
-				)...)
+			imports = append(imports, tmpl.UnnamedImports(
+				"github.com/thecodedproject/dbcrudgen/lib",
+			)...)
+
+			keys, err := uniqueKeys(modelStruct)
+			if err != nil {
+				return nil, err
 			}
 
 			helpers, err := testHelperMethods(d, modelName, modelStruct)
@@ -58,20 +64,120 @@ func fileDBCrudTest(d pkgDef) func() ([]gopkg.FileContents, error) {
 				return nil, err
 			}
 
+			openDBHelpers, depImports, err := testOpenDBHelper(d, modelName, modelStruct)
+			if err != nil {
+				return nil, err
+			}
+
+			helpers = append(helpers, openDBHelpers...)
+			imports = append(imports, depImports...)
+
+			repositoryHelpers, err := testRepositoryHelpers(d, modelName, modelStruct)
+			if err != nil {
+				return nil, err
+			}
+
+			helpers = append(helpers, repositoryHelpers...)
+
+			if d.Dialect == dialectPostgres {
+				helpers = append(helpers, testMainPostgres())
+			}
+
+			if hasCustomPrimaryKey(modelStruct) {
+				// The tests of models with a custom primary key find the rows
+				// they insert by their keys, rather than by their IDs
+				tests := []gopkg.DeclFunc{
+					testfuncInsertAndSelectByPK(d, modelName, modelStruct),
+				}
+				tests = append(tests, testfuncInsertGeneratesUUIDs(d, modelName, modelStruct)...)
+				tests = append(
+					tests,
+					testfuncInsertManyByPK(d, modelName, modelStruct),
+					testfuncSelectMaxRows(d, modelName, modelStruct),
+					testfuncSelectPageAfterPK(d, modelName, modelStruct),
+					testfuncUpdateByPK(d, modelName, modelStruct),
+				)
+				tests = append(tests, testfuncUpdateConflicts(d, modelName, modelStruct)...)
+				tests = append(
+					tests,
+					testfuncDeleteByPK(d, modelName, modelStruct),
+				)
+				tests = append(tests, testfuncsSoftDelete(d, modelName, modelStruct)...)
+
+				// Transactions are only run on the DB, and the repository is
+				// compared with the package level methods, so these tests
+				// are only run against the SQL repository
+				functions := append(helpers, repositoryTests(tests...)...)
+				functions = append(functions, testfuncWithTxByPK(d, modelName, modelStruct))
+				functions = append(functions, repositoryTests(testfuncErrors(d, modelName, modelStruct))...)
+				functions = append(functions, testfuncRepository(d, modelName, modelStruct))
+				if d.Mocks {
+					functions = append(functions, testfuncMockRepository(d, modelName))
+				}
+
+				files = append(files, gopkg.FileContents{
+					Filepath: filepath.Join(d.OutputPath, dbcrudDir, "db_crud_test.go"),
+					PackageName: dbcrudAlias + "_test",
+					PackageImportPath: dbcrudImport + "_test",
+					Imports: imports,
+					Vars: testVars(modelStruct),
+					Types: []gopkg.DeclType{
+						testRepositoryOpenerType(dbcrudImport),
+					},
+					Functions: functions,
+				})
+				continue
+			}
+
+			tests := []gopkg.DeclFunc{
+				testfuncInsertAndSelect(d, modelName, modelStruct),
+				testfuncInsertMany(d, modelName, modelStruct),
+				testfuncInsertManyInChunks(d, modelName, modelStruct),
+			}
+			tests = append(tests, testfuncUpsert(d, modelName, modelStruct)...)
+			tests = append(
+				tests,
+				testfuncSelectWithQuery(d, modelName, modelStruct),
+				testfuncSelectPage(d, modelName, modelStruct),
+				testfuncSelectMaxRows(d, modelName, modelStruct),
+				testfuncForEach(d, modelName, modelStruct),
+				testfuncSelectByID(d, modelName, modelStruct),
+			)
+			tests = append(tests, testfuncSelectByKeys(d, modelName, modelStruct, keys)...)
+			tests = append(tests, testfuncSelectWith(d, modelName, modelStruct)...)
+			tests = append(tests, testfuncSelectWithMaxRows(d, modelName, modelStruct)...)
+			tests = append(
+				tests,
+				testfuncUpdate(d, modelName, modelStruct),
+				testfuncUpdateByID(d, modelName, modelStruct),
+			)
+			tests = append(tests, testfuncUpdateConflicts(d, modelName, modelStruct)...)
+			tests = append(tests, testfuncUpdateBumpsUpdatedAt(d, modelName, modelStruct)...)
+			tests = append(
+				tests,
+				testfuncDelete(d, modelName, modelStruct),
+				testfuncDeleteByID(d, modelName, modelStruct),
+			)
+			tests = append(tests, testfuncsSoftDelete(d, modelName, modelStruct)...)
+
+			functions := append(helpers, repositoryTests(tests...)...)
+			functions = append(functions, testfuncWithTx(d, modelName, modelStruct))
+			functions = append(functions, repositoryTests(testfuncErrors(d, modelName, modelStruct))...)
+			functions = append(functions, testfuncRepository(d, modelName, modelStruct))
+			if d.Mocks {
+				functions = append(functions, testfuncMockRepository(d, modelName))
+			}
+
 			files = append(files, gopkg.FileContents{
 				Filepath: filepath.Join(d.OutputPath, dbcrudDir, "db_crud_test.go"),
 				PackageName: dbcrudAlias + "_test",
 				PackageImportPath: dbcrudImport + "_test",
 				Imports: imports,
-				Functions: append(
-					helpers,
-					testfuncInsertAndSelect(d, modelName, modelStruct),
-					testfuncSelectByID(d, modelName, modelStruct),
-					testfuncUpdate(d, modelName, modelStruct),
-					testfuncUpdateByID(d, modelName, modelStruct),
-					testfuncDelete(d, modelName, modelStruct),
-					testfuncDeleteByID(d, modelName, modelStruct),
-				),
+				Vars: testVars(modelStruct),
+				Types: []gopkg.DeclType{
+					testRepositoryOpenerType(dbcrudImport),
+				},
+				Functions: functions,
 			})
 		}
 
@@ -85,20 +191,13 @@ func testfuncInsertAndSelect(
 	modelStruct gopkg.TypeStruct,
 ) gopkg.DeclFunc {
 
-	dbcrudAlias := strcase.ToSnake(modelName)
 	dbModelType := d.Import.Alias + "." + modelName
 
-	ctxAndDbArgs := `ctx, db`
-	if d.UseDBContext {
-		ctxAndDbArgs = `ctx`
-	}
-
 	return gopkg.DeclFunc{
 		Name: "TestInsertAndSelect",
 		Args: []gopkg.DeclVar{
 			testingArg(),
 		},
-		BodyData: d,
 		BodyTmpl: `
 	now := gotest_time.SetTimeNowForTesting(t)
 
@@ -166,19 +265,14 @@ func testfuncInsertAndSelect(
 
 	for _, test := range testCases {
 		t.Run(test.Name, func(t *testing.T) {
-			db := sqltest.OpenMysql(t, "schema.sql")
-{{- if .BodyData.UseDBContext}}
-			ctx := lib.ContextWithDB(context.Background(), db)
-{{- else}}
-			ctx := context.Background()
-{{- end}}
+			ctx, repo := openRepository(t)
 
 			for _, d := range test.ToInsert {
-				_, err := ` + dbcrudAlias + `.Insert(` + ctxAndDbArgs + `, d)
+				_, err := repo.Insert(ctx, d)
 				require.NoError(t, err)
 			}
 
-			actual, err := ` + dbcrudAlias + `.Select(` + ctxAndDbArgs + `, test.Query)
+			actual, err := repo.Select(ctx, test.Query)
 			if test.ExpectErr {
 				require.Error(t, err)
 				return
@@ -188,7 +282,7 @@ func testfuncInsertAndSelect(
 			require.Equal(t, len(test.Expected), len(actual))
 
 			for i := range actual {
-				assert.LogicallyEqual(t, test.Expected[i], actual[i], fmt.Sprint(i) + "th element not equal")
+				` + assertModelsEqualCode(modelStruct, "test.Expected[i]", "actual[i]", `fmt.Sprint(i) + "th element not equal"`) + `
 			}
 		})
 	}
@@ -196,214 +290,374 @@ func testfuncInsertAndSelect(
 	}
 }
 
-func testfuncSelectByID(
+func testfuncInsertMany(
 	d pkgDef,
 	modelName string,
 	modelStruct gopkg.TypeStruct,
 ) gopkg.DeclFunc {
 
-	dbcrudAlias := strcase.ToSnake(modelName)
 	dbModelType := d.Import.Alias + "." + modelName
 
-	ctxAndDbArgs := `ctx, db`
-	if d.UseDBContext {
-		ctxAndDbArgs = `ctx`
-	}
-
 	return gopkg.DeclFunc{
-		Name: "TestSelectByID",
+		Name: "TestInsertMany",
 		Args: []gopkg.DeclVar{
 			testingArg(),
 		},
-		BodyData: d,
 		BodyTmpl: `
 	now := gotest_time.SetTimeNowForTesting(t)
 
 	testCases := []struct{
 		Name string
+		PreInserted []` + dbModelType + `
 		ToInsert []` + dbModelType + `
-		ID int64
-		Expected ` + dbModelType + `
-		ExpectErr bool
+		ExpectedIDs []int64
+		Expected []` + dbModelType + `
 	}{
 		{
-			Name: "when ID not found returns error",
+			Name: "inserting nothing returns no IDs",
+			ExpectedIDs: []int64{},
+		},
+		{
+			Name: "insert many returns IDs in order",
 			ToInsert: []` + dbModelType + `{
-				populateDataModelFromNonce(100),
-				populateDataModelFromNonce(200),
+				populateDataModelFromNonce(11),
+				populateDataModelFromNonce(21),
+				populateDataModelFromNonce(31),
+			},
+			ExpectedIDs: []int64{1, 2, 3},
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(11, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(21, 2, now),
+				populateDataModelFromNonceWithIDAndTimestamp(31, 3, now),
 			},
-			ID: 12345,
-			ExpectErr: true,
 		},
 		{
-			Name: "when ID is found returns row",
+			Name: "insert many after existing records",
+			PreInserted: []` + dbModelType + `{
+				populateDataModelFromNonce(11),
+				populateDataModelFromNonce(21),
+			},
 			ToInsert: []` + dbModelType + `{
-				populateDataModelFromNonce(100),
-				populateDataModelFromNonce(200),
-				populateDataModelFromNonce(300),
+				populateDataModelFromNonce(31),
+				populateDataModelFromNonce(41),
+			},
+			ExpectedIDs: []int64{3, 4},
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(11, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(21, 2, now),
+				populateDataModelFromNonceWithIDAndTimestamp(31, 3, now),
+				populateDataModelFromNonceWithIDAndTimestamp(41, 4, now),
 			},
-			ID: 2,
-			Expected: populateDataModelFromNonceWithIDAndTimestamp(200, 2, now),
 		},
 	}
 
 	for _, test := range testCases {
 		t.Run(test.Name, func(t *testing.T) {
-			db := sqltest.OpenMysql(t, "schema.sql")
-{{- if .BodyData.UseDBContext}}
-			ctx := lib.ContextWithDB(context.Background(), db)
-{{- else}}
-			ctx := context.Background()
-{{- end}}
+			ctx, repo := openRepository(t)
 
-			for _, d := range test.ToInsert {
-				_, err := ` + dbcrudAlias + `.Insert(` + ctxAndDbArgs + `, d)
+			for _, d := range test.PreInserted {
+				_, err := repo.Insert(ctx, d)
 				require.NoError(t, err)
 			}
 
-			actual, err := ` + dbcrudAlias + `.SelectByID(` + ctxAndDbArgs + `, test.ID)
-			if test.ExpectErr {
-				require.Error(t, err)
-				return
-			}
+			ids, err := repo.InsertMany(ctx, test.ToInsert)
+			require.NoError(t, err)
+
+			require.Equal(t, test.ExpectedIDs, ids)
+
+			actual, err := repo.Select(ctx, nil)
 			require.NoError(t, err)
 
-			assert.LogicallyEqual(t, test.Expected, actual)
+			require.Equal(t, len(test.Expected), len(actual))
+
+			for i := range actual {
+				` + assertModelsEqualCode(modelStruct, "test.Expected[i]", "actual[i]", `fmt.Sprint(i) + "th element not equal"`) + `
+			}
 		})
 	}
 `,
 	}
 }
 
-func testfuncUpdate(
+func testfuncInsertManyInChunks(
 	d pkgDef,
 	modelName string,
 	modelStruct gopkg.TypeStruct,
 ) gopkg.DeclFunc {
 
-	dbcrudAlias := strcase.ToSnake(modelName)
 	dbModelType := d.Import.Alias + "." + modelName
 
-	ctxAndDbArgs := `ctx, db`
-	if d.UseDBContext {
-		ctxAndDbArgs = `ctx`
+	numColumns := 0
+	for _, field := range modelStruct.Fields {
+		if field.Name != "ID" {
+			numColumns++
+		}
 	}
 
+	// Insert enough rows to fill one chunk and start another
+	numToInsert := strconv.Itoa(insertManyChunkSize(d, numColumns) + 1)
+
 	return gopkg.DeclFunc{
-		Name: "TestUpdate",
+		Name: "TestInsertManyInChunks",
 		Args: []gopkg.DeclVar{
 			testingArg(),
 		},
-		BodyData: d,
 		BodyTmpl: `
 	now := gotest_time.SetTimeNowForTesting(t)
 
+	ctx, repo := openRepository(t)
+
+	toInsert := make([]` + dbModelType + `, 0, ` + numToInsert + `)
+	for i := 0; i < ` + numToInsert + `; i++ {
+		toInsert = append(toInsert, populateDataModelFromNonce(int64(i)))
+	}
+
+	ids, err := repo.InsertMany(ctx, toInsert)
+	require.NoError(t, err)
+
+	require.Equal(t, len(toInsert), len(ids))
+	for i, id := range ids {
+		require.Equal(t, int64(i+1), id)
+	}
+
+	actual, err := repo.SelectPage(
+		ctx,
+		lib.SelectOptions{
+			MaxRows: lib.UnlimitedRows,
+		},
+		nil,
+	)
+	require.NoError(t, err)
+
+	require.Equal(t, len(toInsert), len(actual))
+
+	for i := range actual {
+		expected := populateDataModelFromNonceWithIDAndTimestamp(int64(i), int64(i+1), now)
+		` + assertModelsEqualCode(modelStruct, "expected", "actual[i]", `fmt.Sprint(i) + "th element not equal"`) + `
+	}
+`,
+	}
+}
+
+func testfuncUpsert(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) []gopkg.DeclFunc {
+
+	if !hasUniqueFields(modelStruct) {
+		return nil
+	}
+
+	dbModelType := d.Import.Alias + "." + modelName
+
+	// Overwriting only some of the columns needs a column which is not part
+	// of a key, so the test is only generated if the model has one
+	overwriteOneTestCase := ""
+	for _, f := range modelStruct.Fields {
+		if f.Name == "ID" || isTimestampField(f) || isUniqueField(f) {
+			continue
+		}
+
+		overwriteOneTestCase = `
+		{
+			Name: "conflict overwrites only given fields",
+			Existing: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(2),
+			},
+			ToUpsert: populateDataModelFromNonce(3),
+			Conflicts: true,
+			Overwrite: []string{"` + columnName(f) + `"},
+			ExpectedID: 1,
+			Expected: []` + dbModelType + `{
+				func() ` + dbModelType + ` {
+					d := populateDataModelFromNonceWithIDAndTimestamp(1, 1, now)
+					d.` + f.Name + ` = populateDataModelFromNonce(3).` + f.Name + `
+					return d
+				}(),
+				populateDataModelFromNonceWithIDAndTimestamp(2, 2, now),
+			},
+		},`
+		break
+	}
+
+	// Only the first unique key is the conflict target of the upsert for
+	// postgres and sqlite (see `upsertMethods`), so a conflict on the second
+	// key is an error for them, and updates the conflicting row for mysql
+	otherKeyTestCase := ""
+	otherKeyField := ""
+	otherKeyCode := ""
+	expectedErrCode := ""
+	if keys, err := uniqueKeys(modelStruct); err == nil && len(keys) > 1 {
+		otherKeyField = `
+		// ConflictsOnOtherKey sets the second unique key of ToUpsert to that
+		// of the first existing row
+		ConflictsOnOtherKey bool
+		ExpectedErr error`
+
+		otherKeyCode = `
+			if test.ConflictsOnOtherKey {`
+		for _, f := range keys[1].Fields {
+			otherKeyCode += `
+				toUpsert.` + f + ` = test.Existing[0].` + f
+		}
+		otherKeyCode += `
+			}
+`
+
+		otherKeyTestCase = `
+		{
+			Name: "conflict on other unique key returns duplicate key error",
+			Existing: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(2),
+			},
+			ToUpsert: populateDataModelFromNonce(3),
+			ConflictsOnOtherKey: true,
+			ExpectedErr: lib.ErrDuplicateKey,
+		},`
+		if d.Dialect == dialectMysql {
+			otherKeyTestCase = `
+		{
+			Name: "conflict on other unique key overwrites",
+			Existing: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(2),
+			},
+			ToUpsert: populateDataModelFromNonce(3),
+			ConflictsOnOtherKey: true,
+			ExpectedID: 1,
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(3, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(2, 2, now),
+			},
+		},`
+		}
+
+		expectedErrCode = `
+			if test.ExpectedErr != nil {
+				require.ErrorIs(t, err, test.ExpectedErr)
+				return
+			}
+`
+	}
+
+	return []gopkg.DeclFunc{
+		{
+			Name: "TestUpsert",
+			Args: []gopkg.DeclVar{
+				testingArg(),
+			},
+			BodyTmpl: `
+	now := gotest_time.SetTimeNowForTesting(t)
+
 	testCases := []struct{
 		Name string
-		ToInsert []` + dbModelType + `
-		Updates map[string]any
-		Query map[string]any
-		ExpectedNumUpdates int64
+		Existing []` + dbModelType + `
+		ToUpsert ` + dbModelType + `
+		// Conflicts sets the keys of ToUpsert to those of the first existing
+		// row
+		Conflicts bool
+		Overwrite []string
+		ExpectedID int64
 		Expected []` + dbModelType + `
-		ExpectErr bool
+		ExpectErr bool` + otherKeyField + `
 	}{
 		{
-			Name: "empty params does nothing",
-		},
-		{
-			Name: "update unknown field throws error",
-			Updates: map[string]any{
-				"field_not_in_the_` + dbModelType + `_type": "update",
+			Name: "no conflict inserts",
+			Existing: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(2),
 			},
-			ExpectErr: true,
-		},
-		{
-			Name: "query unknown field throws error",
-			Updates: queryFromNonce(1),
-			Query: map[string]any{
-				"field_not_in_` + modelName + `": "update",
+			ToUpsert: populateDataModelFromNonce(3),
+			ExpectedID: 3,
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(1, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(2, 2, now),
+				populateDataModelFromNonceWithIDAndTimestamp(3, 3, now),
 			},
-			ExpectErr: true,
 		},
 		{
-			Name: "update all records",
-			ToInsert: []` + dbModelType + `{
-				populateDataModelFromNonce(123),
-				populateDataModelFromNonce(124),
-				populateDataModelFromNonce(125),
-				populateDataModelFromNonce(126),
+			Name: "conflict overwrites all non key fields by default",
+			Existing: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(2),
 			},
-			Updates: queryFromNonce(111),
-			ExpectedNumUpdates: 4,
+			ToUpsert: populateDataModelFromNonce(3),
+			Conflicts: true,
+			ExpectedID: 1,
 			Expected: []` + dbModelType + `{
-				populateDataModelFromNonceWithIDAndTimestamp(111, 1, now),
-				populateDataModelFromNonceWithIDAndTimestamp(111, 2, now),
-				populateDataModelFromNonceWithIDAndTimestamp(111, 3, now),
-				populateDataModelFromNonceWithIDAndTimestamp(111, 4, now),
+				populateDataModelFromNonceWithIDAndTimestamp(3, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(2, 2, now),
 			},
-		},
+		},` + overwriteOneTestCase + otherKeyTestCase + `
 		{
-			Name: "update records with query",
-			ToInsert: []` + dbModelType + `{
-				populateDataModelFromNonce(123),
-				populateDataModelFromNonce(125),
-				populateDataModelFromNonce(124),
-				populateDataModelFromNonce(125),
-				populateDataModelFromNonce(126),
-				populateDataModelFromNonce(125),
+			Name: "overwriting field not in schema throws error",
+			Existing: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
 			},
-			Updates: queryFromNonce(999),
-			Query: queryFromNonce(125),
-			ExpectedNumUpdates: 3,
-			Expected: []` + dbModelType + `{
-				populateDataModelFromNonceWithIDAndTimestamp(123, 1, now),
-				populateDataModelFromNonceWithIDAndTimestamp(999, 2, now),
-				populateDataModelFromNonceWithIDAndTimestamp(124, 3, now),
-				populateDataModelFromNonceWithIDAndTimestamp(999, 4, now),
-				populateDataModelFromNonceWithIDAndTimestamp(126, 5, now),
-				populateDataModelFromNonceWithIDAndTimestamp(999, 6, now),
+			ToUpsert: populateDataModelFromNonce(2),
+			Conflicts: true,
+			Overwrite: []string{"field_not_in_the_` + dbModelType + `_type"},
+			ExpectErr: true,
+		},
+		{
+			Name: "overwriting id throws error",
+			Existing: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
 			},
+			ToUpsert: populateDataModelFromNonce(2),
+			Conflicts: true,
+			Overwrite: []string{"id"},
+			ExpectErr: true,
 		},
 	}
 
 	for _, test := range testCases {
 		t.Run(test.Name, func(t *testing.T) {
-			db := sqltest.OpenMysql(t, "schema.sql")
-{{- if .BodyData.UseDBContext}}
-			ctx := lib.ContextWithDB(context.Background(), db)
-{{- else}}
-			ctx := context.Background()
-{{- end}}
+			ctx, repo := openRepository(t)
 
-			for _, d := range test.ToInsert {
-				_, err := ` + dbcrudAlias + `.Insert(` + ctxAndDbArgs + `, d)
+			for _, d := range test.Existing {
+				_, err := repo.Insert(ctx, d)
 				require.NoError(t, err)
 			}
 
-			numUpdates, err := ` + dbcrudAlias + `.Update(` + ctxAndDbArgs + `, test.Updates, test.Query)
+			toUpsert := test.ToUpsert
+			if test.Conflicts {
+				toUpsert = withUniqueFieldsOf(toUpsert, test.Existing[0])
+			}
+` + otherKeyCode + `
+			id, err := repo.Upsert(ctx, toUpsert, test.Overwrite...)
+` + expectedErrCode + `
 			if test.ExpectErr {
 				require.Error(t, err)
 				return
 			}
 			require.NoError(t, err)
 
-			require.Equal(t, test.ExpectedNumUpdates, numUpdates)
+			require.Equal(t, test.ExpectedID, id)
 
-			actual, err := ` + dbcrudAlias + `.Select(` + ctxAndDbArgs + `, nil)
+			actual, err := repo.Select(ctx, nil)
 			require.NoError(t, err)
 
 			require.Equal(t, len(test.Expected), len(actual))
 
 			for i := range actual {
-				assert.LogicallyEqual(t, test.Expected[i], actual[i], fmt.Sprint(i) + "th element not equal")
+				` + assertModelsEqualCode(modelStruct, "test.Expected[i]", "actual[i]", `fmt.Sprint(i) + "th element not equal"`) + `
+			}
+
+			if test.Conflicts {
+				assert.LogicallyEqual(t, toUpsert, withUniqueFieldsOf(toUpsert, actual[0]), "keys of conflicting row changed")
 			}
 		})
 	}
 `,
+		},
 	}
 }
 
-func testfuncUpdateByID(
+func testfuncSelectWithQuery(
 	d pkgDef,
 	modelName string,
 	modelStruct gopkg.TypeStruct,
@@ -412,120 +666,106 @@ func testfuncUpdateByID(
 	dbcrudAlias := strcase.ToSnake(modelName)
 	dbModelType := d.Import.Alias + "." + modelName
 
-	ctxAndDbArgs := `ctx, db`
-	if d.UseDBContext {
-		ctxAndDbArgs = `ctx`
+	// Only string fields can be queried with `like`, so the test is only
+	// generated if the model has one
+	likeTestCase := ""
+	for _, f := range modelStruct.Fields {
+		if _, ok := f.Type.(gopkg.TypeString); !ok || isUniqueField(f) {
+			continue
+		}
+
+		likeTestCase = `
+		{
+			Name: "like pattern",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(12),
+				populateDataModelFromNonce(13),
+				populateDataModelFromNonce(2),
+				populateDataModelFromNonce(123),
+			},
+			Conds: ` + dbcrudAlias + `.Where().` + f.Name + `Like("some_str1%"),
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(12, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(13, 2, now),
+				populateDataModelFromNonceWithIDAndTimestamp(123, 4, now),
+			},
+		},`
+		break
 	}
 
-	return gopkg.DeclFunc{
-		Name: "TestUpdateByID",
-		Args: []gopkg.DeclVar{
-			testingArg(),
-		},
-		BodyData: d,
-		BodyTmpl: `
-	now := gotest_time.SetTimeNowForTesting(t)
+	// Nullable fields are null for every third nonce (see
+	// `populateDataModelFromNonce`), so matching on null is tested with the
+	// first nullable field (other than the soft delete time, which is never
+	// populated)
+	nullTestCases := ""
+	for _, f := range modelStruct.Fields {
+		if !isNullableColumn(f) || isUniqueField(f) || isSoftDeleteField(f) {
+			continue
+		}
 
-	testCases := []struct{
-		Name string
-		ToInsert []` + dbModelType + `
-		ID int64
-		Updates map[string]any
-		Expected []` + dbModelType + `
-		ExpectErr bool
-	}{
+		nullTestCases = `
 		{
-			Name: "no updates does not error - even if ID does not exist",
+			Name: "is null on nullable field",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(3),
+				populateDataModelFromNonce(4),
+				populateDataModelFromNonce(6),
+			},
+			Conds: ` + dbcrudAlias + `.Where().` + f.Name + `IsNull(),
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(3, 2, now),
+				populateDataModelFromNonceWithIDAndTimestamp(6, 4, now),
+			},
 		},
 		{
-			Name: "when there are updates and ID not found throws error",
-			ID: 1234,
-			Updates: queryFromNonce(1),
-			ExpectErr: true,
+			Name: "is not null on nullable field",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(3),
+				populateDataModelFromNonce(4),
+				populateDataModelFromNonce(6),
+			},
+			Conds: ` + dbcrudAlias + `.Where().` + f.Name + `IsNotNull(),
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(1, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(4, 3, now),
+			},
 		},
 		{
-			Name: "when update field not in schema throws error",
-			ID: 1,
-			Updates: map[string]any{
-				"field_not_in_the_` + dbModelType + `_type": "update",
+			Name: "equal to null value selects null fields",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(3),
+				populateDataModelFromNonce(4),
+			},
+			Conds: ` + dbcrudAlias + `.Where().` + f.Name + `Eq(populateDataModelFromNonce(3).` + f.Name + `),
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(3, 2, now),
 			},
-			ExpectErr: true,
 		},
 		{
-			Name: "insert many and update one by id",
+			Name: "map query with null value selects null fields",
 			ToInsert: []` + dbModelType + `{
-				populateDataModelFromNonce(101),
-				populateDataModelFromNonce(102),
-				populateDataModelFromNonce(103),
-				populateDataModelFromNonce(104),
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(3),
+				populateDataModelFromNonce(4),
+			},
+			Query: map[string]any{
+				"` + columnName(f) + `": nil,
 			},
-			ID: 3,
-			Updates: queryFromNonce(555),
 			Expected: []` + dbModelType + `{
-				populateDataModelFromNonceWithIDAndTimestamp(101, 1, now),
-				populateDataModelFromNonceWithIDAndTimestamp(102, 2, now),
-				populateDataModelFromNonceWithIDAndTimestamp(555, 3, now),
-				populateDataModelFromNonceWithIDAndTimestamp(104, 4, now),
+				populateDataModelFromNonceWithIDAndTimestamp(3, 2, now),
 			},
-		},
-	}
-
-	for _, test := range testCases {
-		t.Run(test.Name, func(t *testing.T) {
-			db := sqltest.OpenMysql(t, "schema.sql")
-{{- if .BodyData.UseDBContext}}
-			ctx := lib.ContextWithDB(context.Background(), db)
-{{- else}}
-			ctx := context.Background()
-{{- end}}
-
-			for _, d := range test.ToInsert {
-				_, err := ` + dbcrudAlias + `.Insert(` + ctxAndDbArgs + `, d)
-				require.NoError(t, err)
-			}
-
-			err := ` + dbcrudAlias + `.UpdateByID(` + ctxAndDbArgs + `, test.ID, test.Updates)
-
-			if test.ExpectErr {
-				require.Error(t, err)
-				return
-			}
-			require.NoError(t, err)
-
-			actual, err := ` + dbcrudAlias + `.Select(` + ctxAndDbArgs + `, nil)
-			require.NoError(t, err)
-
-			require.Equal(t, len(test.Expected), len(actual))
-
-			for i := range actual {
-				assert.LogicallyEqual(t, test.Expected[i], actual[i], fmt.Sprint(i) + "th element not equal")
-			}
-		})
-	}
-`,
-	}
-}
-
-func testfuncDelete(
-	d pkgDef,
-	modelName string,
-	modelStruct gopkg.TypeStruct,
-) gopkg.DeclFunc {
-
-	dbcrudAlias := strcase.ToSnake(modelName)
-	dbModelType := d.Import.Alias + "." + modelName
-
-	ctxAndDbArgs := `ctx, db`
-	if d.UseDBContext {
-		ctxAndDbArgs = `ctx`
+		},`
+		break
 	}
 
 	return gopkg.DeclFunc{
-		Name: "TestDelete",
+		Name: "TestSelectWithQuery",
 		Args: []gopkg.DeclVar{
 			testingArg(),
 		},
-		BodyData: d,
 		BodyTmpl: `
 	now := gotest_time.SetTimeNowForTesting(t)
 
@@ -533,80 +773,189 @@ func testfuncDelete(
 		Name string
 		ToInsert []` + dbModelType + `
 		Query map[string]any
-		ExpectedNumDeleted int64
+		Conds ` + dbcrudAlias + `.Query
 		Expected []` + dbModelType + `
-		ExpectErr bool
 	}{
 		{
-			Name: "empty query deletes all records",
+			Name: "typed query selects matching records",
 			ToInsert: []` + dbModelType + `{
-				populateDataModelFromNonce(1000),
-				populateDataModelFromNonce(1001),
-				populateDataModelFromNonce(1002),
-				populateDataModelFromNonce(1003),
-				populateDataModelFromNonce(1004),
+				populateDataModelFromNonce(22),
+				populateDataModelFromNonce(45),
+				populateDataModelFromNonce(45),
+				populateDataModelFromNonce(1),
+			},
+			Conds: typedQueryFromNonce(45),
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(45, 2, now),
+				populateDataModelFromNonceWithIDAndTimestamp(45, 3, now),
 			},
-			ExpectedNumDeleted: 5,
 		},
 		{
-			Name: "delete records using query",
+			Name: "map query and typed query are combined",
 			ToInsert: []` + dbModelType + `{
-				populateDataModelFromNonce(1000),
-				populateDataModelFromNonce(1001),
-				populateDataModelFromNonce(1002),
-				populateDataModelFromNonce(1002),
-				populateDataModelFromNonce(1003),
-				populateDataModelFromNonce(1004),
-				populateDataModelFromNonce(1002),
+				populateDataModelFromNonce(45),
+				populateDataModelFromNonce(45),
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(45),
 			},
-			Query: queryFromNonce(1002),
-			ExpectedNumDeleted: 3,
+			Query: queryFromNonce(45),
+			Conds: ` + dbcrudAlias + `.Where().IDGt(1),
 			Expected: []` + dbModelType + `{
-				populateDataModelFromNonceWithIDAndTimestamp(1000, 1, now),
-				populateDataModelFromNonceWithIDAndTimestamp(1001, 2, now),
-				populateDataModelFromNonceWithIDAndTimestamp(1003, 5, now),
-				populateDataModelFromNonceWithIDAndTimestamp(1004, 6, now),
+				populateDataModelFromNonceWithIDAndTimestamp(45, 2, now),
+				populateDataModelFromNonceWithIDAndTimestamp(45, 4, now),
 			},
 		},
 		{
-			Name: "when query contains field not in data model returns error",
-			Query: map[string]any{
-				"some_field_not_in_` + modelName + `": 1,
+			Name: "not equal",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(2),
+				populateDataModelFromNonce(3),
+			},
+			Conds: ` + dbcrudAlias + `.Where().IDNe(2),
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(1, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(3, 3, now),
+			},
+		},
+		{
+			Name: "greater than and less than",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(2),
+				populateDataModelFromNonce(3),
+				populateDataModelFromNonce(4),
+				populateDataModelFromNonce(5),
+			},
+			Conds: ` + dbcrudAlias + `.Where().IDGt(1).IDLt(4),
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(2, 2, now),
+				populateDataModelFromNonceWithIDAndTimestamp(3, 3, now),
+			},
+		},
+		{
+			Name: "greater or equal and less or equal",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(2),
+				populateDataModelFromNonce(3),
+				populateDataModelFromNonce(4),
+				populateDataModelFromNonce(5),
+			},
+			Conds: ` + dbcrudAlias + `.Where().IDGe(2).IDLe(4),
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(2, 2, now),
+				populateDataModelFromNonceWithIDAndTimestamp(3, 3, now),
+				populateDataModelFromNonceWithIDAndTimestamp(4, 4, now),
+			},
+		},
+		{
+			Name: "in list of values",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(2),
+				populateDataModelFromNonce(3),
+				populateDataModelFromNonce(4),
+				populateDataModelFromNonce(5),
+			},
+			Conds: ` + dbcrudAlias + `.Where().IDIn(1, 3, 5),
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(1, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(3, 3, now),
+				populateDataModelFromNonceWithIDAndTimestamp(5, 5, now),
+			},
+		},
+		{
+			Name: "in empty list of values selects nothing",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(2),
+			},
+			Conds: ` + dbcrudAlias + `.Where().IDIn(),
+		},
+		{
+			Name: "is null on non null field selects nothing",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(2),
+			},
+			Conds: ` + dbcrudAlias + `.Query{lib.Cond{Column: "id", Op: lib.OpIsNull}},
+		},
+		{
+			Name: "is not null on non null field selects everything",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(2),
+			},
+			Conds: ` + dbcrudAlias + `.Query{lib.Cond{Column: "id", Op: lib.OpIsNotNull}},
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(1, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(2, 2, now),
+			},
+		},
+		{
+			Name: "or of queries",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(2),
+				populateDataModelFromNonce(3),
+				populateDataModelFromNonce(4),
+				populateDataModelFromNonce(5),
+			},
+			Conds: ` + dbcrudAlias + `.Where().Or(
+				` + dbcrudAlias + `.Where().IDEq(1),
+				` + dbcrudAlias + `.Where().IDGt(3),
+			),
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(1, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(4, 4, now),
+				populateDataModelFromNonceWithIDAndTimestamp(5, 5, now),
+			},
+		},
+		{
+			Name: "or combined with other conditions",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(2),
+				populateDataModelFromNonce(3),
+				populateDataModelFromNonce(4),
+				populateDataModelFromNonce(5),
+			},
+			Conds: ` + dbcrudAlias + `.Where().IDNe(5).Or(
+				` + dbcrudAlias + `.Where().IDEq(1),
+				` + dbcrudAlias + `.Where().IDGt(3),
+			),
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(1, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(4, 4, now),
 			},
-			ExpectErr: true,
 		},
+		{
+			Name: "or with no alternatives selects nothing",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(2),
+			},
+			Conds: ` + dbcrudAlias + `.Where().Or(),
+		},` + likeTestCase + nullTestCases + `
 	}
 
 	for _, test := range testCases {
 		t.Run(test.Name, func(t *testing.T) {
-			db := sqltest.OpenMysql(t, "schema.sql")
-{{- if .BodyData.UseDBContext}}
-			ctx := lib.ContextWithDB(context.Background(), db)
-{{- else}}
-			ctx := context.Background()
-{{- end}}
+			ctx, repo := openRepository(t)
 
 			for _, d := range test.ToInsert {
-				_, err := ` + dbcrudAlias + `.Insert(` + ctxAndDbArgs + `, d)
+				_, err := repo.Insert(ctx, d)
 				require.NoError(t, err)
 			}
 
-			numDeleted, err := ` + dbcrudAlias + `.Delete(` + ctxAndDbArgs + `, test.Query)
-			if test.ExpectErr {
-				require.Error(t, err)
-				return
-			}
-			require.NoError(t, err)
-
-			require.Equal(t, test.ExpectedNumDeleted, numDeleted)
-
-			actual, err := ` + dbcrudAlias + `.Select(` + ctxAndDbArgs + `, nil)
+			actual, err := repo.Select(ctx, test.Query, test.Conds...)
 			require.NoError(t, err)
 
 			require.Equal(t, len(test.Expected), len(actual))
 
 			for i := range actual {
-				assert.LogicallyEqual(t, test.Expected[i], actual[i], fmt.Sprint(i) + "th element not equal")
+				` + assertModelsEqualCode(modelStruct, "test.Expected[i]", "actual[i]", `fmt.Sprint(i) + "th element not equal"`) + `
 			}
 		})
 	}
@@ -614,210 +963,3778 @@ func testfuncDelete(
 	}
 }
 
-func testfuncDeleteByID(
+func testfuncSelectPage(
 	d pkgDef,
 	modelName string,
 	modelStruct gopkg.TypeStruct,
 ) gopkg.DeclFunc {
 
-	dbcrudAlias := strcase.ToSnake(modelName)
 	dbModelType := d.Import.Alias + "." + modelName
 
-	ctxAndDbArgs := `ctx, db`
-	if d.UseDBContext {
-		ctxAndDbArgs = `ctx`
+	// Ordering by multiple columns needs a column with repeated values, so
+	// the test is only generated if the model has a (non ID) int64 field
+	multiOrderTestCase := ""
+	for _, f := range modelStruct.Fields {
+		if _, ok := f.Type.(gopkg.TypeInt64); !ok || f.Name == "ID" || isUniqueField(f) || isForeignKeyField(f) {
+			continue
+		}
+
+		multiOrderTestCase = `
+		{
+			Name: "order by multiple columns",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(2),
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(2),
+				populateDataModelFromNonce(1),
+			},
+			Options: lib.SelectOptions{
+				OrderBy: []lib.OrderBy{
+					{Column: "` + columnName(f) + `"},
+					{Column: "id", Direction: lib.Desc},
+				},
+			},
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(1, 4, now),
+				populateDataModelFromNonceWithIDAndTimestamp(1, 2, now),
+				populateDataModelFromNonceWithIDAndTimestamp(2, 3, now),
+				populateDataModelFromNonceWithIDAndTimestamp(2, 1, now),
+			},
+		},`
+		break
 	}
 
 	return gopkg.DeclFunc{
-		Name: "TestDeleteByID",
+		Name: "TestSelectPage",
 		Args: []gopkg.DeclVar{
 			testingArg(),
 		},
-		BodyData: d,
 		BodyTmpl: `
 	now := gotest_time.SetTimeNowForTesting(t)
 
 	testCases := []struct{
 		Name string
 		ToInsert []` + dbModelType + `
-		ID int64
+		Options lib.SelectOptions
+		Query map[string]any
 		Expected []` + dbModelType + `
 		ExpectErr bool
 	}{
 		{
-			Name: "when ID not found returns error",
-			ExpectErr: true,
-		},
-		{
-			Name: "insert many and delete by ID",
+			Name: "default options select all records ordered by id",
 			ToInsert: []` + dbModelType + `{
-				populateDataModelFromNonce(101),
-				populateDataModelFromNonce(102),
-				populateDataModelFromNonce(103),
-				populateDataModelFromNonce(104),
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(2),
+				populateDataModelFromNonce(3),
 			},
-			ID: 3,
 			Expected: []` + dbModelType + `{
-				populateDataModelFromNonceWithIDAndTimestamp(101, 1, now),
-				populateDataModelFromNonceWithIDAndTimestamp(102, 2, now),
-				populateDataModelFromNonceWithIDAndTimestamp(104, 4, now),
+				populateDataModelFromNonceWithIDAndTimestamp(1, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(2, 2, now),
+				populateDataModelFromNonceWithIDAndTimestamp(3, 3, now),
+			},
+		},
+		{
+			Name: "limit",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(2),
+				populateDataModelFromNonce(3),
+				populateDataModelFromNonce(4),
+			},
+			Options: lib.SelectOptions{
+				Limit: 2,
+			},
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(1, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(2, 2, now),
+			},
+		},
+		{
+			Name: "limit and offset",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(2),
+				populateDataModelFromNonce(3),
+				populateDataModelFromNonce(4),
+			},
+			Options: lib.SelectOptions{
+				Limit: 2,
+				Offset: 1,
+			},
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(2, 2, now),
+				populateDataModelFromNonceWithIDAndTimestamp(3, 3, now),
+			},
+		},
+		{
+			Name: "offset without limit",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(2),
+				populateDataModelFromNonce(3),
+				populateDataModelFromNonce(4),
+			},
+			Options: lib.SelectOptions{
+				Offset: 2,
+			},
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(3, 3, now),
+				populateDataModelFromNonceWithIDAndTimestamp(4, 4, now),
+			},
+		},
+		{
+			Name: "order by id descending",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(2),
+				populateDataModelFromNonce(3),
+			},
+			Options: lib.SelectOptions{
+				OrderBy: []lib.OrderBy{
+					{Column: "id", Direction: lib.Desc},
+				},
+			},
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(3, 3, now),
+				populateDataModelFromNonceWithIDAndTimestamp(2, 2, now),
+				populateDataModelFromNonceWithIDAndTimestamp(1, 1, now),
+			},
+		},` + multiOrderTestCase + `
+		{
+			Name: "after ID",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(2),
+				populateDataModelFromNonce(3),
+				populateDataModelFromNonce(4),
+				populateDataModelFromNonce(5),
+			},
+			Options: lib.SelectOptions{
+				Limit: 2,
+				AfterID: 2,
+			},
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(3, 3, now),
+				populateDataModelFromNonceWithIDAndTimestamp(4, 4, now),
+			},
+		},
+		{
+			Name: "after ID with query",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(7),
+				populateDataModelFromNonce(8),
+				populateDataModelFromNonce(7),
+				populateDataModelFromNonce(8),
+				populateDataModelFromNonce(7),
+			},
+			Options: lib.SelectOptions{
+				AfterID: 1,
+			},
+			Query: queryFromNonce(7),
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(7, 3, now),
+				populateDataModelFromNonceWithIDAndTimestamp(7, 5, now),
+			},
+		},
+		{
+			Name: "after ID ordered by other than id ascending returns error",
+			Options: lib.SelectOptions{
+				OrderBy: []lib.OrderBy{
+					{Column: "id", Direction: lib.Desc},
+				},
+				AfterID: 2,
+			},
+			ExpectErr: true,
+		},
+		{
+			Name: "after primary key of model with id returns error",
+			Options: lib.SelectOptions{
+				AfterPK: int64(2),
+			},
+			ExpectErr: true,
+		},
+		{
+			Name: "order by field which is not in data model returns error",
+			Options: lib.SelectOptions{
+				OrderBy: []lib.OrderBy{
+					{Column: "some_field_not_in_` + modelName + `"},
+				},
+			},
+			ExpectErr: true,
+		},
+		{
+			Name: "unknown order direction returns error",
+			Options: lib.SelectOptions{
+				OrderBy: []lib.OrderBy{
+					{Column: "id", Direction: "sideways"},
+				},
+			},
+			ExpectErr: true,
+		},
+		{
+			Name: "negative limit returns error",
+			Options: lib.SelectOptions{
+				Limit: -1,
 			},
+			ExpectErr: true,
 		},
 	}
 
 	for _, test := range testCases {
 		t.Run(test.Name, func(t *testing.T) {
-			db := sqltest.OpenMysql(t, "schema.sql")
-{{- if .BodyData.UseDBContext}}
-			ctx := lib.ContextWithDB(context.Background(), db)
-{{- else}}
-			ctx := context.Background()
-{{- end}}
+			ctx, repo := openRepository(t)
 
 			for _, d := range test.ToInsert {
-				_, err := ` + dbcrudAlias + `.Insert(` + ctxAndDbArgs + `, d)
+				_, err := repo.Insert(ctx, d)
 				require.NoError(t, err)
 			}
 
-			err := ` + dbcrudAlias + `.DeleteByID(` + ctxAndDbArgs + `, test.ID)
+			actual, err := repo.SelectPage(ctx, test.Options, test.Query)
+			if test.ExpectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			require.Equal(t, len(test.Expected), len(actual))
+
+			for i := range actual {
+				` + assertModelsEqualCode(modelStruct, "test.Expected[i]", "actual[i]", `fmt.Sprint(i) + "th element not equal"`) + `
+			}
+		})
+	}
+`,
+	}
+}
+
+func testfuncSelectMaxRows(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) gopkg.DeclFunc {
+
+	generatedMaxTestCases := ""
+	if maxRows := d.maxRows(modelName); maxRows != unlimitedRows {
+		maxRowsStr := strconv.FormatInt(maxRows, 10)
+		generatedMaxTestCases = `
+		{
+			Name: "select up to generated max rows",
+			NumToInsert: ` + maxRowsStr + `,
+			ExpectedLen: ` + maxRowsStr + `,
+		},
+		{
+			Name: "select more than generated max rows returns error",
+			NumToInsert: ` + maxRowsStr + ` + 1,
+			ExpectErr: true,
+		},`
+	}
+
+	return gopkg.DeclFunc{
+		Name: "TestSelectMaxRows",
+		Args: []gopkg.DeclVar{
+			testingArg(),
+		},
+		BodyTmpl: `
+	testCases := []struct{
+		Name string
+		NumToInsert int
+		Options lib.SelectOptions
+		ExpectedLen int
+		ExpectErr bool
+	}{` + generatedMaxTestCases + `
+		{
+			Name: "select up to max rows set in options",
+			NumToInsert: 3,
+			Options: lib.SelectOptions{
+				MaxRows: 3,
+			},
+			ExpectedLen: 3,
+		},
+		{
+			Name: "select more than max rows set in options returns error",
+			NumToInsert: 3,
+			Options: lib.SelectOptions{
+				MaxRows: 2,
+			},
+			ExpectErr: true,
+		},
+		{
+			Name: "limit below max rows set in options",
+			NumToInsert: 3,
+			Options: lib.SelectOptions{
+				Limit: 2,
+				MaxRows: 2,
+			},
+			ExpectedLen: 2,
+		},
+		{
+			Name: "unlimited max rows set in options",
+			NumToInsert: 3,
+			Options: lib.SelectOptions{
+				MaxRows: lib.UnlimitedRows,
+			},
+			ExpectedLen: 3,
+		},
+		{
+			Name: "negative max rows set in options returns error",
+			Options: lib.SelectOptions{
+				MaxRows: -2,
+			},
+			ExpectErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			ctx, repo := openRepository(t)
+
+			for i := 0; i < test.NumToInsert; i++ {
+				_, err := repo.Insert(ctx, populateDataModelFromNonce(int64(i)))
+				require.NoError(t, err)
+			}
 
+			actual, err := repo.SelectPage(ctx, test.Options, nil)
 			if test.ExpectErr {
 				require.Error(t, err)
 				return
 			}
 			require.NoError(t, err)
 
-			actual, err := ` + dbcrudAlias + `.Select(` + ctxAndDbArgs + `, nil)
-			require.NoError(t, err)
+			require.Equal(t, test.ExpectedLen, len(actual))
+		})
+	}
+`,
+	}
+}
+
+func testfuncForEach(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) gopkg.DeclFunc {
+
+	dbcrudAlias := strcase.ToSnake(modelName)
+	dbModelType := d.Import.Alias + "." + modelName
+
+	return gopkg.DeclFunc{
+		Name: "TestForEach",
+		Args: []gopkg.DeclVar{
+			testingArg(),
+		},
+		BodyTmpl: `
+	now := gotest_time.SetTimeNowForTesting(t)
+
+	testCases := []struct{
+		Name string
+		ToInsert []` + dbModelType + `
+		Query map[string]any
+		Conds ` + dbcrudAlias + `.Query
+		StopAfter int
+		ErrAfter int
+		Expected []` + dbModelType + `
+		ExpectErr bool
+	}{
+		{
+			Name: "iterates over nothing when nothing inserted",
+		},
+		{
+			Name: "iterates over all records in id order",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(11),
+				populateDataModelFromNonce(21),
+				populateDataModelFromNonce(31),
+			},
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(11, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(21, 2, now),
+				populateDataModelFromNonceWithIDAndTimestamp(31, 3, now),
+			},
+		},
+		{
+			Name: "iterates over records matching query",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(45),
+				populateDataModelFromNonce(22),
+				populateDataModelFromNonce(45),
+				populateDataModelFromNonce(45),
+			},
+			Query: queryFromNonce(45),
+			Conds: ` + dbcrudAlias + `.Where().IDGt(1),
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(45, 3, now),
+				populateDataModelFromNonceWithIDAndTimestamp(45, 4, now),
+			},
+		},
+		{
+			Name: "stop iteration ends iterating early without error",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(11),
+				populateDataModelFromNonce(21),
+				populateDataModelFromNonce(31),
+			},
+			StopAfter: 2,
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(11, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(21, 2, now),
+			},
+		},
+		{
+			Name: "error from func ends iterating and is returned",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(11),
+				populateDataModelFromNonce(21),
+				populateDataModelFromNonce(31),
+			},
+			ErrAfter: 1,
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(11, 1, now),
+			},
+			ExpectErr: true,
+		},
+		{
+			Name: "query field which is not in data model returns error",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+			},
+			Query: map[string]any{
+				"some_field_not_in_` + modelName + `": 1,
+			},
+			ExpectErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			ctx, repo := openRepository(t)
+
+			for _, d := range test.ToInsert {
+				_, err := repo.Insert(ctx, d)
+				require.NoError(t, err)
+			}
+
+			var actual []` + dbModelType + `
+			err := repo.ForEach(
+				ctx,
+				test.Query,
+				func(d ` + dbModelType + `) error {
+					actual = append(actual, d)
+					if len(actual) == test.StopAfter {
+						return lib.ErrStopIteration
+					}
+					if len(actual) == test.ErrAfter {
+						return errors.New("some error")
+					}
+					return nil
+				},
+				test.Conds...,
+			)
+			if test.ExpectErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			require.Equal(t, len(test.Expected), len(actual))
+
+			for i := range actual {
+				` + assertModelsEqualCode(modelStruct, "test.Expected[i]", "actual[i]", `fmt.Sprint(i) + "th element not equal"`) + `
+			}
+		})
+	}
+`,
+	}
+}
+
+func testfuncSelectByID(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) gopkg.DeclFunc {
+
+	dbModelType := d.Import.Alias + "." + modelName
+
+	return gopkg.DeclFunc{
+		Name: "TestSelectByID",
+		Args: []gopkg.DeclVar{
+			testingArg(),
+		},
+		BodyTmpl: `
+	now := gotest_time.SetTimeNowForTesting(t)
+
+	testCases := []struct{
+		Name string
+		ToInsert []` + dbModelType + `
+		ID int64
+		Expected ` + dbModelType + `
+		ExpectErr bool
+	}{
+		{
+			Name: "when ID not found returns error",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(100),
+				populateDataModelFromNonce(200),
+			},
+			ID: 12345,
+			ExpectErr: true,
+		},
+		{
+			Name: "when ID is found returns row",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(100),
+				populateDataModelFromNonce(200),
+				populateDataModelFromNonce(300),
+			},
+			ID: 2,
+			Expected: populateDataModelFromNonceWithIDAndTimestamp(200, 2, now),
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			ctx, repo := openRepository(t)
+
+			for _, d := range test.ToInsert {
+				_, err := repo.Insert(ctx, d)
+				require.NoError(t, err)
+			}
+
+			actual, err := repo.SelectByID(ctx, test.ID)
+			if test.ExpectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			` + assertModelsEqualCode(modelStruct, "test.Expected", "actual") + `
+		})
+	}
+`,
+	}
+}
+
+// testfuncSelectByKeys returns a test for the `SelectBy<Fields>` method of
+// each unique key of the model
+func testfuncSelectByKeys(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+	keys []tableKey,
+) []gopkg.DeclFunc {
+
+	dbModelType := d.Import.Alias + "." + modelName
+
+	tests := make([]gopkg.DeclFunc, 0, len(keys))
+	for _, k := range keys {
+		methodName := "SelectBy" + strings.Join(k.Fields, "And")
+
+		keyArgs := make([]string, 0, len(k.Fields))
+		for _, field := range k.Fields {
+			keyArgs = append(keyArgs, "keys." + field)
+		}
+
+		tests = append(tests, gopkg.DeclFunc{
+			Name: "Test" + methodName,
+			Args: []gopkg.DeclVar{
+				testingArg(),
+			},
+			BodyTmpl: `
+	now := gotest_time.SetTimeNowForTesting(t)
+
+	testCases := []struct{
+		Name string
+		ToInsert []` + dbModelType + `
+		// Select is the index of the inserted row to select the key of, or
+		// -1 to select a key which was not inserted
+		Select int
+		Expected ` + dbModelType + `
+		ExpectErr bool
+	}{
+		{
+			Name: "when key not found returns error",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(100),
+				populateDataModelFromNonce(200),
+			},
+			Select: -1,
+			ExpectErr: true,
+		},
+		{
+			Name: "when key is found returns row",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(100),
+				populateDataModelFromNonce(200),
+				populateDataModelFromNonce(300),
+			},
+			Select: 1,
+			Expected: populateDataModelFromNonceWithIDAndTimestamp(200, 2, now),
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			ctx, repo := openRepository(t)
+
+			for _, d := range test.ToInsert {
+				_, err := repo.Insert(ctx, d)
+				require.NoError(t, err)
+			}
+
+			keys := populateDataModelFromNonce(400)
+			if test.Select >= 0 {
+				keys = test.ToInsert[test.Select]
+			}
+
+			actual, err := repo.` + methodName + `(ctx, ` + strings.Join(keyArgs, ", ") + `)
+			if test.ExpectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			` + assertModelsEqualCode(modelStruct, "test.Expected", "actual") + `
+			assert.LogicallyEqual(t, keys, withUniqueFieldsOf(keys, actual), "keys of selected row not equal")
+		})
+	}
+`,
+		})
+	}
+
+	return tests
+}
+
+// testfuncSelectWith returns a test for the `SelectWith<Parent>` method of
+// each foreign key of the model
+func testfuncSelectWith(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) []gopkg.DeclFunc {
+
+	keys, err := foreignKeys(modelStruct)
+	if err != nil {
+		return nil
+	}
+
+	dbcrudAlias := strcase.ToSnake(modelName)
+	dbModelType := d.Import.Alias + "." + modelName
+
+	tests := make([]gopkg.DeclFunc, 0, len(keys))
+	for _, k := range keys {
+		if k.Model == modelName {
+			test, err := testfuncSelectWithSelfReference(d, modelName, modelStruct, k)
+			if err != nil {
+				return nil
+			}
+
+			tests = append(tests, test)
+			continue
+		}
+
+		// Nullable foreign keys are null for every third nonce, and so the
+		// nonces are chosen so that every row references the parent row
+		// (with id 1) which the repositories are opened with
+		tests = append(tests, gopkg.DeclFunc{
+			Name: "TestSelectWith" + k.Name(),
+			Args: []gopkg.DeclVar{
+				testingArg(),
+			},
+			BodyTmpl: `
+	now := gotest_time.SetTimeNowForTesting(t)
+
+	testCases := []struct{
+		Name string
+		ToInsert []` + dbModelType + `
+		Query map[string]any
+		Conds ` + dbcrudAlias + `.Query
+		Expected []` + dbModelType + `
+	}{
+		{
+			Name: "when no rows returns empty",
+		},
+		{
+			Name: "selects all rows with the referenced row",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(2),
+				populateDataModelFromNonce(4),
+			},
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(1, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(2, 2, now),
+				populateDataModelFromNonceWithIDAndTimestamp(4, 3, now),
+			},
+		},
+		{
+			Name: "typed query selects matching rows with the referenced row",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(2),
+				populateDataModelFromNonce(4),
+				populateDataModelFromNonce(5),
+			},
+			Conds: ` + dbcrudAlias + `.Where().IDGt(2),
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(4, 3, now),
+				populateDataModelFromNonceWithIDAndTimestamp(5, 4, now),
+			},
+		},
+		{
+			Name: "map query selects matching rows with the referenced row",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(1),
+				populateDataModelFromNonce(2),
+				populateDataModelFromNonce(4),
+			},
+			Query: map[string]any{
+				"id": 2,
+			},
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(2, 2, now),
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			ctx, repo := openRepository(t)
+
+			for _, d := range test.ToInsert {
+				_, err := repo.Insert(ctx, d)
+				require.NoError(t, err)
+			}
+
+			actual, err := repo.SelectWith` + k.Name() + `(ctx, test.Query, test.Conds...)
+			require.NoError(t, err)
+
+			require.Equal(t, len(test.Expected), len(actual))
+			for i := range test.Expected {
+				` + assertModelsEqualCode(modelStruct, "test.Expected[i]", "actual[i]." + modelName) + `
+				require.Equal(t, int64(1), actual[i].` + k.Name() + `.ID)
+				assert.LogicallyEqual(t, actual[0].` + k.Name() + `, actual[i].` + k.Name() + `)
+			}
+		})
+	}
+`,
+		})
+	}
+
+	return tests
+}
+
+// testfuncSelectWithSelfReference returns the test for the `SelectWith<Parent>`
+// method of a foreign key which references the model itself, which is left
+// null by the test helpers and so is set on a row which references another
+func testfuncSelectWithSelfReference(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+	k foreignKey,
+) (gopkg.DeclFunc, error) {
+
+	var parentID nullableTestField
+	for _, f := range modelStruct.Fields {
+		if f.Name != k.Field {
+			continue
+		}
+
+		var err error
+		parentID, err = makeNullableTestField(f, d.PkgTypes, "parentID")
+		if err != nil {
+			return gopkg.DeclFunc{}, err
+		}
+		parentID.Value = "parentID"
+	}
+
+	return gopkg.DeclFunc{
+		Name: "TestSelectWith" + k.Name(),
+		Args: []gopkg.DeclVar{
+			testingArg(),
+		},
+		BodyTmpl: `
+	ctx, repo := openRepository(t)
+
+	parentID, err := repo.Insert(ctx, populateDataModelFromNonce(1))
+	require.NoError(t, err)
+
+	d := populateDataModelFromNonce(2)
+` + parentID.AssignCode("\t") + `
+	childID, err := repo.Insert(ctx, d)
+	require.NoError(t, err)
+
+	// The parent row references no row, and so is left out by the join
+	actual, err := repo.SelectWith` + k.Name() + `(ctx, nil)
+	require.NoError(t, err)
+
+	require.Equal(t, 1, len(actual))
+	require.Equal(t, childID, actual[0].` + modelName + `.ID)
+	require.Equal(t, parentID, actual[0].` + k.Name() + `.ID)
+`,
+	}, nil
+}
+
+// testfuncSelectWithMaxRows returns a test for the max rows of the
+// `SelectWith<Parent>` method of each nullable foreign key of the model, and
+// of each key which references a model with soft deletes, in which rows which
+// are left out by the join (as they reference no row, or a soft deleted row)
+// are inserted before those which are not
+func testfuncSelectWithMaxRows(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) []gopkg.DeclFunc {
+
+	maxRows := d.maxRows(modelName)
+	if maxRows == unlimitedRows {
+		return nil
+	}
+
+	keys, err := foreignKeys(modelStruct)
+	if err != nil {
+		return nil
+	}
+
+	maxRowsStr := strconv.FormatInt(maxRows, 10)
+
+	var tests []gopkg.DeclFunc
+	for _, k := range keys {
+		if k.Model == modelName {
+			continue
+		}
+
+		var parentStruct gopkg.TypeStruct
+		for _, m := range d.DBDataModels {
+			if m.Name == k.Model {
+				parentStruct, _ = m.Type.(gopkg.TypeStruct)
+			}
+		}
+
+		var field gopkg.DeclVar
+		for _, f := range modelStruct.Fields {
+			if f.Name == k.Field {
+				field = f
+			}
+		}
+
+		// Rows reference the soft deleted row (with id 2) of parents with
+		// soft deletes, or otherwise no row if the key is nullable, as
+		// nullable fields are null for every third nonce
+		unmatchedCode := `
+		_, err := repo.Insert(ctx, populateDataModelFromNonce(3*i))
+		require.NoError(t, err)`
+		if _, ok := softDeleteField(parentStruct); ok && !hasCustomPrimaryKey(parentStruct) {
+			assign := "\t\td." + field.Name + " = 2"
+			if _, ok := nullableValueType(field.Type); ok {
+				nullable, err := makeNullableTestField(field, d.PkgTypes, "2")
+				if err != nil {
+					return nil
+				}
+				nullable.Value = "2"
+				assign = nullable.AssignCode("\t\t")
+			}
+
+			unmatchedCode = `
+		d := populateDataModelFromNonce(3*i)
+` + assign + `
+		_, err := repo.Insert(ctx, d)
+		require.NoError(t, err)`
+		} else if !isNullableColumn(field) {
+			continue
+		}
+
+		tests = append(tests, gopkg.DeclFunc{
+			Name: "TestSelectWith" + k.Name() + "MaxRows",
+			Args: []gopkg.DeclVar{
+				testingArg(),
+			},
+			BodyTmpl: `
+	ctx, repo := openRepository(t)
+
+	for i := int64(1); i <= ` + maxRowsStr + ` + 1; i++ {` + unmatchedCode + `
+	}
+
+	for _, nonce := range []int64{1, 2} {
+		_, err := repo.Insert(ctx, populateDataModelFromNonce(nonce))
+		require.NoError(t, err)
+	}
+
+	actual, err := repo.SelectWith` + k.Name() + `(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(actual))
+
+	for i := int64(1); i <= ` + maxRowsStr + ` - 1; i++ {
+		_, err := repo.Insert(ctx, populateDataModelFromNonce(3*i+1))
+		require.NoError(t, err)
+	}
+
+	_, err = repo.SelectWith` + k.Name() + `(ctx, nil)
+	require.ErrorIs(t, err, lib.ErrTooManyRows)
+`,
+		})
+	}
+
+	return tests
+}
+
+func testfuncUpdate(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) gopkg.DeclFunc {
+
+	dbcrudAlias := strcase.ToSnake(modelName)
+	dbModelType := d.Import.Alias + "." + modelName
+
+	return gopkg.DeclFunc{
+		Name: "TestUpdate",
+		Args: []gopkg.DeclVar{
+			testingArg(),
+		},
+		BodyTmpl: `
+	now := gotest_time.SetTimeNowForTesting(t)
+
+	testCases := []struct{
+		Name string
+		ToInsert []` + dbModelType + `
+		Updates map[string]any
+		Query map[string]any
+		Conds ` + dbcrudAlias + `.Query
+		ExpectedNumUpdates int64
+		Expected []` + dbModelType + `
+		ExpectErr bool
+	}{
+		{
+			Name: "empty params does nothing",
+		},
+		{
+			Name: "update unknown field throws error",
+			Updates: map[string]any{
+				"field_not_in_the_` + dbModelType + `_type": "update",
+			},
+			ExpectErr: true,
+		},
+		{
+			Name: "query unknown field throws error",
+			Updates: queryFromNonce(1),
+			Query: map[string]any{
+				"field_not_in_` + modelName + `": "update",
+			},
+			ExpectErr: true,
+		},
+		{
+			Name: "update all records",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(123),
+				populateDataModelFromNonce(124),
+				populateDataModelFromNonce(125),
+				populateDataModelFromNonce(126),
+			},
+			Updates: queryFromNonce(111),
+			ExpectedNumUpdates: 4,
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(111, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(111, 2, now),
+				populateDataModelFromNonceWithIDAndTimestamp(111, 3, now),
+				populateDataModelFromNonceWithIDAndTimestamp(111, 4, now),
+			},
+		},
+		{
+			Name: "update records with query",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(123),
+				populateDataModelFromNonce(125),
+				populateDataModelFromNonce(124),
+				populateDataModelFromNonce(125),
+				populateDataModelFromNonce(126),
+				populateDataModelFromNonce(125),
+			},
+			Updates: queryFromNonce(999),
+			Query: queryFromNonce(125),
+			ExpectedNumUpdates: 3,
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(123, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(999, 2, now),
+				populateDataModelFromNonceWithIDAndTimestamp(124, 3, now),
+				populateDataModelFromNonceWithIDAndTimestamp(999, 4, now),
+				populateDataModelFromNonceWithIDAndTimestamp(126, 5, now),
+				populateDataModelFromNonceWithIDAndTimestamp(999, 6, now),
+			},
+		},
+		{
+			Name: "update records with typed query",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(123),
+				populateDataModelFromNonce(124),
+				populateDataModelFromNonce(125),
+				populateDataModelFromNonce(126),
+			},
+			Updates: queryFromNonce(999),
+			Conds: ` + dbcrudAlias + `.Where().IDGt(2),
+			ExpectedNumUpdates: 2,
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(123, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(124, 2, now),
+				populateDataModelFromNonceWithIDAndTimestamp(999, 3, now),
+				populateDataModelFromNonceWithIDAndTimestamp(999, 4, now),
+			},
+		},
+		{
+			Name: "update records with or query",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(123),
+				populateDataModelFromNonce(124),
+				populateDataModelFromNonce(125),
+				populateDataModelFromNonce(126),
+			},
+			Updates: queryFromNonce(999),
+			Conds: ` + dbcrudAlias + `.Where().Or(
+				` + dbcrudAlias + `.Where().IDEq(1),
+				` + dbcrudAlias + `.Where().IDEq(3),
+			),
+			ExpectedNumUpdates: 2,
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(999, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(124, 2, now),
+				populateDataModelFromNonceWithIDAndTimestamp(999, 3, now),
+				populateDataModelFromNonceWithIDAndTimestamp(126, 4, now),
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			ctx, repo := openRepository(t)
+
+			for _, d := range test.ToInsert {
+				_, err := repo.Insert(ctx, d)
+				require.NoError(t, err)
+			}
+
+			numUpdates, err := repo.Update(ctx, test.Updates, test.Query, test.Conds...)
+			if test.ExpectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			require.Equal(t, test.ExpectedNumUpdates, numUpdates)
+
+			actual, err := repo.Select(ctx, nil)
+			require.NoError(t, err)
+
+			require.Equal(t, len(test.Expected), len(actual))
+
+			for i := range actual {
+				` + assertModelsEqualCode(modelStruct, "test.Expected[i]", "actual[i]", `fmt.Sprint(i) + "th element not equal"`) + `
+			}
+		})
+	}
+`,
+	}
+}
+
+func testfuncUpdateByID(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) gopkg.DeclFunc {
+
+	dbModelType := d.Import.Alias + "." + modelName
+
+	return gopkg.DeclFunc{
+		Name: "TestUpdateByID",
+		Args: []gopkg.DeclVar{
+			testingArg(),
+		},
+		BodyTmpl: `
+	now := gotest_time.SetTimeNowForTesting(t)
+
+	testCases := []struct{
+		Name string
+		ToInsert []` + dbModelType + `
+		ID int64
+		Updates map[string]any
+		Expected []` + dbModelType + `
+		ExpectErr bool
+	}{
+		{
+			Name: "no updates does not error - even if ID does not exist",
+		},
+		{
+			Name: "when there are updates and ID not found throws error",
+			ID: 1234,
+			Updates: queryFromNonce(1),
+			ExpectErr: true,
+		},
+		{
+			Name: "when update field not in schema throws error",
+			ID: 1,
+			Updates: map[string]any{
+				"field_not_in_the_` + dbModelType + `_type": "update",
+			},
+			ExpectErr: true,
+		},
+		{
+			Name: "insert many and update one by id",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(101),
+				populateDataModelFromNonce(102),
+				populateDataModelFromNonce(103),
+				populateDataModelFromNonce(104),
+			},
+			ID: 3,
+			Updates: queryFromNonce(555),
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(101, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(102, 2, now),
+				populateDataModelFromNonceWithIDAndTimestamp(555, 3, now),
+				populateDataModelFromNonceWithIDAndTimestamp(104, 4, now),
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			ctx, repo := openRepository(t)
+
+			for _, d := range test.ToInsert {
+				_, err := repo.Insert(ctx, d)
+				require.NoError(t, err)
+			}
+
+			err := repo.UpdateByID(ctx, test.ID` + versionArgCode(modelStruct, "0") + `, test.Updates)
+
+			if test.ExpectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			actual, err := repo.Select(ctx, nil)
+			require.NoError(t, err)
+
+			require.Equal(t, len(test.Expected), len(actual))
+
+			for i := range actual {
+				` + assertModelsEqualCode(modelStruct, "test.Expected[i]", "actual[i]", `fmt.Sprint(i) + "th element not equal"`) + `
+			}
+		})
+	}
+`,
+	}
+}
+
+// testfuncUpdateConflicts returns a test that updating a row by its key at a
+// version which is no longer current (as another update has been made since
+// the row was read) returns `lib.ErrConcurrentModification`, if the model has
+// a version
+func testfuncUpdateConflicts(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) []gopkg.DeclFunc {
+
+	f, ok := versionField(modelStruct)
+	if !ok {
+		return nil
+	}
+
+	byKey := "ByID"
+	insertCode := `
+	d.ID, err = repo.Insert(ctx, d)
+	require.NoError(t, err)
+`
+	missingCode := `
+	missing := populateDataModelFromNonce(2)
+	missing.ID = d.ID + 1
+`
+	if hasCustomPrimaryKey(modelStruct) {
+		byKey = "ByPK"
+		insertCode = `
+	_, err = repo.Insert(ctx, d)
+	require.NoError(t, err)
+`
+		missingCode = `
+	missing := populateDataModelFromNonce(2)
+`
+	}
+
+	keyArgs := primaryKeyArgsCode(modelStruct, "d")
+
+	return []gopkg.DeclFunc{
+		{
+			Name: "TestUpdate" + byKey + "Conflicts",
+			Args: []gopkg.DeclVar{
+				testingArg(),
+			},
+			BodyTmpl: `
+	gotest_time.SetTimeNowForTesting(t)
+
+	ctx, repo := openRepository(t)
+
+	var err error
+	d := populateDataModelFromNonce(1)
+` + insertCode + missingCode + `
+	// Both writers read the row at the same version
+	first, err := repo.Select` + byKey + `(ctx, ` + keyArgs + `)
+	require.NoError(t, err)
+
+	second, err := repo.Select` + byKey + `(ctx, ` + keyArgs + `)
+	require.NoError(t, err)
+
+	err = repo.Update` + byKey + `(ctx, ` + keyArgs + `, first.` + f.Name + `, queryFromNonce(3))
+	require.NoError(t, err)
+
+	// The second writer updates at a version which is no longer current
+	err = repo.Update` + byKey + `(ctx, ` + keyArgs + `, second.` + f.Name + `, queryFromNonce(4))
+	require.ErrorIs(t, err, lib.ErrConcurrentModification)
+
+	actual, err := repo.Select` + byKey + `(ctx, ` + keyArgs + `)
+	require.NoError(t, err)
+	require.Equal(t, first.` + f.Name + ` + 1, actual.` + f.Name + `)
+
+	// Rereading the row gives the current version, at which it can be updated
+	err = repo.Update` + byKey + `(ctx, ` + keyArgs + `, actual.` + f.Name + `, queryFromNonce(4))
+	require.NoError(t, err)
+
+	actual, err = repo.Select` + byKey + `(ctx, ` + keyArgs + `)
+	require.NoError(t, err)
+	require.Equal(t, first.` + f.Name + ` + 2, actual.` + f.Name + `)
+
+	// Updating a row which does not exist is not a conflict
+	err = repo.Update` + byKey + `(ctx, ` + primaryKeyArgsCode(modelStruct, "missing") + `, 0, queryFromNonce(4))
+	require.Error(t, err)
+	require.False(t, errors.Is(err, lib.ErrConcurrentModification))
+`,
+		},
+		{
+			Name: "TestUpdate" + byKey + "ConcurrentConflicts",
+			Args: []gopkg.DeclVar{
+				testingArg(),
+			},
+			BodyTmpl: `
+	gotest_time.SetTimeNowForTesting(t)
+
+	ctx, repo := openRepository(t)
+
+	var err error
+	d := populateDataModelFromNonce(1)
+` + insertCode + `
+	read, err := repo.Select` + byKey + `(ctx, ` + keyArgs + `)
+	require.NoError(t, err)
+
+	// Writers which all read the row at the same version update it at once,
+	// and only one of them succeeds
+	const writers = 8
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		go func(nonce int64) {
+			errs <- repo.Update` + byKey + `(ctx, ` + keyArgs + `, read.` + f.Name + `, queryFromNonce(nonce))
+		}(int64(10 + i))
+	}
+
+	var updated int
+	for i := 0; i < writers; i++ {
+		err := <-errs
+		if err == nil {
+			updated++
+			continue
+		}
+
+		require.ErrorIs(t, err, lib.ErrConcurrentModification)
+	}
+	require.Equal(t, 1, updated)
+
+	actual, err := repo.Select` + byKey + `(ctx, ` + keyArgs + `)
+	require.NoError(t, err)
+	require.Equal(t, read.` + f.Name + ` + 1, actual.` + f.Name + `)
+`,
+		},
+	}
+}
+
+// testfuncUpdateBumpsUpdatedAt returns a test that updates set the
+// updated_at timestamp of the model to the current time, if the model has one
+// set by the generated methods
+func testfuncUpdateBumpsUpdatedAt(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) []gopkg.DeclFunc {
+
+	var updatedAt gopkg.DeclVar
+	for _, f := range modelStruct.Fields {
+		if kind, _ := timestampOf(f); kind == timestampUpdatedAt {
+			updatedAt = f
+			break
+		}
+	}
+
+	if updatedAt.Name == "" {
+		return nil
+	}
+
+	if isDBTimestampField(updatedAt) {
+		return testfuncUpdateBumpsDBUpdatedAt(modelStruct, updatedAt)
+	}
+
+	column := columnName(updatedAt)
+
+	return []gopkg.DeclFunc{
+		{
+			Name: "TestUpdateBumps" + updatedAt.Name,
+			Args: []gopkg.DeclVar{
+				testingArg(),
+			},
+			BodyTmpl: `
+	now := gotest_time.SetTimeNowForTesting(t)
+
+	ctx, repo := openRepository(t)
+
+	id, err := repo.Insert(ctx, populateDataModelFromNonce(1))
+	require.NoError(t, err)
+
+	// Setting the timestamp explicitly does not bump it, which puts it in the
+	// past so that bumping it can be seen
+	past := now.Add(-time.Hour)
+	err = repo.UpdateByID(ctx, id` + versionArgCode(modelStruct, "0") + `, map[string]any{
+		"` + column + `": past,
+	})
+	require.NoError(t, err)
+
+	actual, err := repo.SelectByID(ctx, id)
+	require.NoError(t, err)
+	assert.LogicallyEqual(t, past, actual.` + updatedAt.Name + `)
+
+	err = repo.UpdateByID(ctx, id` + versionArgCode(modelStruct, "actual." + versionFieldName(modelStruct)) + `, map[string]any{
+		"id": id,
+	})
+	require.NoError(t, err)
+
+	actual, err = repo.SelectByID(ctx, id)
+	require.NoError(t, err)
+	assert.LogicallyEqual(t, now, actual.` + updatedAt.Name + `)
+`,
+		},
+	}
+}
+
+// testfuncUpdateBumpsDBUpdatedAt returns a test that updates which change a
+// row bump the `updatedAt` timestamp set by the DB, unless it is set
+// explicitly, if the model has a column for the update to change
+func testfuncUpdateBumpsDBUpdatedAt(
+	modelStruct gopkg.TypeStruct,
+	updatedAt gopkg.DeclVar,
+) []gopkg.DeclFunc {
+
+	// The DB only bumps the timestamp of rows which the update changes, so
+	// the update sets a plain column to a different value
+	changed, ok := testUpdatedField(modelStruct)
+	if !ok {
+		return nil
+	}
+
+	column := columnName(updatedAt)
+
+	return []gopkg.DeclFunc{
+		{
+			Name: "TestUpdateBumps" + updatedAt.Name,
+			Args: []gopkg.DeclVar{
+				testingArg(),
+			},
+			BodyTmpl: `
+	ctx, repo := openRepository(t)
+
+	id, err := repo.Insert(ctx, populateDataModelFromNonce(1))
+	require.NoError(t, err)
+
+	actual, err := repo.SelectByID(ctx, id)
+	require.NoError(t, err)
+	require.False(t, actual.` + updatedAt.Name + `.IsZero())
+
+	// Setting the timestamp explicitly does not bump it, which puts it in the
+	// past so that bumping it can be seen
+	past := actual.` + updatedAt.Name + `.Add(-time.Hour)
+	err = repo.UpdateByID(ctx, id` + versionArgCode(modelStruct, "actual." + versionFieldName(modelStruct)) + `, map[string]any{
+		"` + column + `": past,
+	})
+	require.NoError(t, err)
+
+	actual, err = repo.SelectByID(ctx, id)
+	require.NoError(t, err)
+	assert.LogicallyEqual(t, past, actual.` + updatedAt.Name + `)
+
+	err = repo.UpdateByID(ctx, id` + versionArgCode(modelStruct, "actual." + versionFieldName(modelStruct)) + `, map[string]any{
+		"` + columnName(changed) + `": populateDataModelFromNonce(2).` + changed.Name + `,
+	})
+	require.NoError(t, err)
+
+	actual, err = repo.SelectByID(ctx, id)
+	require.NoError(t, err)
+	require.True(t, actual.` + updatedAt.Name + `.After(past))
+`,
+		},
+	}
+}
+
+// testUpdatedField returns a plain string or int64 field of the model which
+// tests can update to the value of another nonce, without it clashing with
+// the keys, foreign keys or version of the row
+func testUpdatedField(
+	modelStruct gopkg.TypeStruct,
+) (gopkg.DeclVar, bool) {
+
+	for _, f := range modelStruct.Fields {
+		switch f.Type.(type) {
+		case gopkg.TypeString, gopkg.TypeInt64:
+		default:
+			continue
+		}
+
+		if f.Name == "ID" || isPKField(f) || isUniqueField(f) || isForeignKeyField(f) || isVersionField(f) {
+			continue
+		}
+
+		return f, true
+	}
+
+	return gopkg.DeclVar{}, false
+}
+
+func testfuncDelete(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) gopkg.DeclFunc {
+
+	dbcrudAlias := strcase.ToSnake(modelName)
+	dbModelType := d.Import.Alias + "." + modelName
+
+	return gopkg.DeclFunc{
+		Name: "TestDelete",
+		Args: []gopkg.DeclVar{
+			testingArg(),
+		},
+		BodyTmpl: `
+	now := gotest_time.SetTimeNowForTesting(t)
+
+	testCases := []struct{
+		Name string
+		ToInsert []` + dbModelType + `
+		Query map[string]any
+		Conds ` + dbcrudAlias + `.Query
+		ExpectedNumDeleted int64
+		Expected []` + dbModelType + `
+		ExpectErr bool
+	}{
+		{
+			Name: "empty query deletes all records",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(1000),
+				populateDataModelFromNonce(1001),
+				populateDataModelFromNonce(1002),
+				populateDataModelFromNonce(1003),
+				populateDataModelFromNonce(1004),
+			},
+			ExpectedNumDeleted: 5,
+		},
+		{
+			Name: "delete records using query",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(1000),
+				populateDataModelFromNonce(1001),
+				populateDataModelFromNonce(1002),
+				populateDataModelFromNonce(1002),
+				populateDataModelFromNonce(1003),
+				populateDataModelFromNonce(1004),
+				populateDataModelFromNonce(1002),
+			},
+			Query: queryFromNonce(1002),
+			ExpectedNumDeleted: 3,
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(1000, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(1001, 2, now),
+				populateDataModelFromNonceWithIDAndTimestamp(1003, 5, now),
+				populateDataModelFromNonceWithIDAndTimestamp(1004, 6, now),
+			},
+		},
+		{
+			Name: "when query contains field not in data model returns error",
+			Query: map[string]any{
+				"some_field_not_in_` + modelName + `": 1,
+			},
+			ExpectErr: true,
+		},
+		{
+			Name: "delete records using typed query",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(1000),
+				populateDataModelFromNonce(1001),
+				populateDataModelFromNonce(1002),
+				populateDataModelFromNonce(1003),
+			},
+			Conds: ` + dbcrudAlias + `.Where().IDIn(2, 4),
+			ExpectedNumDeleted: 2,
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(1000, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(1002, 3, now),
+			},
+		},
+		{
+			Name: "delete records using range query",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(1000),
+				populateDataModelFromNonce(1001),
+				populateDataModelFromNonce(1002),
+				populateDataModelFromNonce(1003),
+			},
+			Conds: ` + dbcrudAlias + `.Where().IDGe(2).IDLe(3),
+			ExpectedNumDeleted: 2,
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(1000, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(1003, 4, now),
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			ctx, repo := openRepository(t)
+
+			for _, d := range test.ToInsert {
+				_, err := repo.Insert(ctx, d)
+				require.NoError(t, err)
+			}
+
+			numDeleted, err := repo.Delete(ctx, test.Query, test.Conds...)
+			if test.ExpectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			require.Equal(t, test.ExpectedNumDeleted, numDeleted)
+
+			actual, err := repo.Select(ctx, nil)
+			require.NoError(t, err)
+
+			require.Equal(t, len(test.Expected), len(actual))
+
+			for i := range actual {
+				` + assertModelsEqualCode(modelStruct, "test.Expected[i]", "actual[i]", `fmt.Sprint(i) + "th element not equal"`) + `
+			}
+		})
+	}
+`,
+	}
+}
+
+func testfuncDeleteByID(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) gopkg.DeclFunc {
+
+	dbModelType := d.Import.Alias + "." + modelName
+
+	return gopkg.DeclFunc{
+		Name: "TestDeleteByID",
+		Args: []gopkg.DeclVar{
+			testingArg(),
+		},
+		BodyTmpl: `
+	now := gotest_time.SetTimeNowForTesting(t)
+
+	testCases := []struct{
+		Name string
+		ToInsert []` + dbModelType + `
+		ID int64
+		Expected []` + dbModelType + `
+		ExpectErr bool
+	}{
+		{
+			Name: "when ID not found returns error",
+			ExpectErr: true,
+		},
+		{
+			Name: "insert many and delete by ID",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(101),
+				populateDataModelFromNonce(102),
+				populateDataModelFromNonce(103),
+				populateDataModelFromNonce(104),
+			},
+			ID: 3,
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(101, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(102, 2, now),
+				populateDataModelFromNonceWithIDAndTimestamp(104, 4, now),
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			ctx, repo := openRepository(t)
+
+			for _, d := range test.ToInsert {
+				_, err := repo.Insert(ctx, d)
+				require.NoError(t, err)
+			}
+
+			err := repo.DeleteByID(ctx, test.ID)
+
+			if test.ExpectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			actual, err := repo.Select(ctx, nil)
+			require.NoError(t, err)
+
+			require.Equal(t, len(test.Expected), len(actual))
+
+			for i := range actual {
+				` + assertModelsEqualCode(modelStruct, "test.Expected[i]", "actual[i]", `fmt.Sprint(i) + "th element not equal"`) + `
+			}
+		})
+	}
+`,
+	}
+}
+
+func testfuncWithTx(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) gopkg.DeclFunc {
+
+	dbcrudAlias := strcase.ToSnake(modelName)
+	dbModelType := d.Import.Alias + "." + modelName
+
+	ctxAndDbArgs := `ctx, db`
+	ctxAndTxArgs := `ctx, tx`
+	if d.UseDBContext {
+		ctxAndDbArgs = `ctx`
+		ctxAndTxArgs = `ctx`
+	}
+
+	return gopkg.DeclFunc{
+		Name: "TestWithTx",
+		Args: []gopkg.DeclVar{
+			testingArg(),
+		},
+		BodyData: d,
+		BodyTmpl: `
+	now := gotest_time.SetTimeNowForTesting(t)
+
+	testCases := []struct{
+		Name string
+		ToInsert []` + dbModelType + `
+		FuncErr error
+		FuncPanics bool
+		Expected []` + dbModelType + `
+	}{
+		{
+			Name: "inserts are committed when func succeeds",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(11),
+				populateDataModelFromNonce(21),
+			},
+			Expected: []` + dbModelType + `{
+				populateDataModelFromNonceWithIDAndTimestamp(11, 1, now),
+				populateDataModelFromNonceWithIDAndTimestamp(21, 2, now),
+			},
+		},
+		{
+			Name: "inserts are rolled back when func returns error",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(11),
+				populateDataModelFromNonce(21),
+			},
+			FuncErr: errors.New("some error"),
+		},
+		{
+			Name: "inserts are rolled back when func panics",
+			ToInsert: []` + dbModelType + `{
+				populateDataModelFromNonce(11),
+				populateDataModelFromNonce(21),
+			},
+			FuncPanics: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			db := ` + openTestDBCode(d, modelStruct) + `
+{{- if .BodyData.UseDBContext}}
+			ctx := lib.ContextWithDB(context.Background(), db)
+{{- else}}
+			ctx := context.Background()
+{{- end}}
+
+			var tx lib.DBTX
+			withTx := func() error {
+				return lib.WithTx(ctx, db, func(ctx context.Context) error {
+					var err error
+					tx, err = lib.DBTXFromContext(ctx)
+					require.NoError(t, err)
+
+					for _, d := range test.ToInsert {
+						_, err := ` + dbcrudAlias + `.Insert(` + ctxAndTxArgs + `, d)
+						require.NoError(t, err)
+					}
+
+					if test.FuncPanics {
+						panic("some panic")
+					}
+
+					return test.FuncErr
+				})
+			}
+
+			if test.FuncPanics {
+				require.PanicsWithValue(t, "some panic", func() {
+					_ = withTx()
+				})
+			} else {
+				require.Equal(t, test.FuncErr, withTx())
+			}
+
+			// the transaction is always finished by WithTx
+			require.ErrorIs(t, tx.(*sql.Tx).Rollback(), sql.ErrTxDone)
+
+			actual, err := ` + dbcrudAlias + `.Select(` + ctxAndDbArgs + `, nil)
+			require.NoError(t, err)
+
+			require.Equal(t, len(test.Expected), len(actual))
+
+			for i := range actual {
+				` + assertModelsEqualCode(modelStruct, "test.Expected[i]", "actual[i]", `fmt.Sprint(i) + "th element not equal"`) + `
+			}
+		})
+	}
+`,
+	}
+}
+
+// testfuncInsertAndSelectByPK returns the test of `Insert` and `SelectByPK`
+// for models with a custom primary key
+func testfuncInsertAndSelectByPK(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) gopkg.DeclFunc {
+
+	dbcrudAlias := strcase.ToSnake(modelName)
+	dbModelType := d.Import.Alias + "." + modelName
+
+	return gopkg.DeclFunc{
+		Name: "TestInsertAndSelectByPK",
+		Args: []gopkg.DeclVar{
+			testingArg(),
+		},
+		BodyTmpl: `
+	now := gotest_time.SetTimeNowForTesting(t)
+
+	ctx, repo := openRepository(t)
+
+	toInsert := []` + dbModelType + `{
+		populateDataModelFromNonce(11),
+		populateDataModelFromNonce(21),
+		populateDataModelFromNonce(31),
+	}
+
+	for _, d := range toInsert {
+		pk, err := repo.Insert(ctx, d)
+		require.NoError(t, err)
+		assert.LogicallyEqual(t, ` + primaryKeyValueCode(modelStruct, "d", dbcrudAlias + ".") + `, pk)
+	}
+
+	for i, d := range toInsert {
+		actual, err := repo.SelectByPK(ctx, ` + primaryKeyArgsCode(modelStruct, "d") + `)
+		require.NoError(t, err)
+		` + assertModelsEqualCode(modelStruct, "withTimestamps(d, now)", "actual", `fmt.Sprint(i) + "th element not equal"`) + `
+	}
+
+	notInserted := populateDataModelFromNonce(41)
+	_, err := repo.SelectByPK(ctx, ` + primaryKeyArgsCode(modelStruct, "notInserted") + `)
+	require.Error(t, err)
+`,
+	}
+}
+
+// testfuncInsertGeneratesUUIDs returns the test that the insert methods set
+// empty `pk=uuid` fields to new UUIDs, if the model has any
+func testfuncInsertGeneratesUUIDs(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) []gopkg.DeclFunc {
+
+	var uuidFields []string
+	for _, f := range modelStruct.Fields {
+		if isUUIDField(f) {
+			uuidFields = append(uuidFields, f.Name)
+		}
+	}
+
+	if len(uuidFields) == 0 {
+		return nil
+	}
+
+	dbModelType := d.Import.Alias + "." + modelName
+
+	// pkField returns the value of the UUID field `field` in the primary key
+	// `pk` returned by the insert methods
+	pkField := func(pk string, field string) string {
+		if len(primaryKeyFields(modelStruct)) == 1 {
+			return pk
+		}
+		return pk + "." + field
+	}
+
+	var clear, clearMany, assign, checkMany string
+	for _, f := range uuidFields {
+		clear += "\td." + f + ` = ""` + "\n"
+		clearMany += "\tfor i := range ds {\n\t\tds[i]." + f + ` = ""` + "\n\t}\n"
+		assign += "\trequire.NotEqual(t, \"\", " + pkField("pk", f) + ")\n" +
+			"\td." + f + " = " + pkField("pk", f) + "\n"
+		checkMany += "\trequire.NotEqual(t, " + pkField("pks[0]", f) + ", " + pkField("pks[1]", f) + ")\n"
+	}
+
+	return []gopkg.DeclFunc{
+		{
+			Name: "TestInsertGeneratesUUIDs",
+			Args: []gopkg.DeclVar{
+				testingArg(),
+			},
+			BodyTmpl: `
+	now := gotest_time.SetTimeNowForTesting(t)
+
+	ctx, repo := openRepository(t)
+
+	d := populateDataModelFromNonce(1)
+` + clear + `
+	pk, err := repo.Insert(ctx, d)
+	require.NoError(t, err)
+` + assign + `
+	actual, err := repo.SelectByPK(ctx, ` + primaryKeyArgsCode(modelStruct, "d") + `)
+	require.NoError(t, err)
+	` + assertModelsEqualCode(modelStruct, "withTimestamps(d, now)", "actual") + `
+
+	ds := []` + dbModelType + `{
+		populateDataModelFromNonce(2),
+		populateDataModelFromNonce(3),
+	}
+` + clearMany + `
+	pks, err := repo.InsertMany(ctx, ds)
+	require.NoError(t, err)
+	require.Equal(t, len(ds), len(pks))
+` + checkMany,
+		},
+	}
+}
+
+// testfuncInsertManyByPK returns the test of `InsertMany` for models with a
+// custom primary key, which checks the keys it returns
+func testfuncInsertManyByPK(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) gopkg.DeclFunc {
+
+	dbcrudAlias := strcase.ToSnake(modelName)
+	dbModelType := d.Import.Alias + "." + modelName
+
+	numColumns := 0
+	for _, field := range modelStruct.Fields {
+		if !isDBTimestampField(field) {
+			numColumns++
+		}
+	}
+
+	// Insert enough rows to fill one chunk and start another
+	numToInsert := strconv.Itoa(insertManyChunkSize(d, numColumns) + 1)
+
+	return gopkg.DeclFunc{
+		Name: "TestInsertMany",
+		Args: []gopkg.DeclVar{
+			testingArg(),
+		},
+		BodyTmpl: `
+	now := gotest_time.SetTimeNowForTesting(t)
+
+	ctx, repo := openRepository(t)
+
+	toInsert := make([]` + dbModelType + `, 0, ` + numToInsert + `)
+	for i := 0; i < ` + numToInsert + `; i++ {
+		toInsert = append(toInsert, populateDataModelFromNonce(int64(i)))
+	}
+
+	pks, err := repo.InsertMany(ctx, toInsert)
+	require.NoError(t, err)
+
+	require.Equal(t, len(toInsert), len(pks))
+	for i, d := range toInsert {
+		assert.LogicallyEqual(t, ` + primaryKeyValueCode(modelStruct, "d", dbcrudAlias + ".") + `, pks[i])
+	}
+
+	actual, err := repo.SelectPage(
+		ctx,
+		lib.SelectOptions{
+			MaxRows: lib.UnlimitedRows,
+		},
+		nil,
+	)
+	require.NoError(t, err)
+	require.Equal(t, len(toInsert), len(actual))
+
+	for _, i := range []int{0, len(toInsert) - 1} {
+		d := toInsert[i]
+		actual, err := repo.SelectByPK(ctx, ` + primaryKeyArgsCode(modelStruct, "d") + `)
+		require.NoError(t, err)
+		` + assertModelsEqualCode(modelStruct, "withTimestamps(d, now)", "actual", `fmt.Sprint(i) + "th element not equal"`) + `
+	}
+`,
+	}
+}
+
+// testfuncSelectPageAfterPK returns the test of paging through the rows of
+// models with a custom primary key with `AfterPK`
+func testfuncSelectPageAfterPK(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) gopkg.DeclFunc {
+
+	dbcrudAlias := strcase.ToSnake(modelName)
+	dbModelType := d.Import.Alias + "." + modelName
+
+	return gopkg.DeclFunc{
+		Name: "TestSelectPageAfterPK",
+		Args: []gopkg.DeclVar{
+			testingArg(),
+		},
+		BodyTmpl: `
+	gotest_time.SetTimeNowForTesting(t)
+
+	ctx, repo := openRepository(t)
+
+	_, err := repo.InsertMany(ctx, []` + dbModelType + `{
+		populateDataModelFromNonce(1),
+		populateDataModelFromNonce(2),
+		populateDataModelFromNonce(3),
+	})
+	require.NoError(t, err)
+
+	all, err := repo.SelectPage(ctx, lib.SelectOptions{}, nil)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(all))
+
+	actual, err := repo.SelectPage(
+		ctx,
+		lib.SelectOptions{
+			AfterPK: ` + primaryKeyValueCode(modelStruct, "all[0]", dbcrudAlias + ".") + `,
+		},
+		nil,
+	)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(actual))
+
+	for i := range actual {
+		` + assertModelsEqualCode(modelStruct, "all[i+1]", "actual[i]", `fmt.Sprint(i) + "th element not equal"`) + `
+	}
+
+	actual, err = repo.SelectPage(
+		ctx,
+		lib.SelectOptions{
+			AfterPK: ` + primaryKeyValueCode(modelStruct, "all[2]", dbcrudAlias + ".") + `,
+		},
+		nil,
+	)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(actual))
+
+	_, err = repo.SelectPage(ctx, lib.SelectOptions{AfterID: 1}, nil)
+	require.Error(t, err)
+
+	_, err = repo.SelectPage(ctx, lib.SelectOptions{AfterPK: struct{}{}}, nil)
+	require.Error(t, err)
+`,
+	}
+}
+
+// testfuncUpdateByPK returns the test of `UpdateByPK` for models with a
+// custom primary key
+func testfuncUpdateByPK(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) gopkg.DeclFunc {
+
+	dbModelType := d.Import.Alias + "." + modelName
+
+	var assignPK string
+	for _, f := range primaryKeyFields(modelStruct) {
+		assignPK += "\texpected." + f.Name + " = toInsert[0]." + f.Name + "\n"
+	}
+
+	return gopkg.DeclFunc{
+		Name: "TestUpdateByPK",
+		Args: []gopkg.DeclVar{
+			testingArg(),
+		},
+		BodyTmpl: `
+	now := gotest_time.SetTimeNowForTesting(t)
+
+	ctx, repo := openRepository(t)
+
+	toInsert := []` + dbModelType + `{
+		populateDataModelFromNonce(1),
+		populateDataModelFromNonce(2),
+	}
+
+	for _, d := range toInsert {
+		_, err := repo.Insert(ctx, d)
+		require.NoError(t, err)
+	}
+
+	err := repo.UpdateByPK(ctx, ` + primaryKeyArgsCode(modelStruct, "toInsert[0]") + versionArgCode(modelStruct, "0") + `, queryFromNonce(3))
+	require.NoError(t, err)
+
+	expected := populateDataModelFromNonce(3)
+` + assignPK + `
+	actual, err := repo.SelectByPK(ctx, ` + primaryKeyArgsCode(modelStruct, "toInsert[0]") + `)
+	require.NoError(t, err)
+	` + assertModelsEqualCode(modelStruct, "withTimestamps(expected, now)", "actual") + `
+
+	// The row with another key is not updated
+	actual, err = repo.SelectByPK(ctx, ` + primaryKeyArgsCode(modelStruct, "toInsert[1]") + `)
+	require.NoError(t, err)
+	` + assertModelsEqualCode(modelStruct, "withTimestamps(toInsert[1], now)", "actual") + `
+
+	notInserted := populateDataModelFromNonce(4)
+	err = repo.UpdateByPK(ctx, ` + primaryKeyArgsCode(modelStruct, "notInserted") + versionArgCode(modelStruct, "0") + `, queryFromNonce(3))
+	require.Error(t, err)
+`,
+	}
+}
+
+// testfuncDeleteByPK returns the test of `DeleteByPK` for models with a
+// custom primary key
+func testfuncDeleteByPK(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) gopkg.DeclFunc {
+
+	dbModelType := d.Import.Alias + "." + modelName
+
+	return gopkg.DeclFunc{
+		Name: "TestDeleteByPK",
+		Args: []gopkg.DeclVar{
+			testingArg(),
+		},
+		BodyTmpl: `
+	now := gotest_time.SetTimeNowForTesting(t)
+
+	ctx, repo := openRepository(t)
+
+	toInsert := []` + dbModelType + `{
+		populateDataModelFromNonce(101),
+		populateDataModelFromNonce(102),
+		populateDataModelFromNonce(103),
+	}
+
+	for _, d := range toInsert {
+		_, err := repo.Insert(ctx, d)
+		require.NoError(t, err)
+	}
+
+	err := repo.DeleteByPK(ctx, ` + primaryKeyArgsCode(modelStruct, "toInsert[1]") + `)
+	require.NoError(t, err)
+
+	_, err = repo.SelectByPK(ctx, ` + primaryKeyArgsCode(modelStruct, "toInsert[1]") + `)
+	require.Error(t, err)
+
+	for _, i := range []int{0, 2} {
+		d := toInsert[i]
+		actual, err := repo.SelectByPK(ctx, ` + primaryKeyArgsCode(modelStruct, "d") + `)
+		require.NoError(t, err)
+		` + assertModelsEqualCode(modelStruct, "withTimestamps(d, now)", "actual", `fmt.Sprint(i) + "th element not equal"`) + `
+	}
+
+	err = repo.DeleteByPK(ctx, ` + primaryKeyArgsCode(modelStruct, "toInsert[1]") + `)
+	require.Error(t, err)
+`,
+	}
+}
+
+// testfuncWithTxByPK returns the test of `lib.WithTx` for models with a
+// custom primary key
+func testfuncWithTxByPK(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) gopkg.DeclFunc {
+
+	dbcrudAlias := strcase.ToSnake(modelName)
+	dbModelType := d.Import.Alias + "." + modelName
+
+	ctxAndDbArgs := `ctx, db`
+	ctxAndTxArgs := `ctx, tx`
+	if d.UseDBContext {
+		ctxAndDbArgs = `ctx`
+		ctxAndTxArgs = `ctx`
+	}
+
+	return gopkg.DeclFunc{
+		Name: "TestWithTx",
+		Args: []gopkg.DeclVar{
+			testingArg(),
+		},
+		BodyData: d,
+		BodyTmpl: `
+	now := gotest_time.SetTimeNowForTesting(t)
+
+	testCases := []struct{
+		Name string
+		FuncErr error
+		FuncPanics bool
+		ExpectCommitted bool
+	}{
+		{
+			Name: "inserts are committed when func succeeds",
+			ExpectCommitted: true,
+		},
+		{
+			Name: "inserts are rolled back when func returns error",
+			FuncErr: errors.New("some error"),
+		},
+		{
+			Name: "inserts are rolled back when func panics",
+			FuncPanics: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.Name, func(t *testing.T) {
+			db := ` + openTestDBCode(d, modelStruct) + `
+{{- if .BodyData.UseDBContext}}
+			ctx := lib.ContextWithDB(context.Background(), db)
+{{- else}}
+			ctx := context.Background()
+{{- end}}
+
+			toInsert := []` + dbModelType + `{
+				populateDataModelFromNonce(11),
+				populateDataModelFromNonce(21),
+			}
+
+			var tx lib.DBTX
+			withTx := func() error {
+				return lib.WithTx(ctx, db, func(ctx context.Context) error {
+					var err error
+					tx, err = lib.DBTXFromContext(ctx)
+					require.NoError(t, err)
+
+					for _, d := range toInsert {
+						_, err := ` + dbcrudAlias + `.Insert(` + ctxAndTxArgs + `, d)
+						require.NoError(t, err)
+					}
+
+					if test.FuncPanics {
+						panic("some panic")
+					}
+
+					return test.FuncErr
+				})
+			}
+
+			if test.FuncPanics {
+				require.PanicsWithValue(t, "some panic", func() {
+					_ = withTx()
+				})
+			} else {
+				require.Equal(t, test.FuncErr, withTx())
+			}
+
+			// the transaction is always finished by WithTx
+			require.ErrorIs(t, tx.(*sql.Tx).Rollback(), sql.ErrTxDone)
+
+			for i, d := range toInsert {
+				actual, err := ` + dbcrudAlias + `.SelectByPK(` + ctxAndDbArgs + `, ` + primaryKeyArgsCode(modelStruct, "d") + `)
+				if !test.ExpectCommitted {
+					require.Error(t, err)
+					continue
+				}
+				require.NoError(t, err)
+				` + assertModelsEqualCode(modelStruct, "withTimestamps(d, now)", "actual", `fmt.Sprint(i) + "th element not equal"`) + `
+			}
+		})
+	}
+`,
+	}
+}
+
+// testfuncsSoftDelete returns the tests of the soft delete, restore and hard
+// delete methods of models with soft deletes, which compare against the
+// inserted rows as selected before any are deleted
+func testfuncsSoftDelete(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) []gopkg.DeclFunc {
+
+	f, ok := softDeleteField(modelStruct)
+	if !ok {
+		return nil
+	}
+
+	dbModelType := d.Import.Alias + "." + modelName
+
+	byKey := "ByID"
+	if hasCustomPrimaryKey(modelStruct) {
+		byKey = "ByPK"
+	}
+
+	deletedAt := nullableTestField{
+		Name: f.Name,
+		Value: "now.Round(time.Second)",
+		ValueType: "time.Time",
+	}
+	if nullType, ok := sqlNullType(f.Type); ok {
+		deletedAt.NullType = nullType.Name
+		deletedAt.ValueField = sqlNullTypes[nullType.Name].ValueField
+	}
+
+	// Deleting and restoring rows are updates, and so bump the versions of
+	// models with versions
+	versionBump := ""
+	restoreVersionBumps := ""
+	if f, ok := versionField(modelStruct); ok {
+		versionBump = "\n\td." + f.Name + "++"
+		restoreVersionBumps = `
+	for i := range inserted {
+		inserted[i].` + f.Name + ` += 2
+	}
+`
+	}
+
+	insertCode := `
+	ctx, repo := openRepository(t)
+
+	for _, nonce := range []int64{101, 102, 103} {
+		_, err := repo.Insert(ctx, populateDataModelFromNonce(nonce))
+		require.NoError(t, err)
+	}
+
+	inserted, err := repo.Select(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(inserted))
+`
+
+	tests := []gopkg.DeclFunc{
+		{
+			Name: "TestDeleteIsSoft",
+			Args: []gopkg.DeclVar{
+				testingArg(),
+			},
+			BodyTmpl: `
+	now := gotest_time.SetTimeNowForTesting(t)
+` + insertCode + `
+	err = repo.Delete` + byKey + `(ctx, ` + primaryKeyArgsCode(modelStruct, "inserted[1]") + `)
+	require.NoError(t, err)
+
+	actual, err := repo.Select(ctx, nil)
+	require.NoError(t, err)
+	assert.LogicallyEqual(t, []` + dbModelType + `{inserted[0], inserted[2]}, actual)
+
+	_, err = repo.Select` + byKey + `(ctx, ` + primaryKeyArgsCode(modelStruct, "inserted[1]") + `)
+	require.Error(t, err)
+
+	d := inserted[1]
+` + deletedAt.AssignCode("\t") + versionBump + `
+
+	actual, err = repo.SelectIncludingDeleted(ctx, nil)
+	require.NoError(t, err)
+	assert.LogicallyEqual(t, []` + dbModelType + `{inserted[0], d, inserted[2]}, actual)
+
+	err = repo.Delete` + byKey + `(ctx, ` + primaryKeyArgsCode(modelStruct, "inserted[1]") + `)
+	require.Error(t, err)
+
+	n, err := repo.Delete(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), n)
+
+	actual, err = repo.Select(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(actual))
+
+	actual, err = repo.SelectIncludingDeleted(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(actual))
+`,
+		},
+		{
+			Name: "TestRestore",
+			Args: []gopkg.DeclVar{
+				testingArg(),
+			},
+			BodyTmpl: `
+	gotest_time.SetTimeNowForTesting(t)
+` + insertCode + `
+	n, err := repo.Delete(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), n)
+` + restoreVersionBumps + `
+	err = repo.Restore` + byKey + `(ctx, ` + primaryKeyArgsCode(modelStruct, "inserted[0]") + `)
+	require.NoError(t, err)
+
+	actual, err := repo.Select(ctx, nil)
+	require.NoError(t, err)
+	assert.LogicallyEqual(t, []` + dbModelType + `{inserted[0]}, actual)
+
+	err = repo.Restore` + byKey + `(ctx, ` + primaryKeyArgsCode(modelStruct, "inserted[0]") + `)
+	require.Error(t, err)
+
+	n, err = repo.Restore(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), n)
+
+	actual, err = repo.Select(ctx, nil)
+	require.NoError(t, err)
+	assert.LogicallyEqual(t, inserted, actual)
+`,
+		},
+		{
+			Name: "TestHardDelete",
+			Args: []gopkg.DeclVar{
+				testingArg(),
+			},
+			BodyTmpl: `
+	now := gotest_time.SetTimeNowForTesting(t)
+` + insertCode + `
+	err = repo.Delete` + byKey + `(ctx, ` + primaryKeyArgsCode(modelStruct, "inserted[0]") + `)
+	require.NoError(t, err)
+
+	err = repo.HardDelete` + byKey + `(ctx, ` + primaryKeyArgsCode(modelStruct, "inserted[1]") + `)
+	require.NoError(t, err)
+
+	d := inserted[0]
+` + deletedAt.AssignCode("\t") + versionBump + `
+
+	actual, err := repo.SelectIncludingDeleted(ctx, nil)
+	require.NoError(t, err)
+	assert.LogicallyEqual(t, []` + dbModelType + `{d, inserted[2]}, actual)
+
+	err = repo.HardDelete` + byKey + `(ctx, ` + primaryKeyArgsCode(modelStruct, "inserted[1]") + `)
+	require.Error(t, err)
+
+	n, err := repo.HardDelete(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), n)
+
+	actual, err = repo.SelectIncludingDeleted(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(actual))
+`,
+		},
+	}
+
+	return append(tests, testfuncUpdateLeavesOutDeleted(modelStruct, byKey, insertCode)...)
+}
+
+// testfuncUpdateLeavesOutDeleted returns a test that updates leave out soft
+// deleted rows, if the model has a field for the test to update, where the
+// rows are inserted by `insertCode`
+func testfuncUpdateLeavesOutDeleted(
+	modelStruct gopkg.TypeStruct,
+	byKey string,
+	insertCode string,
+) []gopkg.DeclFunc {
+
+	updated, ok := testUpdatedField(modelStruct)
+	if !ok {
+		return nil
+	}
+
+	return []gopkg.DeclFunc{
+		{
+			Name: "TestUpdateLeavesOutDeleted",
+			Args: []gopkg.DeclVar{
+				testingArg(),
+			},
+			BodyTmpl: `
+	gotest_time.SetTimeNowForTesting(t)
+` + insertCode + `
+	err = repo.Delete` + byKey + `(ctx, ` + primaryKeyArgsCode(modelStruct, "inserted[1]") + `)
+	require.NoError(t, err)
+
+	updates := map[string]any{
+		"` + columnName(updated) + `": populateDataModelFromNonce(104).` + updated.Name + `,
+	}
+
+	n, err := repo.Update(ctx, updates, nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), n)
+
+	err = repo.Update` + byKey + `(ctx, ` + primaryKeyArgsCode(modelStruct, "inserted[1]") + versionArgCode(modelStruct, "inserted[1]." + versionFieldName(modelStruct)) + `, updates)
+	require.ErrorIs(t, err, lib.ErrNotFound)
+
+	actual, err := repo.SelectIncludingDeleted(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(actual))
+	require.Equal(t, inserted[1].` + updated.Name + `, actual[1].` + updated.Name + `)
+`,
+		},
+	}
+}
+
+// testfuncErrors returns a test that the errors returned by the generated
+// methods wrap the sentinel and typed errors of `lib`
+func testfuncErrors(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) gopkg.DeclFunc {
+
+	byKey := "ByID"
+	insertCode := `
+	d.ID, err = repo.Insert(ctx, d)
+	require.NoError(t, err)
+
+	missing := populateDataModelFromNonce(2)
+	missing.ID = d.ID + 1
+`
+	otherInsertCode := `
+	other.ID, err = repo.Insert(ctx, other)
+	require.NoError(t, err)
+`
+	if hasCustomPrimaryKey(modelStruct) {
+		byKey = "ByPK"
+		insertCode = `
+	_, err = repo.Insert(ctx, d)
+	require.NoError(t, err)
+
+	missing := populateDataModelFromNonce(2)
+`
+
+		pkFields := primaryKeyFields(modelStruct)
+		otherInsertCode = `
+	otherPK, err := repo.Insert(ctx, other)
+	require.NoError(t, err)
+`
+		if len(pkFields) == 1 {
+			insertCode = strings.Replace(insertCode, "_, err =", "d." + pkFields[0].Name + ", err =", 1)
+			otherInsertCode = `
+	other.` + pkFields[0].Name + `, err = repo.Insert(ctx, other)
+	require.NoError(t, err)
+`
+		} else {
+			for _, f := range pkFields {
+				otherInsertCode += "\tother." + f.Name + " = otherPK." + f.Name + "\n"
+			}
+		}
+	}
+
+	// The row is updated with the value of its own key, as the model may
+	// have no other fields to update
+	pkField := primaryKeyFields(modelStruct)[0]
+
+	// Inserting the same model twice is a duplicate of its unique fields
+	// (which are populated once per model) or of its primary key
+	duplicateCode := ""
+	if hasUniqueFields(modelStruct) || hasCustomPrimaryKey(modelStruct) {
+		duplicateCode = `
+	_, err = repo.Insert(ctx, d)
+	require.ErrorIs(t, err, lib.ErrDuplicateKey)
+`
+
+		// Updating another row to the first unique key (or the primary key)
+		// of the row is also a duplicate
+		dupKey := primaryKey(modelStruct)
+		if keys, err := uniqueKeys(modelStruct); err == nil && len(keys) > 0 {
+			dupKey = keys[0]
+		}
+
+		var dupUpdates string
+		for i, c := range dupKey.Columns {
+			dupUpdates += "\t\t\"" + c + "\": d." + dupKey.Fields[i] + ",\n"
+		}
+
+		duplicateCode += `
+	other := populateDataModelFromNonce(4)` + otherInsertCode + `
+	err = repo.Update` + byKey + `(ctx, ` + primaryKeyArgsCode(modelStruct, "other") + versionArgCode(modelStruct, "0") + `, map[string]any{
+` + dupUpdates + `	})
+	require.ErrorIs(t, err, lib.ErrDuplicateKey)
+`
+	}
+
+	return gopkg.DeclFunc{
+		Name: "TestErrors",
+		Args: []gopkg.DeclVar{
+			testingArg(),
+		},
+		BodyTmpl: `
+	gotest_time.SetTimeNowForTesting(t)
+
+	ctx, repo := openRepository(t)
+
+	var err error
+	d := populateDataModelFromNonce(1)
+` + insertCode + `
+	_, err = repo.Select` + byKey + `(ctx, ` + primaryKeyArgsCode(modelStruct, "missing") + `)
+	require.ErrorIs(t, err, lib.ErrNotFound)
+
+	err = repo.Update` + byKey + `(ctx, ` + primaryKeyArgsCode(modelStruct, "missing") + versionArgCode(modelStruct, "0") + `, map[string]any{
+		"` + columnName(pkField) + `": missing.` + pkField.Name + `,
+	})
+	require.ErrorIs(t, err, lib.ErrNotFound)
+
+	err = repo.Delete` + byKey + `(ctx, ` + primaryKeyArgsCode(modelStruct, "missing") + `)
+	require.ErrorIs(t, err, lib.ErrNotFound)
+
+	_, err = repo.Select(ctx, map[string]any{
+		"not_a_field": 1,
+	})
+	var unknownField *lib.UnknownFieldError
+	require.ErrorAs(t, err, &unknownField)
+	require.Equal(t, "not_a_field", unknownField.Field)
+
+	_, err = repo.Update(ctx, map[string]any{
+		"not_a_field": 1,
+	}, nil)
+	require.ErrorIs(t, err, lib.ErrUnknownField)
+
+	_, err = repo.Insert(ctx, populateDataModelFromNonce(3))
+	require.NoError(t, err)
+
+	_, err = repo.SelectPage(ctx, lib.SelectOptions{MaxRows: 1}, nil)
+	require.ErrorIs(t, err, lib.ErrTooManyRows)
+` + duplicateCode,
+	}
+}
+
+// testfuncRepository returns the test of the `Repository` returned by
+// `NewRepository`, which checks that it reads and writes the same rows as the
+// package level methods
+func testfuncRepository(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) gopkg.DeclFunc {
+
+	dbcrudAlias := strcase.ToSnake(modelName)
+	dbModelType := d.Import.Alias + "." + modelName
+
+	ctxAndDbArgs := `ctx, db`
+	if d.UseDBContext {
+		ctxAndDbArgs = `ctx`
+	}
+
+	return gopkg.DeclFunc{
+		Name: "TestRepository",
+		Args: []gopkg.DeclVar{
+			testingArg(),
+		},
+		BodyData: d,
+		BodyTmpl: `
+	gotest_time.SetTimeNowForTesting(t)
+
+	db := ` + openTestDBCode(d, modelStruct) + `
+{{- if .BodyData.UseDBContext}}
+	ctx := lib.ContextWithDB(context.Background(), db)
+{{- else}}
+	ctx := context.Background()
+{{- end}}
+
+	repo := ` + dbcrudAlias + `.NewRepository(db)
+
+	_, err := repo.InsertMany(ctx, []` + dbModelType + `{
+		populateDataModelFromNonce(11),
+		populateDataModelFromNonce(21),
+	})
+	require.NoError(t, err)
+
+	expected, err := ` + dbcrudAlias + `.Select(` + ctxAndDbArgs + `, nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(expected))
+
+	actual, err := repo.Select(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, len(expected), len(actual))
+
+	for i := range actual {
+		` + assertModelsEqualCode(modelStruct, "expected[i]", "actual[i]", `fmt.Sprint(i) + "th element not equal"`) + `
+	}
+
+	n, err := repo.Delete(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), n)
+
+	actual, err = ` + dbcrudAlias + `.Select(` + ctxAndDbArgs + `, nil)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(actual))
+`,
+	}
+}
+
+// testfuncMockRepository returns the test of the `MockRepository` generated
+// with `--mocks`, which checks that it returns the values set for the calls
+// expected of it, and records the calls made to it
+func testfuncMockRepository(
+	d pkgDef,
+	modelName string,
+) gopkg.DeclFunc {
+
+	dbcrudAlias := strcase.ToSnake(modelName)
+	dbModelType := d.Import.Alias + "." + modelName
+
+	return gopkg.DeclFunc{
+		Name: "TestMockRepository",
+		Args: []gopkg.DeclVar{
+			testingArg(),
+		},
+		BodyTmpl: `
+	ctx := context.Background()
+
+	mock := ` + dbcrudAlias + `.NewMockRepository(t)
+	var repo ` + dbcrudAlias + `.Repository = mock
+
+	expected := []` + dbModelType + `{
+		populateDataModelFromNonce(11),
+	}
+	mock.ExpectSelect(map[string]any{"some_field": "some_value"}).Return(expected, nil)
+
+	deleteErr := errors.New("delete failed")
+	mock.ExpectDelete(lib.MockAny).Return(0, deleteErr).Times(2)
+
+	actual, err := repo.Select(ctx, map[string]any{"some_field": "some_value"})
+	require.NoError(t, err)
+	require.Equal(t, expected, actual)
+
+	for i := 0; i < 2; i++ {
+		_, err = repo.Delete(ctx, map[string]any{"some_field": i})
+		require.ErrorIs(t, err, deleteErr)
+	}
+
+	mock.Mock.AssertCalled("Select", map[string]any{"some_field": "some_value"})
+	mock.Mock.AssertNumberOfCalls("Delete", 2)
+	require.Equal(
+		t,
+		[][]any{
+			{map[string]any{"some_field": 0}},
+			{map[string]any{"some_field": 1}},
+		},
+		mock.Mock.Calls("Delete"),
+	)
+`,
+	}
+}
+
+func testHelperMethods(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) ([]gopkg.DeclFunc, error) {
+
+	dbcrudAlias := strcase.ToSnake(modelName)
+	dbModelType := d.Import.Alias + "." + modelName
+
+	// Unique fields are given a new value every time a model is populated (so
+	// that populating from the same nonce many times does not give duplicate
+	// keys), and are left out of queries as a result
+	populateValues := make(map[string]string)
+	fieldVaules := make(map[string]string)
+	fieldColumns := make(map[string]string)
+	uniqueFields := make([]string, 0, len(modelStruct.Fields))
+	nullableFields := make([]nullableTestField, 0, len(modelStruct.Fields))
+	specialTimeFields := make([]string, 0, len(modelStruct.Fields))
+	dbTimestampFields := make([]string, 0, len(modelStruct.Fields))
+	for _, f := range modelStruct.Fields {
+		if isAutoIDField(f) {
+			continue
+		}
+
+		// Rows are populated as not deleted, so that they are selected
+		if isSoftDeleteField(f) {
+			continue
+		}
+
+		// Foreign keys which reference the model itself are left null, as
+		// the tests can't know which rows exist when a row is populated
+		if isSelfReferenceField(f, modelName) {
+			continue
+		}
+
+		// Rows are inserted at version 0, and the version is bumped by every
+		// update, so it is left out when comparing models (see
+		// `withoutVersion`) other than in the tests of versions
+		if isVersionField(f) {
+			continue
+		}
+
+		// Primary key fields are also given a new value every time, but are
+		// compared as the tests select rows by their keys
+		if isPKField(f) {
+			val := "lib.NewUUID()"
+			if !isUUIDField(f) {
+				var err error
+				val, err = randomDataForFieldType(f.Type, d.PkgTypes, "uniqueNonce()")
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			populateValues[f.Name] = val
+			continue
+		}
+
+		// Timestamps set by the DB cannot be known by the tests, and so are
+		// left out when comparing models (see `withoutDBTimestamps`)
+		if isDBTimestampField(f) {
+			dbTimestampFields = append(dbTimestampFields, f.Name)
+			continue
+		}
+
+		if isAppTimestampField(f) {
+			specialTimeFields = append(specialTimeFields, f.Name)
+			continue
+		}
+
+		// Foreign keys always reference the row inserted into each of the
+		// referenced tables when the test DB is opened (see `openTestDB`)
+		if isForeignKeyField(f) {
+			if _, ok := nullableValueType(f.Type); ok {
+				nullable, err := makeNullableTestField(f, d.PkgTypes, "nonce")
+				if err != nil {
+					return nil, err
+				}
+
+				nullable.Value = "1"
+				nullableFields = append(nullableFields, nullable)
+				continue
+			}
+
+			populateValues[f.Name] = "1"
+			continue
+		}
+
+		if _, ok := nullableValueType(f.Type); ok {
+			nonce := "nonce"
+			if isUniqueField(f) {
+				nonce = "uniqueNonce()"
+				uniqueFields = append(uniqueFields, f.Name)
+			}
+
+			nullable, err := makeNullableTestField(f, d.PkgTypes, nonce)
+			if err != nil {
+				return nil, err
+			}
+
+			nullableFields = append(nullableFields, nullable)
+			continue
+		}
+
+		if isUniqueField(f) {
+			val, err := randomDataForFieldType(f.Type, d.PkgTypes, "uniqueNonce()")
+			if err != nil {
+				return nil, err
+			}
+
+			populateValues[f.Name] = val
+			uniqueFields = append(uniqueFields, f.Name)
+			continue
+		}
+
+		val, err := randomDataForFieldType(f.Type, d.PkgTypes, "nonce")
+		if err != nil {
+			return nil, err
+		}
+
+		populateValues[f.Name] = val
+		fieldVaules[f.Name] = val
+		fieldColumns[f.Name] = columnName(f)
+	}
+
+	modelType := gopkg.TypeNamed{
+		Name: modelName,
+		Import: d.Import.Import,
+	}
+	timeType := gopkg.TypeNamed{
+		Name: "Time",
+		Import: "time",
+	}
+
+	timestampsHelper := gopkg.DeclFunc{
+		Name: "populateDataModelFromNonceWithIDAndTimestamp",
+		Args: []gopkg.DeclVar{
+			{
+				Name: "nonce",
+				Type: gopkg.TypeInt64{},
+			},
+			{
+				Name: "id",
+				Type: gopkg.TypeInt64{},
+			},
+			{
+				Name: "t",
+				Type: timeType,
+			},
+		},
+		ReturnArgs: tmpl.UnnamedReturnArgs(modelType),
+		BodyData: specialTimeFields,
+		BodyTmpl: `
+	d := populateDataModelFromNonce(nonce)
+	d.ID = id
+{{- range .BodyData}}
+	d.{{.}} = t.Round(gotest_time.Second)
+{{- end}}
+	return d
+`,
+	}
+
+	// The rows of models with a custom primary key are inserted with keys set
+	// by the tests, so the expected rows are the inserted models with their
+	// timestamps set, rather than populated models with their IDs set
+	if hasCustomPrimaryKey(modelStruct) {
+		timestampsHelper = gopkg.DeclFunc{
+			Name: "withTimestamps",
+			Args: []gopkg.DeclVar{
+				{
+					Name: "d",
+					Type: modelType,
+				},
+				{
+					Name: "t",
+					Type: timeType,
+				},
+			},
+			ReturnArgs: tmpl.UnnamedReturnArgs(modelType),
+			BodyData: specialTimeFields,
+			BodyTmpl: `
+{{- range .BodyData}}
+	d.{{.}} = t.Round(gotest_time.Second)
+{{- end}}
+	return d
+`,
+		}
+	}
+
+	helpers := []gopkg.DeclFunc{
+		{
+			Name: "populateDataModelFromNonce",
+			Args: []gopkg.DeclVar{
+				{
+					Name: "nonce",
+					Type: gopkg.TypeInt64{},
+				},
+			},
+			ReturnArgs: tmpl.UnnamedReturnArgs(
+				gopkg.TypeNamed{
+					Name: modelName,
+					Import: d.Import.Import,
+				},
+			),
+			BodyData: struct{
+				Values map[string]string
+				NotNull []nullableTestField
+				Nullable []nullableTestField
+			}{
+				Values: populateValues,
+				NotNull: notNullFields(nullableFields),
+				Nullable: nullFields(nullableFields),
+			},
+			BodyTmpl: `
+{{- if or .BodyData.NotNull .BodyData.Nullable}}
+	d := ` + dbModelType + `{
+{{- range $field, $val := .BodyData.Values}}
+		{{$field}}: {{$val}},
+{{- end}}
+	}
+{{- range .BodyData.NotNull}}
+{{.AssignCode "\t"}}
+{{- end}}
+{{- if .BodyData.Nullable}}
+
+	// Nullable fields are left null for every third nonce
+	if nonce%3 != 0 {
+{{- range .BodyData.Nullable}}
+{{.AssignCode "\t\t"}}
+{{- end}}
+	}
+{{- end}}
+
+	return d
+{{- else}}
+	return ` + dbModelType + `{
+{{- range $field, $val := .BodyData.Values}}
+		{{$field}}: {{$val}},
+{{- end}}
+	}
+{{- end}}
+`,
+		},
+		timestampsHelper,
+		{
+			Name: "typedQueryFromNonce",
+			Args: []gopkg.DeclVar{
+				{
+					Name: "nonce",
+					Type: gopkg.TypeInt64{},
+				},
+			},
+			ReturnArgs: tmpl.UnnamedReturnArgs(
+				gopkg.TypeNamed{
+					Name: "Query",
+					Import: path.Join(d.Import.Import, dbcrudAlias),
+				},
+			),
+			BodyData: struct{
+				Values map[string]string
+				Columns map[string]string
+				Nullable []nullableTestField
+			}{
+				Values: fieldVaules,
+				Columns: fieldColumns,
+				Nullable: nonUniqueNullableFields(nullableFields),
+			},
+			BodyTmpl: `
+	q := ` + dbcrudAlias + `.Where()
+{{- range $field, $val := .BodyData.Values}}
+	q = q.{{$field}}Eq({{$val}})
+{{- end}}
+{{- if .BodyData.Nullable}}
+
+	d := populateDataModelFromNonce(nonce)
+{{- range .BodyData.Nullable}}
+	q = q.{{.Name}}Eq(d.{{.Name}})
+{{- end}}
+{{- end}}
+	return q
+`,
+		},
+		{
+			Name: "queryFromNonce",
+			Args: []gopkg.DeclVar{
+				{
+					Name: "nonce",
+					Type: gopkg.TypeInt64{},
+				},
+			},
+			ReturnArgs: tmpl.UnnamedReturnArgs(
+				gopkg.TypeMap{
+					KeyType: gopkg.TypeString{},
+					ValueType: gopkg.TypeAny{},
+				},
+			),
+			BodyData: struct{
+				Values map[string]string
+				Columns map[string]string
+				Nullable []nullableTestField
+			}{
+				Values: fieldVaules,
+				Columns: fieldColumns,
+				Nullable: nonUniqueNullableFields(nullableFields),
+			},
+			BodyTmpl: `
+{{- if .BodyData.Nullable}}
+	q := map[string]any{
+{{- range $field, $val := .BodyData.Values}}
+		"{{index $.BodyData.Columns $field}}": {{$val}},
+{{- end}}
+	}
+
+	d := populateDataModelFromNonce(nonce)
+{{- range .BodyData.Nullable}}
+	q["{{.Column}}"] = d.{{.Name}}
+{{- end}}
+	return q
+{{- else}}
+	return map[string]any{
+{{- range $field, $val := .BodyData.Values}}
+		"{{index $.BodyData.Columns $field}}": {{$val}},
+{{- end}}
+	}
+{{- end}}
+`,
+		},
+	}
+
+	if len(dbTimestampFields) > 0 {
+		helpers = append(helpers, gopkg.DeclFunc{
+			Name: "withoutDBTimestamps",
+			Args: []gopkg.DeclVar{
+				{
+					Name: "d",
+					Type: gopkg.TypeNamed{
+						Name: modelName,
+						Import: d.Import.Import,
+					},
+				},
+			},
+			ReturnArgs: tmpl.UnnamedReturnArgs(
+				gopkg.TypeNamed{
+					Name: modelName,
+					Import: d.Import.Import,
+				},
+			),
+			BodyData: dbTimestampFields,
+			BodyTmpl: `
+	var zero ` + dbModelType + `
+{{- range .BodyData}}
+	d.{{.}} = zero.{{.}}
+{{- end}}
+	return d
+`,
+		})
+	}
+
+	if f, ok := versionField(modelStruct); ok {
+		helpers = append(helpers, gopkg.DeclFunc{
+			Name: "withoutVersion",
+			Args: []gopkg.DeclVar{
+				{
+					Name: "d",
+					Type: modelType,
+				},
+			},
+			ReturnArgs: tmpl.UnnamedReturnArgs(modelType),
+			BodyTmpl: `
+	d.` + f.Name + ` = 0
+	return d
+`,
+		})
+	}
+
+	if usesUniqueNonce(modelStruct) {
+		helpers = append(helpers, gopkg.DeclFunc{
+			Name: "uniqueNonce",
+			ReturnArgs: tmpl.UnnamedReturnArgs(
+				gopkg.TypeInt64{},
+			),
+			BodyTmpl: `
+	uniqueNonceCounter++
+	return uniqueNonceCounter
+`,
+		})
+	}
+
+	if len(uniqueFields) == 0 {
+		return helpers, nil
+	}
+
+	return append(
+		helpers,
+		gopkg.DeclFunc{
+			Name: "withoutUniqueFields",
+			Args: []gopkg.DeclVar{
+				{
+					Name: "d",
+					Type: gopkg.TypeNamed{
+						Name: modelName,
+						Import: d.Import.Import,
+					},
+				},
+			},
+			ReturnArgs: tmpl.UnnamedReturnArgs(
+				gopkg.TypeNamed{
+					Name: modelName,
+					Import: d.Import.Import,
+				},
+			),
+			BodyData: uniqueFields,
+			BodyTmpl: `
+	var zero ` + dbModelType + `
+{{- range .BodyData}}
+	d.{{.}} = zero.{{.}}
+{{- end}}
+	return d
+`,
+		},
+		gopkg.DeclFunc{
+			Name: "withUniqueFieldsOf",
+			Args: []gopkg.DeclVar{
+				{
+					Name: "d",
+					Type: gopkg.TypeNamed{
+						Name: modelName,
+						Import: d.Import.Import,
+					},
+				},
+				{
+					Name: "from",
+					Type: gopkg.TypeNamed{
+						Name: modelName,
+						Import: d.Import.Import,
+					},
+				},
+			},
+			ReturnArgs: tmpl.UnnamedReturnArgs(
+				gopkg.TypeNamed{
+					Name: modelName,
+					Import: d.Import.Import,
+				},
+			),
+			BodyData: uniqueFields,
+			BodyTmpl: `
+{{- range .BodyData}}
+	d.{{.}} = from.{{.}}
+{{- end}}
+	return d
+`,
+		},
+	), nil
+}
+
+// testDepRow is a row inserted into the table of a model which the tested
+// model depends on, so that foreign keys in the tests can reference it
+type testDepRow struct {
+	Alias string
+	ModelType string
+	Assigns []string
+	// Repository is the var of the fake repository of the model, and
+	// Parents are the fake repositories it is constructed with
+	Repository string
+	Parents string
+	// DeletedAssigns are set for models with soft deletes, for which a
+	// second row (with id 2) is inserted and soft deleted
+	DeletedAssigns []string
+}
+
+// testDepRows returns the rows (each with id 1) inserted into the tables the
+// model depends on, in the order the tables depend on each other, along with
+// the imports of the packages of those tables
+func testDepRows(
+	d pkgDef,
+	modelName string,
+) ([]testDepRow, []gopkg.ImportAndAlias, error) {
+
+	deps, err := modelDependencies(d.DBDataModels, modelName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows := make([]testDepRow, 0, len(deps))
+	imports := make([]gopkg.ImportAndAlias, 0, len(deps))
+	for _, dep := range deps {
+		depStruct, ok := dep.Type.(gopkg.TypeStruct)
+		if !ok {
+			return nil, nil, errors.New("found datamodel which is not of type struct")
+		}
+
+		parents, err := fakeParents(d, dep.Name, depStruct)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		parentFields := make([]string, 0, len(parents))
+		for _, p := range parents {
+			parentFields = append(parentFields, p.Field)
+		}
+
+		row := testDepRow{
+			Alias: strcase.ToSnake(dep.Name),
+			ModelType: d.Import.Alias + "." + dep.Name,
+			Repository: fakeParentField(dep.Name),
+			Parents: strings.Join(parentFields, ", "),
+		}
+
+		row.Assigns, err = testDepRowAssigns(d, depStruct, "1")
+		if err != nil {
+			return nil, nil, err
+		}
+
+		_, softDelete := softDeleteField(depStruct)
+		if softDelete && !hasCustomPrimaryKey(depStruct) {
+			row.DeletedAssigns, err = testDepRowAssigns(d, depStruct, "2")
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
+		rows = append(rows, row)
+		imports = append(imports, gopkg.ImportAndAlias{
+			Import: path.Join(d.Import.Import, row.Alias),
+			Alias: row.Alias,
+		})
+	}
+
+	return rows, imports, nil
+}
+
+// testDepRowAssigns returns the code which populates the fields of the row
+// `d` of a table the model depends on from `nonce`, other than its foreign
+// keys, which reference the rows with id 1
+func testDepRowAssigns(
+	d pkgDef,
+	depStruct gopkg.TypeStruct,
+	nonce string,
+) ([]string, error) {
+
+	var assigns []string
+	for _, f := range depStruct.Fields {
+		if f.Name == "ID" || isTimestampField(f) {
+			continue
+		}
+
+		fieldNonce := nonce
+		if isForeignKeyField(f) {
+			fieldNonce = "1"
+		}
+
+		if _, ok := nullableValueType(f.Type); ok {
+			if !isNullableColumn(f) {
+				nullable, err := makeNullableTestField(f, d.PkgTypes, fieldNonce)
+				if err != nil {
+					return nil, err
+				}
+
+				assigns = append(assigns, nullable.AssignCode("\t\t"))
+			}
+			continue
+		}
+
+		val, err := randomDataForFieldType(f.Type, d.PkgTypes, fieldNonce)
+		if err != nil {
+			return nil, err
+		}
+
+		assigns = append(assigns, "\t\td." + f.Name + " = " + val)
+	}
+
+	return assigns, nil
+}
+
+// testOpenDBHelper returns the `openTestDB` helper for models with foreign
+// keys, which opens the test DB and inserts a row (with id 1) into each of the
+// tables the model depends on (along with a soft deleted row with id 2 into
+// those with soft deletes), and the imports of the packages of those tables
+func testOpenDBHelper(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) ([]gopkg.DeclFunc, []gopkg.ImportAndAlias, error) {
+
+	keys, err := foreignKeys(modelStruct)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, nil, nil
+	}
+
+	rows, imports, err := testDepRows(d, modelName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctxAndDbArgs := `ctx, db`
+	if d.UseDBContext {
+		ctxAndDbArgs = `ctx`
+	}
+
+	return []gopkg.DeclFunc{
+		{
+			Name: "openTestDB",
+			Args: []gopkg.DeclVar{
+				testingArg(),
+			},
+			ReturnArgs: tmpl.UnnamedReturnArgs(
+				gopkg.TypePointer{
+					ValueType: gopkg.TypeNamed{
+						Name: "DB",
+						Import: "database/sql",
+					},
+				},
+			),
+			BodyData: struct{
+				UseDBContext bool
+				Rows []testDepRow
+			}{
+				UseDBContext: d.UseDBContext,
+				Rows: rows,
+			},
+			BodyTmpl: `
+	db := ` + openSchemaDBCode(d) + `
+{{- if .BodyData.UseDBContext}}
+	ctx := lib.ContextWithDB(context.Background(), db)
+{{- else}}
+	ctx := context.Background()
+{{- end}}
+
+	// Foreign keys in the tests reference these rows, which are inserted in
+	// the order the tables depend on each other
+{{- range .BodyData.Rows}}
+	{
+		d := {{.ModelType}}{}
+{{- range .Assigns}}
+{{.}}
+{{- end}}
+		_, err := {{.Alias}}.Insert(` + ctxAndDbArgs + `, d)
+		require.NoError(t, err)
+{{- if .DeletedAssigns}}
 
-			require.Equal(t, len(test.Expected), len(actual))
+		// Rows which reference the second row are left out of joins, as it
+		// is soft deleted
+		d = {{.ModelType}}{}
+{{- range .DeletedAssigns}}
+{{.}}
+{{- end}}
+		_, err = {{.Alias}}.Insert(` + ctxAndDbArgs + `, d)
+		require.NoError(t, err)
 
-			for i := range actual {
-				assert.LogicallyEqual(t, test.Expected[i], actual[i], fmt.Sprint(i) + "th element not equal")
-			}
-		})
+		err = {{.Alias}}.DeleteByID(` + ctxAndDbArgs + `, 2)
+		require.NoError(t, err)
+{{- end}}
 	}
+{{- end}}
+
+	return db
 `,
+		},
+	}, imports, nil
+}
+
+// testRepositoryOpenerType returns the `repositoryOpener` type of the tests
+// which are run against each implementation of the `Repository`, which opens
+// an empty repository along with the context to call it with
+func testRepositoryOpenerType(
+	dbcrudImport string,
+) gopkg.DeclType {
+
+	return gopkg.DeclType{
+		Name: "repositoryOpener",
+		Type: gopkg.TypeFunc{
+			Args: []gopkg.DeclVar{
+				testingArg(),
+			},
+			ReturnArgs: testRepositoryOpenerReturnArgs(dbcrudImport),
+		},
 	}
 }
 
-func testHelperMethods(
+// testRepositoryOpenerReturnArgs returns the return args of a
+// `repositoryOpener`
+func testRepositoryOpenerReturnArgs(
+	dbcrudImport string,
+) []gopkg.DeclVar {
+
+	return tmpl.UnnamedReturnArgs(
+		ctxArg().Type,
+		gopkg.TypeNamed{
+			Name: "Repository",
+			Import: dbcrudImport,
+		},
+	)
+}
+
+// testRepositoryHelpers returns the helpers which run a test against both
+// the `sqlRepository` on a test DB and the `fakeRepository`, each opened
+// with the same rows in the tables the model depends on
+func testRepositoryHelpers(
 	d pkgDef,
 	modelName string,
 	modelStruct gopkg.TypeStruct,
 ) ([]gopkg.DeclFunc, error) {
 
-	dbModelType := d.Import.Alias + "." + modelName
-
-	fieldVaules := make(map[string]string)
-	specialTimeFields := make([]string, 0, len(modelStruct.Fields))
-	for _, f := range modelStruct.Fields {
-		specialFields := map[string]bool{
-			"ID": true,
-			"InsertedAt": true,
-			"UpdatedAt": true,
-		}
+	dbcrudAlias := strcase.ToSnake(modelName)
+	dbcrudImport := path.Join(d.Import.Import, dbcrudAlias)
 
-		if specialFields[f.Name] {
-			if f.Name != "ID" {
-				specialTimeFields = append(specialTimeFields, f.Name)
-			}
-			continue
-		}
+	parents, err := fakeParents(d, modelName, modelStruct)
+	if err != nil {
+		return nil, err
+	}
 
-		val, err := randomDataForFieldType(f.Type, d.PkgTypes)
+	var rows []testDepRow
+	if len(parents) > 0 {
+		rows, _, err = testDepRows(d, modelName)
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		fieldVaules[f.Name] = val
+	parentFields := make([]string, 0, len(parents))
+	for _, p := range parents {
+		parentFields = append(parentFields, p.Field)
+	}
+
+	sqlRepository := `
+	db := ` + openTestDBCode(d, modelStruct) + `
+	return context.Background(), ` + dbcrudAlias + `.NewRepository(db)
+`
+	if d.UseDBContext {
+		sqlRepository = `
+	db := ` + openTestDBCode(d, modelStruct) + `
+	return context.Background(), ` + dbcrudAlias + `.NewRepository(db)
+`
 	}
 
 	return []gopkg.DeclFunc{
 		{
-			Name: "populateDataModelFromNonce",
+			Name: "runWithRepositories",
 			Args: []gopkg.DeclVar{
+				testingArg(),
 				{
-					Name: "nonce",
-					Type: gopkg.TypeInt64{},
+					Name: "test",
+					Type: gopkg.TypeFunc{
+						Args: tmpl.UnnamedReturnArgs(
+							testingArg().Type,
+							gopkg.TypeNamed{
+								Name: "repositoryOpener",
+							},
+						),
+					},
 				},
 			},
-			ReturnArgs: tmpl.UnnamedReturnArgs(
-				gopkg.TypeNamed{
-					Name: modelName,
-					Import: d.Import.Import,
-				},
-			),
-			BodyData: fieldVaules,
 			BodyTmpl: `
-	return ` + dbModelType + `{
-{{- range $field, $val := .BodyData}}
-		{{$field}}: {{$val}},
-{{- end}}
-	}
+	t.Run("sql", func(t *testing.T) {
+		test(t, openSQLRepository)
+	})
+
+	t.Run("fake", func(t *testing.T) {
+		test(t, openFakeRepository)
+	})
 `,
 		},
 		{
-			Name: "populateDataModelFromNonceWithIDAndTimestamp",
+			Name: "openSQLRepository",
 			Args: []gopkg.DeclVar{
-				{
-					Name: "nonce",
-					Type: gopkg.TypeInt64{},
-				},
-				{
-					Name: "id",
-					Type: gopkg.TypeInt64{},
-				},
-				{
-					Name: "t",
-					Type: gopkg.TypeNamed{
-						Name: "Time",
-						Import: "time",
-					},
-				},
+				testingArg(),
 			},
-			ReturnArgs: tmpl.UnnamedReturnArgs(
-				gopkg.TypeNamed{
-					Name: modelName,
-					Import: d.Import.Import,
-				},
-			),
-			BodyData: specialTimeFields,
-			BodyTmpl: `
-	d := populateDataModelFromNonce(nonce)
-	d.ID = id
-{{- range .BodyData}}
-	d.{{.}} = t.Round(gotest_time.Second)
-{{- end}}
-	return d
-`,
+			ReturnArgs: testRepositoryOpenerReturnArgs(dbcrudImport),
+			BodyTmpl: sqlRepository,
 		},
 		{
-			Name: "queryFromNonce",
+			Name: "openFakeRepository",
 			Args: []gopkg.DeclVar{
-				{
-					Name: "nonce",
-					Type: gopkg.TypeInt64{},
-				},
+				testingArg(),
 			},
-			ReturnArgs: tmpl.UnnamedReturnArgs(
-				gopkg.TypeMap{
-					KeyType: gopkg.TypeString{},
-					ValueType: gopkg.TypeAny{},
-				},
-			),
-			BodyData: fieldVaules,
+			ReturnArgs: testRepositoryOpenerReturnArgs(dbcrudImport),
+			BodyData: rows,
 			BodyTmpl: `
-	return map[string]any{
-{{- range $field, $val := .BodyData}}
-		"{{ToSnake $field}}": {{$val}},
+{{- if .BodyData}}
+	ctx := context.Background()
+
+	// Foreign keys in the tests reference these rows, which are the same as
+	// those inserted by openTestDB
+{{- range .BodyData}}
+	{{.Repository}} := {{.Alias}}.NewFakeRepository({{.Parents}})
+	{
+		d := {{.ModelType}}{}
+{{- range .Assigns}}
+{{.}}
+{{- end}}
+		_, err := {{.Repository}}.Insert(ctx, d)
+		require.NoError(t, err)
+{{- if .DeletedAssigns}}
+
+		d = {{.ModelType}}{}
+{{- range .DeletedAssigns}}
+{{.}}
+{{- end}}
+		_, err = {{.Repository}}.Insert(ctx, d)
+		require.NoError(t, err)
+
+		err = {{.Repository}}.DeleteByID(ctx, 2)
+		require.NoError(t, err)
 {{- end}}
 	}
+{{- end}}
+
+	return ctx, ` + dbcrudAlias + `.NewFakeRepository(` + strings.Join(parentFields, ", ") + `)
+{{- else}}
+	return context.Background(), ` + dbcrudAlias + `.NewFakeRepository()
+{{- end}}
 `,
 		},
 	}, nil
 }
 
+// repositoryTests returns each of `tests` as a test which is run against
+// each implementation of the `Repository` by `runWithRepositories`, along
+// with the function it runs (which is the test's body, taking the
+// `repositoryOpener` as `openRepository`)
+func repositoryTests(
+	tests ...gopkg.DeclFunc,
+) []gopkg.DeclFunc {
+
+	functions := make([]gopkg.DeclFunc, 0, 2*len(tests))
+	for _, test := range tests {
+		name := "test" + strings.TrimPrefix(test.Name, "Test")
+
+		functions = append(functions, gopkg.DeclFunc{
+			Name: test.Name,
+			Args: test.Args,
+			BodyTmpl: `
+	runWithRepositories(t, ` + name + `)
+`,
+		})
+
+		test.Name = name
+		test.Args = append(
+			test.Args,
+			gopkg.DeclVar{
+				Name: "openRepository",
+				Type: gopkg.TypeNamed{
+					Name: "repositoryOpener",
+				},
+			},
+		)
+		functions = append(functions, test)
+	}
+
+	return functions
+}
+
+// testVars returns the package level vars needed by the test helpers
+func testVars(
+	modelStruct gopkg.TypeStruct,
+) []gopkg.DeclVar {
+
+	if !usesUniqueNonce(modelStruct) {
+		return nil
+	}
+
+	return []gopkg.DeclVar{
+		{
+			Name: "uniqueNonceCounter",
+			Type: gopkg.TypeInt64{},
+		},
+	}
+}
+
+// usesUniqueNonce returns true if the test helpers populate any field of the
+// model with a new value every time, which are the fields of unique keys and
+// primary keys (other than UUIDs)
+func usesUniqueNonce(
+	modelStruct gopkg.TypeStruct,
+) bool {
+
+	for _, f := range modelStruct.Fields {
+		if isUniqueField(f) || (isPKField(f) && !isUUIDField(f)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// nullableTestField is a nullable data model field as populated in the
+// generated tests
+type nullableTestField struct {
+	Name string
+	Column string
+	// Value is the go expression for the value of the field when not null
+	Value string
+	// ValueType is the type of the value pointed to by a pointer field
+	ValueType string
+	// NullType and ValueField are the name of the `sql.Null*` type of the
+	// field and the name of its value field, if the field is not a pointer
+	NullType string
+	ValueField string
+	Unique bool
+	// NotNull is set if the field is tagged `notnull`, in which case it is
+	// never populated with null
+	NotNull bool
+}
+
+// AssignCode returns the code which sets the field of the model `d` to its
+// (not null) value, with each line indented by `indent`
+func (f nullableTestField) AssignCode(indent string) string {
+
+	if f.NullType != "" {
+		return indent + "d." + f.Name + " = sql." + f.NullType + "{" + f.ValueField + ": " + f.Value + ", Valid: true}"
+	}
+
+	return indent + "d." + f.Name + " = new(" + f.ValueType + ")\n" +
+		indent + "*d." + f.Name + " = " + f.Value
+}
+
+func makeNullableTestField(
+	f gopkg.DeclVar,
+	enumTypes []gopkg.DeclType,
+	nonce string,
+) (nullableTestField, error) {
+
+	valueType, _ := nullableValueType(f.Type)
+
+	val, err := randomDataForFieldType(valueType, enumTypes, nonce)
+	if err != nil {
+		return nullableTestField{}, err
+	}
+
+	field := nullableTestField{
+		Name: f.Name,
+		Column: columnName(f),
+		Value: val,
+		Unique: isUniqueField(f),
+		NotNull: !isNullableColumn(f),
+	}
+
+	if nullType, ok := sqlNullType(f.Type); ok {
+		field.NullType = nullType.Name
+		field.ValueField = sqlNullTypes[nullType.Name].ValueField
+		return field, nil
+	}
+
+	field.ValueType, err = testTypeCode(valueType)
+	if err != nil {
+		return nullableTestField{}, err
+	}
+
+	return field, nil
+}
+
+func notNullFields(
+	fields []nullableTestField,
+) []nullableTestField {
+
+	notNull := make([]nullableTestField, 0, len(fields))
+	for _, f := range fields {
+		if f.NotNull {
+			notNull = append(notNull, f)
+		}
+	}
+
+	return notNull
+}
+
+func nullFields(
+	fields []nullableTestField,
+) []nullableTestField {
+
+	nullable := make([]nullableTestField, 0, len(fields))
+	for _, f := range fields {
+		if !f.NotNull {
+			nullable = append(nullable, f)
+		}
+	}
+
+	return nullable
+}
+
+func nonUniqueNullableFields(
+	fields []nullableTestField,
+) []nullableTestField {
+
+	nonUnique := make([]nullableTestField, 0, len(fields))
+	for _, f := range fields {
+		if !f.Unique {
+			nonUnique = append(nonUnique, f)
+		}
+	}
+
+	return nonUnique
+}
+
+// assertModelsEqualCode returns the code which asserts that the models
+// `expected` and `actual` are equal in the generated tests, ignoring the
+// values of any unique fields and timestamps set by the DB
+func assertModelsEqualCode(
+	modelStruct gopkg.TypeStruct,
+	expected string,
+	actual string,
+	msgAndArgs ...string,
+) string {
+
+	if hasUniqueFields(modelStruct) {
+		expected = "withoutUniqueFields(" + expected + ")"
+		actual = "withoutUniqueFields(" + actual + ")"
+	}
+
+	if hasDBTimestampFields(modelStruct) {
+		expected = "withoutDBTimestamps(" + expected + ")"
+		actual = "withoutDBTimestamps(" + actual + ")"
+	}
+
+	if _, ok := versionField(modelStruct); ok {
+		expected = "withoutVersion(" + expected + ")"
+		actual = "withoutVersion(" + actual + ")"
+	}
+
+	args := append([]string{"t", expected, actual}, msgAndArgs...)
+	return "assert.LogicallyEqual(" + strings.Join(args, ", ") + ")"
+}
+
+// testMainPostgres returns the `TestMain` func which runs the tests against
+// an embedded postgres server
+func testMainPostgres() gopkg.DeclFunc {
+	return gopkg.DeclFunc{
+		Name: "TestMain",
+		Args: []gopkg.DeclVar{
+			{
+				Name: "m",
+				Type: gopkg.TypePointer{
+					ValueType: gopkg.TypeNamed{
+						Name: "M",
+						Import: "testing",
+					},
+				},
+			},
+		},
+		BodyTmpl: `
+	os.Exit(postgres.Run(m))
+`,
+	}
+}
+
+// openTestDBCode returns the call which opens a fresh test DB with the
+// package schema applied
+func openTestDBCode(d pkgDef, modelStruct gopkg.TypeStruct) string {
+
+	if keys, _ := foreignKeys(modelStruct); len(keys) > 0 {
+		return `openTestDB(t)`
+	}
+
+	return openSchemaDBCode(d)
+}
+
+// openSchemaDBCode returns the call which opens a fresh test DB with the
+// package schema applied, without inserting any rows
+func openSchemaDBCode(d pkgDef) string {
+
+	return openDBCode(d, `"schema.sql"`)
+}
+
+// openDBCode returns the call which opens a fresh test DB with the schema at
+// the path `schemaPath` (a go expression) applied
+func openDBCode(d pkgDef, schemaPath string) string {
+
+	if d.Dialect == dialectPostgres {
+		return `postgres.Open(t, ` + schemaPath + `)`
+	}
+
+	if d.Dialect == dialectSqlite {
+		return `sqlite.Open(t, ` + schemaPath + `)`
+	}
+
+	return `sqltest.OpenMysql(t, ` + schemaPath + `)`
+}
+
+func testDBImports(d pkgDef) []gopkg.ImportAndAlias {
+
+	if d.Dialect == dialectPostgres {
+		return tmpl.UnnamedImports(
+			"github.com/thecodedproject/dbcrudgen/dbtest/postgres",
+			"os",
+		)
+	}
+
+	if d.Dialect == dialectSqlite {
+		return tmpl.UnnamedImports(
+			"github.com/thecodedproject/dbcrudgen/dbtest/sqlite",
+		)
+	}
+
+	return tmpl.UnnamedImports(
+		"github.com/thecodedproject/sqltest",
+	)
+}
+
 func testingArg() gopkg.DeclVar {
 	return gopkg.DeclVar{
 		Name: "t",
@@ -833,6 +4750,7 @@ func testingArg() gopkg.DeclVar {
 func randomDataForFieldType(
 	goType gopkg.Type,
 	enumTypes []gopkg.DeclType,
+	nonce string,
 ) (string, error) {
 
 	typeStr, err := goType.FullType(
@@ -846,21 +4764,21 @@ func randomDataForFieldType(
 
 	switch typeStr {
 	case "[]byte":
-		return `[]byte("some_bytes" + fmt.Sprint(nonce))`, nil
+		return `[]byte("some_bytes" + fmt.Sprint(` + nonce + `))`, nil
 	case "bool":
-		return `nonce%2==0`, nil
+		return nonce + `%2==0`, nil
 	case "float32":
-		return `float32(nonce)`, nil
+		return `float32(` + nonce + `)`, nil
 	case "float64":
-		return `float64(nonce)`, nil
+		return `float64(` + nonce + `)`, nil
 	case "int32":
-		return `int32(nonce)`, nil
+		return `int32(` + nonce + `)`, nil
 	case "int64":
-		return `nonce`, nil
+		return nonce, nil
 	case "string":
-		return `"some_str" + fmt.Sprint(nonce)`, nil
+		return `"some_str" + fmt.Sprint(` + nonce + `)`, nil
 	case "time.Time":
-		return `time.Unix(nonce, 0)`, nil
+		return `time.Unix(` + nonce + `, 0)`, nil
 	}
 
 	if t, ok := goType.(gopkg.TypeNamed); ok {
@@ -869,18 +4787,12 @@ func randomDataForFieldType(
 			return "", err
 		}
 
-		d, err := randomDataForFieldType(declT.Type, enumTypes)
+		d, err := randomDataForFieldType(declT.Type, enumTypes, nonce)
 		if err != nil {
 			return "", err
 		}
 
-		importElems := strings.Split(t.Import, "/")
-
-		enumTypeStr, err := t.FullType(
-			map[string]string{
-				t.Import: importElems[len(importElems)-1],
-			},
-		)
+		enumTypeStr, err := testTypeCode(t)
 		if err != nil {
 			return "", err
 		}
@@ -890,3 +4802,58 @@ func randomDataForFieldType(
 
 	return "", errors.New("cannot generate DB tests for go type " + typeStr)
 }
+
+// testTypeCode returns the go type as written in the generated tests
+func testTypeCode(goType gopkg.Type) (string, error) {
+
+	aliases := map[string]string{
+		"time": "time",
+	}
+
+	if t, ok := goType.(gopkg.TypeNamed); ok {
+		importElems := strings.Split(t.Import, "/")
+		aliases[t.Import] = importElems[len(importElems)-1]
+	}
+
+	return goType.FullType(aliases)
+}
+
+// primaryKeyArgsCode returns the args passed to the methods which take the
+// primary key of a row, for the key of the model `varName`
+func primaryKeyArgsCode(
+	modelStruct gopkg.TypeStruct,
+	varName string,
+) string {
+
+	fields := primaryKeyFields(modelStruct)
+
+	args := make([]string, 0, len(fields))
+	for _, f := range fields {
+		args = append(args, varName + "." + f.Name)
+	}
+
+	return strings.Join(args, ", ")
+}
+
+// versionArgCode returns the version arg passed to the update by key methods
+// of models with a version (preceded by a comma), set to `value`, or an empty
+// string for other models
+func versionArgCode(
+	modelStruct gopkg.TypeStruct,
+	value string,
+) string {
+
+	if _, ok := versionField(modelStruct); !ok {
+		return ""
+	}
+
+	return ", " + value
+}
+
+// versionFieldName returns the name of the version field of the model, or an
+// empty string if it has none
+func versionFieldName(modelStruct gopkg.TypeStruct) string {
+
+	f, _ := versionField(modelStruct)
+	return f.Name
+}
@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"go/format"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/iancoleman/strcase"
+)
+
+// embedVar is a var which embeds the files matching `Pattern`
+type embedVar struct {
+	Name string
+	// FS is set if the var is an `embed.FS`, rather than a string
+	FS bool
+	Pattern string
+	Doc string
+}
+
+// generateEmbedFiles writes the `db_embed.go` of the package and of each
+// model, which declare the vars embedding the schemas and migrations applied
+// by the generated `CreateAllTables`, `CreateTable` and `Migrate` methods.
+//
+// The files are written directly (as the schemas are), rather than with
+// gopkg, as gopkg has no way of declaring the `go:embed` directive of a var.
+func generateEmbedFiles(
+	d pkgDef,
+) error {
+
+	for _, m := range d.DBDataModels {
+		dir := strcase.ToSnake(m.Name)
+
+		err := writeEmbedFile(
+			filepath.Join(d.OutputPath, dir, "db_embed.go"),
+			dir,
+			embedVar{
+				Name: "Schema",
+				Pattern: "schema.sql",
+				Doc: "Schema is the `schema.sql` of the model, applied by `CreateTable`",
+			},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	vars := []embedVar{
+		{
+			Name: "Schema",
+			Pattern: "schema.sql",
+			Doc: "Schema is the `schema.sql` of the package, applied by `CreateAllTables`",
+		},
+	}
+
+	if d.MigrationsDir != "" {
+		vars = append(vars, embedVar{
+			Name: "Migrations",
+			FS: true,
+			Pattern: path.Join(filepath.ToSlash(d.MigrationsDir), "*.up.sql"),
+			Doc: "Migrations are the up migrations of the package, applied by `Migrate`",
+		})
+	}
+
+	return writeEmbedFile(
+		filepath.Join(d.OutputPath, "db_embed.go"),
+		d.Import.Alias,
+		vars...,
+	)
+}
+
+// writeEmbedFile writes the Go file `filePath` of the package `packageName`,
+// which declares `vars`
+func writeEmbedFile(
+	filePath string,
+	packageName string,
+	vars ...embedVar,
+) error {
+
+	embedImport := `_ "embed"`
+	for _, v := range vars {
+		if v.FS {
+			embedImport = `"embed"`
+		}
+	}
+
+	src := "package " + packageName + "\n\nimport " + embedImport + "\n"
+	for _, v := range vars {
+		varType := "string"
+		if v.FS {
+			varType = "embed.FS"
+		}
+
+		src += "\n// " + v.Doc + "\n//\n//go:embed " + v.Pattern + "\nvar " + v.Name + " " + varType + "\n"
+	}
+
+	formatted, err := format.Source([]byte(src))
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(filePath), 0755)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filePath, formatted, 0644)
+}
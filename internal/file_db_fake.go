@@ -0,0 +1,1226 @@
+package internal
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/iancoleman/strcase"
+	"github.com/thecodedproject/gopkg"
+	"github.com/thecodedproject/gopkg/tmpl"
+)
+
+// fileDBFake returns the `db_fake.go` of each model, which has the
+// `fakeRepository` implementation of the model's `Repository`, which holds
+// its rows in memory so that code depending on the repository can be tested
+// without a database
+func fileDBFake(d pkgDef) func() ([]gopkg.FileContents, error) {
+
+	return func() ([]gopkg.FileContents, error) {
+
+		files := make([]gopkg.FileContents, 0, len(d.DBDataModels))
+		for _, model := range d.DBDataModels {
+
+			dbcrudDir := strcase.ToSnake(model.Name)
+			dbcrudImport := path.Join(d.Import.Import, dbcrudDir)
+
+			imports := tmpl.UnnamedImports(
+				"errors",
+				"fmt",
+				"github.com/thecodedproject/dbcrudgen/lib",
+			)
+
+			modelName := model.Name
+			modelStruct, ok := model.Type.(gopkg.TypeStruct)
+			if !ok {
+				return nil, errors.New("found datamodel which is not of type struct")
+			}
+
+			for _, field := range modelStruct.Fields {
+				if isTimestampField(field) || isSoftDeleteField(field) {
+					imports = append(imports, d.Dialect.timeNowImports()...)
+					break
+				}
+			}
+
+			keys, err := uniqueKeys(modelStruct)
+			if err != nil {
+				return nil, err
+			}
+
+			crudMethods, _, err := dbCrudMethods(d, modelName, modelStruct, keys)
+			if err != nil {
+				return nil, err
+			}
+
+			parents, err := fakeParents(d, modelName, modelStruct)
+			if err != nil {
+				return nil, err
+			}
+
+			insert, err := fakeInsertMethod(d, modelName, modelStruct)
+			if err != nil {
+				return nil, err
+			}
+
+			functions := []gopkg.DeclFunc{
+				newFakeRepositoryMethod(parents),
+			}
+			for _, m := range repositoryMethods(crudMethods) {
+				fake, err := fakeMethod(d, modelName, modelStruct, keys, m)
+				if err != nil {
+					return nil, err
+				}
+
+				functions = append(functions, fake)
+			}
+			// Models with soft deletes restore rows with the unexported
+			// `updateIncludingDeleted`, as `Update` leaves deleted rows out
+			for _, m := range crudMethods {
+				if m.Name != "updateIncludingDeleted" {
+					continue
+				}
+
+				fake, err := fakeMethod(d, modelName, modelStruct, keys, m)
+				if err != nil {
+					return nil, err
+				}
+
+				functions = append(functions, fake)
+			}
+			functions = append(
+				functions,
+				insert,
+				fakeUpdateMethod(d, modelName, modelStruct),
+				fakeColumnValueMethod(d, modelName, modelStruct),
+				fakeSetColumnMethod(d, modelName, modelStruct),
+			)
+
+			files = append(files, gopkg.FileContents{
+				Filepath: filepath.Join(d.OutputPath, dbcrudDir, "db_fake.go"),
+				PackageName: dbcrudDir,
+				PackageImportPath: dbcrudImport,
+				Imports: imports,
+				Vars: []gopkg.DeclVar{
+					fakeUniqueKeysVar(modelStruct, keys),
+				},
+				Types: []gopkg.DeclType{
+					fakeRepositoryType(d, modelName, modelStruct, parents),
+				},
+				Functions: functions,
+			})
+		}
+
+		return files, nil
+	}
+}
+
+// fakeParent is the repository of a model referenced by the foreign keys of
+// another model, which its fake repository looks up referenced rows in
+type fakeParent struct {
+	Field string
+	Type gopkg.Type
+}
+
+// fakeParents returns the repositories of the models referenced by the
+// foreign keys of the model `modelName`, in the order they are first
+// referenced (leaving out the model itself, whose rows are looked up in the
+// fake)
+func fakeParents(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) ([]fakeParent, error) {
+
+	keys, err := foreignKeys(modelStruct)
+	if err != nil {
+		return nil, err
+	}
+
+	parents := make([]fakeParent, 0, len(keys))
+	seen := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		if seen[k.Model] || k.Model == modelName {
+			continue
+		}
+		seen[k.Model] = true
+
+		parents = append(parents, fakeParent{
+			Field: fakeParentField(k.Model),
+			Type: gopkg.TypeNamed{
+				Name: "Repository",
+				Import: path.Join(d.Import.Import, strcase.ToSnake(k.Model)),
+			},
+		})
+	}
+
+	return parents, nil
+}
+
+// fakeParentField returns the name of the field (and constructor arg) of a
+// fake repository which holds the repository of the model `parentModel`
+func fakeParentField(parentModel string) string {
+
+	return strcase.ToLowerCamel(parentModel) + "Repository"
+}
+
+// fakeRepositoryType returns the `fakeRepository` struct, which holds the
+// rows of the model (and the last ID assigned to them) along with the
+// repositories of the models it references
+func fakeRepositoryType(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+	parents []fakeParent,
+) gopkg.DeclType {
+
+	fields := []gopkg.DeclVar{
+		{
+			Name: "mu",
+			Type: gopkg.TypeNamed{
+				Name: "Mutex",
+				Import: "sync",
+			},
+		},
+		{
+			Name: "rows",
+			Type: gopkg.TypeArray{
+				ValueType: gopkg.TypeNamed{
+					Name: modelName,
+					Import: d.Import.Import,
+				},
+			},
+		},
+	}
+
+	if !hasCustomPrimaryKey(modelStruct) {
+		fields = append(fields, gopkg.DeclVar{
+			Name: "lastID",
+			Type: gopkg.TypeInt64{},
+		})
+	}
+
+	for _, p := range parents {
+		fields = append(fields, gopkg.DeclVar{
+			Name: p.Field,
+			Type: p.Type,
+		})
+	}
+
+	return gopkg.DeclType{
+		Name: "fakeRepository",
+		Type: gopkg.TypeStruct{
+			Fields: fields,
+		},
+	}
+}
+
+// newFakeRepositoryMethod returns the `NewFakeRepository` constructor, which
+// returns an empty `fakeRepository`, taking the repositories which rows
+// referenced by foreign keys are looked up in
+func newFakeRepositoryMethod(
+	parents []fakeParent,
+) gopkg.DeclFunc {
+
+	args := make([]gopkg.DeclVar, 0, len(parents))
+	for _, p := range parents {
+		args = append(args, gopkg.DeclVar{
+			Name: p.Field,
+			Type: p.Type,
+		})
+	}
+
+	return gopkg.DeclFunc{
+		Name: "NewFakeRepository",
+		Args: args,
+		ReturnArgs: tmpl.UnnamedReturnArgs(
+			gopkg.TypeNamed{
+				Name: "Repository",
+			},
+		),
+		BodyData: args,
+		BodyTmpl: `
+	return &fakeRepository{
+{{- range .BodyData}}
+		{{.Name}}: {{.Name}},
+{{- end}}
+	}
+`,
+	}
+}
+
+// fakeUniqueKeysVar returns the `fakeUniqueKeys` var, which has the columns
+// of the primary key and of each unique key of the model, which no two rows
+// of a fake repository may have the same values for
+func fakeUniqueKeysVar(
+	modelStruct gopkg.TypeStruct,
+	keys []tableKey,
+) gopkg.DeclVar {
+
+	return gopkg.DeclVar{
+		Name: "fakeUniqueKeys",
+		Type: gopkg.TypeArray{
+			ValueType: gopkg.TypeArray{
+				ValueType: gopkg.TypeString{},
+			},
+		},
+		LiteralValue: keysCode(append([]tableKey{primaryKey(modelStruct)}, keys...), "\t"),
+	}
+}
+
+// keysCode returns the `[][]string` expression of the columns of `keys`,
+// where each line after the first is indented by `indent`
+func keysCode(
+	keys []tableKey,
+	indent string,
+) string {
+
+	code := "[][]string{\n"
+	for _, k := range keys {
+		code += indent + "\t[]string{\"" + strings.Join(k.Columns, "\", \"") + "\"},\n"
+	}
+
+	return code + indent + "}"
+}
+
+// fakeMethod returns the method of `fakeRepository` which implements the
+// CRUD method `crudMethod` of the `Repository`
+//
+// The methods which read or write rows do so under the lock of the
+// repository, and the others call them in the same way as their SQL
+// counterparts call the methods which run queries.
+func fakeMethod(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+	keys []tableKey,
+	crudMethod gopkg.DeclFunc,
+) (gopkg.DeclFunc, error) {
+
+	m := gopkg.DeclFunc{
+		Name: crudMethod.Name,
+		Receiver: gopkg.FuncReceiver{
+			VarName: "f",
+			TypeName: "fakeRepository",
+			IsPointer: true,
+		},
+		Args: repositoryArgs(crudMethod),
+		VariadicLastArg: crudMethod.VariadicLastArg,
+		ReturnArgs: crudMethod.ReturnArgs,
+	}
+
+	_, softDelete := softDeleteField(modelStruct)
+	pk := pkQueryParams(modelStruct)
+
+	switch name := crudMethod.Name; {
+	case name == "Insert":
+		m.BodyTmpl = `
+	ids, err := f.InsertMany(ctx, []` + d.Import.Alias + `.` + modelName + `{d})
+	if err != nil {
+		{{FuncReturnDefaultsWithErr}}
+	}
+
+	return ids[0], nil
+`
+	case name == "InsertMany":
+		body, err := fakeInsertManyCode(d, modelStruct)
+		if err != nil {
+			return gopkg.DeclFunc{}, err
+		}
+		m.BodyTmpl = body
+	case name == "Upsert":
+		m.BodyTmpl = fakeUpsertCode(d, modelName, modelStruct, keys)
+	case name == "Select":
+		m.BodyTmpl = `
+	return f.SelectPage(ctx, lib.SelectOptions{}, queryParams, conds...)
+`
+	case name == "SelectIncludingDeleted":
+		m.BodyTmpl = `
+	return f.SelectPageIncludingDeleted(ctx, lib.SelectOptions{}, queryParams, conds...)
+`
+	case name == "SelectPage" && softDelete:
+		m.BodyTmpl = `
+	return f.SelectPageIncludingDeleted(ctx, opts, queryParams, withDeletedAtCond(conds, lib.OpIsNull)...)
+`
+	case name == "SelectPage" || name == "SelectPageIncludingDeleted":
+		body, err := fakeSelectPageCode(d, modelName, modelStruct)
+		if err != nil {
+			return gopkg.DeclFunc{}, err
+		}
+		m.BodyTmpl = body
+	case name == "ForEach":
+		m.BodyTmpl = fakeForEachCode(d, modelStruct)
+	case strings.HasPrefix(name, "SelectWith"):
+		body, err := fakeSelectWithCode(d, modelName, modelStruct, strings.TrimPrefix(name, "SelectWith"))
+		if err != nil {
+			return gopkg.DeclFunc{}, err
+		}
+		m.BodyTmpl = body
+	case name == "SelectByID":
+		m.BodyTmpl = fakeSelectByKeyCode(d, modelName, name, []string{"id"})
+		m.BodyData = fakeKeyArgs{Columns: []string{"id"}, Args: m.Args[1:]}
+	case name == "SelectByPK":
+		m.BodyTmpl = fakeSelectByKeyCode(d, modelName, name, primaryKey(modelStruct).Columns)
+		m.BodyData = fakeKeyArgs{Columns: primaryKey(modelStruct).Columns, Args: m.Args[1:]}
+	case strings.HasPrefix(name, "SelectBy"):
+		for _, k := range keys {
+			if name == "SelectBy" + strings.Join(k.Fields, "And") {
+				m.BodyTmpl = fakeSelectByKeyCode(d, modelName, name, k.Columns)
+				m.BodyData = fakeKeyArgs{Columns: k.Columns, Args: m.Args[1:]}
+			}
+		}
+	case name == "Update" && softDelete:
+		m.BodyTmpl = `
+	return f.updateIncludingDeleted(ctx, updates, queryParams, withDeletedAtCond(conds, lib.OpIsNull)...)
+`
+	case name == "Update" || name == "updateIncludingDeleted":
+		m.BodyTmpl = `
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.update(updates, queryParams, conds...)
+`
+	case name == "UpdateByID" || name == "UpdateByPK":
+		m.BodyTmpl = fakeUpdateByKeyCode(d, modelStruct, name)
+		m.BodyData = pk
+	case name == "Delete" && softDelete:
+		f, _ := softDeleteField(modelStruct)
+		m.BodyTmpl = `
+	return f.Update(
+		ctx,
+		map[string]any{
+			"` + columnName(f) + `": ` + d.Dialect.timeNowCode() + `,
+		},
+		queryParams,
+		conds...,
+	)
+`
+	case name == "Restore":
+		f, _ := softDeleteField(modelStruct)
+		m.BodyTmpl = `
+	return f.updateIncludingDeleted(
+		ctx,
+		map[string]any{
+			"` + columnName(f) + `": nil,
+		},
+		queryParams,
+		withDeletedAtCond(conds, lib.OpIsNotNull)...,
+	)
+`
+	case name == "Delete" || name == "HardDelete":
+		m.BodyTmpl = fakeDeleteCode(d, name)
+	case strings.HasSuffix(name, "ByID") || strings.HasSuffix(name, "ByPK"):
+		// The `ByID` and `ByPK` variants of `Delete`, `Restore` and
+		// `HardDelete`
+		m.BodyTmpl = fakeByKeyCode(name, name[:len(name) - len("ByID")])
+		m.BodyData = pk
+	}
+
+	if m.BodyTmpl == "" {
+		return gopkg.DeclFunc{}, errors.New("no fake repository method for " + crudMethod.Name)
+	}
+
+	return m, nil
+}
+
+// fakeInsertManyCode returns the body of the `InsertMany` method of the fake,
+// which returns the IDs (or primary keys) of the rows it inserts
+func fakeInsertManyCode(
+	d pkgDef,
+	modelStruct gopkg.TypeStruct,
+) (string, error) {
+
+	idTypeCode := "int64"
+	idCode := "d.ID"
+	if hasCustomPrimaryKey(modelStruct) {
+		var err error
+		idTypeCode, err = primaryKeyType(modelStruct).FullType(map[string]string{
+			d.Import.Import: d.Import.Alias,
+			"time": "time",
+		})
+		if err != nil {
+			return "", err
+		}
+
+		idCode = primaryKeyValueCode(modelStruct, "d", "")
+	}
+
+	return `
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	inserted, err := f.insert(ds)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]` + idTypeCode + `, 0, len(inserted))
+	for _, d := range inserted {
+		ids = append(ids, ` + idCode + `)
+	}
+
+	return ids, nil
+`, nil
+}
+
+// fakeInsertMethod returns the `insert` method of the fake, which must be
+// called under its lock, and which appends rows to it as they would be
+// inserted into the table, returning the inserted rows
+func fakeInsertMethod(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) (gopkg.DeclFunc, error) {
+
+	dbModelType := d.Import.Alias + "." + modelName
+
+	lastIDInit := ""
+	lastIDCode := ""
+	lastIDSave := ""
+	if !hasCustomPrimaryKey(modelStruct) {
+		lastIDInit = `
+	lastID := f.lastID`
+		lastIDCode = `		lastID++
+		d.ID = lastID
+`
+		lastIDSave = `
+	f.lastID = lastID`
+	}
+
+	return gopkg.DeclFunc{
+		Name: "insert",
+		Receiver: gopkg.FuncReceiver{
+			VarName: "f",
+			TypeName: "fakeRepository",
+			IsPointer: true,
+		},
+		Args: []gopkg.DeclVar{
+			{
+				Name: "ds",
+				Type: gopkg.TypeArray{
+					ValueType: gopkg.TypeNamed{
+						Name: modelName,
+						Import: d.Import.Import,
+					},
+				},
+			},
+		},
+		ReturnArgs: tmpl.UnnamedReturnArgs(
+			gopkg.TypeArray{
+				ValueType: gopkg.TypeNamed{
+					Name: modelName,
+					Import: d.Import.Import,
+				},
+			},
+			gopkg.TypeError{},
+		),
+		BodyTmpl: `
+	// The rows are copied so that no rows are inserted if any of them
+	// conflict
+	rows := make([]` + dbModelType + `, 0, len(f.rows) + len(ds))
+	rows = append(rows, f.rows...)` + lastIDInit + `
+	for _, d := range ds {
+` + uuidDefaultsCode(modelStruct, "d", "\t\t") + lastIDCode + fakeTimestampsCode(d, modelStruct, "d", "\t\t") + `		rows = append(rows, d)
+	}
+
+	err := lib.FakeUnique(rows, fakeColumnValue, fakeUniqueKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	f.rows = rows` + lastIDSave + `
+	return rows[len(rows) - len(ds):], nil
+`,
+	}, nil
+}
+
+// fakeTimestampsCode returns the code which sets each timestamp field of the
+// model `varName` to the current time, as it is set by the generated
+// methods or by the DB when a row is inserted, indented by `indent`
+func fakeTimestampsCode(
+	d pkgDef,
+	modelStruct gopkg.TypeStruct,
+	varName string,
+	indent string,
+) string {
+
+	var code string
+	for _, f := range modelStruct.Fields {
+		if !isTimestampField(f) {
+			continue
+		}
+
+		code += indent + varName + "." + f.Name + " = " + d.Dialect.timeNowCode() + "\n"
+	}
+
+	return code
+}
+
+// fakeUpsertCode returns the body of the `Upsert` method of the fake, which
+// checks the columns to overwrite in the same way as the SQL `Upsert`, and
+// finds the conflicting row with the same keys as the dialect's upsert query
+// (so any unique key for mysql, and only the first for postgres and sqlite)
+func fakeUpsertCode(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+	keys []tableKey,
+) string {
+
+	dbModelType := d.Import.Alias + "." + modelName
+
+	overwriteDefault := make([]string, 0, len(modelStruct.Fields))
+	for _, field := range modelStruct.Fields {
+		if field.Name == "ID" || isDBTimestampField(field) {
+			continue
+		}
+
+		if kind, _ := timestampOf(field); kind != timestampCreatedAt && !isUniqueField(field) && !isVersionField(field) {
+			overwriteDefault = append(overwriteDefault, `"` + columnName(field) + `"`)
+		}
+	}
+
+	if len(overwriteDefault) == 0 {
+		overwriteDefault = append(overwriteDefault, `"` + keys[0].Columns[0] + `"`)
+	}
+
+	overwriteCheck := `column == "id"`
+	versionCode := ""
+	if f, ok := versionField(modelStruct); ok {
+		overwriteCheck = `column == "id" || column == "` + columnName(f) + `"`
+		versionCode = `
+	rows[i].` + f.Name + `++
+`
+	}
+
+	// The timestamps are set before finding the conflicting row, so that
+	// they can be overwritten
+	timestamps := fakeTimestampsCode(d, modelStruct, "d", "\t")
+	if timestamps != "" {
+		timestamps += "\n"
+	}
+
+	conflictKeys := keys[:1]
+	if d.Dialect == dialectMysql {
+		conflictKeys = keys
+	}
+
+	return `
+	if len(overwrite) == 0 {
+		overwrite = []string{` + strings.Join(overwriteDefault, ", ") + `}
+	}
+
+	for _, column := range overwrite {
+		if !modelContainsField(column) {
+			return 0, fmt.Errorf("Upsert: %w", &lib.UnknownFieldError{Field: column})
+		}
+
+		if ` + overwriteCheck + ` {
+			return 0, errors.New("Upsert: cannot overwrite field - " + column)
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+` + timestamps + `	i, ok := lib.FakeConflict(f.rows, fakeColumnValue, d, ` + keysCode(conflictKeys, "\t") + `)
+	if !ok {
+		inserted, err := f.insert([]` + dbModelType + `{d})
+		if err != nil {
+			return 0, err
+		}
+
+		return inserted[0].ID, nil
+	}
+
+	rows := make([]` + dbModelType + `, 0, len(f.rows))
+	rows = append(rows, f.rows...)
+	for _, column := range overwrite {
+		err := fakeSetColumn(&rows[i], column, fakeColumnValue(d, column))
+		if err != nil {
+			return 0, fmt.Errorf("Upsert: %w", err)
+		}
+	}
+` + versionCode + `
+	err := lib.FakeUnique(rows, fakeColumnValue, fakeUniqueKeys)
+	if err != nil {
+		return 0, err
+	}
+
+	f.rows = rows
+	return rows[i].ID, nil
+`
+}
+
+// fakeSelectPageCode returns the body of the method of the fake which selects
+// a page of rows, which is `SelectPage`, or `SelectPageIncludingDeleted` for
+// models with soft deletes
+func fakeSelectPageCode(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) (string, error) {
+
+	pageAfter, err := pageAfterCode(d, modelStruct)
+	if err != nil {
+		return "", err
+	}
+
+	defaultOrder := ""
+	if hasCustomPrimaryKey(modelStruct) {
+		defaultOrder = `
+	if len(opts.OrderBy) == 0 {
+		opts.OrderBy = ` + primaryKeyOrderByCode(modelStruct, "\t\t") + `
+	}
+`
+	}
+
+	return pageAfter + defaultOrder + `
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	res, err := lib.FakeSelect(
+		` + d.Dialect.fakeDialectCode() + `,
+		f.rows,
+		fakeColumnValue,
+		modelContainsField,
+		opts,
+		` + d.maxRowsCode(modelName) + `,
+		queryParams,
+		conds...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Select: %w", err)
+	}
+
+	return res, nil
+`, nil
+}
+
+// fakeForEachCode returns the body of the `ForEach` method of the fake, which
+// calls `fn` on the rows selected when it is called, without holding the
+// lock so that `fn` may use the repository
+func fakeForEachCode(
+	d pkgDef,
+	modelStruct gopkg.TypeStruct,
+) string {
+
+	return `
+	f.mu.Lock()
+	rows, err := lib.FakeSelect(
+		` + d.Dialect.fakeDialectCode() + `,
+		f.rows,
+		fakeColumnValue,
+		modelContainsField,
+		lib.SelectOptions{
+			OrderBy: ` + primaryKeyOrderByCode(modelStruct, "\t\t\t") + `,
+			MaxRows: lib.UnlimitedRows,
+		},
+		lib.UnlimitedRows,
+		queryParams,
+		` + notDeletedCondsCode(modelStruct) + `,
+	)
+	f.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("ForEach: %w", err)
+	}
+
+	for _, d := range rows {
+		err := fn(d)
+		if errors.Is(err, lib.ErrStopIteration) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+`
+}
+
+// fakeSelectWithCode returns the body of the `SelectWith<keyName>` method of
+// the fake, which looks up the row referenced by each selected row in the
+// repository of the referenced model, leaving out rows which reference no
+// row, or a soft deleted row (as they are by the join of the SQL method)
+func fakeSelectWithCode(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+	keyName string,
+) (string, error) {
+
+	keys, err := foreignKeys(modelStruct)
+	if err != nil {
+		return "", err
+	}
+
+	var key foreignKey
+	for _, k := range keys {
+		if k.Name() == keyName {
+			key = k
+		}
+	}
+
+	selectOptions := "lib.SelectOptions{}"
+	if hasCustomPrimaryKey(modelStruct) {
+		selectOptions = "lib.SelectOptions{\n\t\t\tOrderBy: " + primaryKeyOrderByCode(modelStruct, "\t\t\t") + ",\n\t\t}"
+	}
+
+	rowType := "With" + keyName
+	methodName := "SelectWith" + keyName
+
+	// Rows which reference rows of the same model are looked up in the fake
+	parentRepository := "f." + fakeParentField(key.Model)
+	if key.Model == modelName {
+		parentRepository = "f"
+	}
+
+	return `
+	f.mu.Lock()
+	rows, err := lib.FakeSelect(
+		` + d.Dialect.fakeDialectCode() + `,
+		f.rows,
+		fakeColumnValue,
+		modelContainsField,
+		` + selectOptions + `,
+		lib.UnlimitedRows,
+		queryParams,
+		` + notDeletedCondsCode(modelStruct) + `,
+	)
+	f.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("` + methodName + `: %w", err)
+	}
+
+	// The rows are limited after the join, in the same way as by the
+	// database, so that rows which are left out by it are not counted
+	maxRows := int64(` + d.maxRowsCode(modelName) + `)
+	res := make([]` + rowType + `, 0, len(rows))
+	for _, d := range rows {
+		referenced, err := ` + parentRepository + `.Select(
+			ctx,
+			map[string]any{
+				"id": d.` + key.Field + `,
+			},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("` + methodName + `: %w", err)
+		}
+
+		if len(referenced) == 0 {
+			continue
+		}
+
+		if maxRows != lib.UnlimitedRows && int64(len(res)) >= maxRows {
+			return nil, fmt.Errorf("` + methodName + `: %w", lib.ErrTooManyRows)
+		}
+
+		res = append(res, ` + rowType + `{
+			` + modelName + `: d,
+			` + keyName + `: referenced[0],
+		})
+	}
+
+	return res, nil
+`, nil
+}
+
+// fakeKeyArgs is the `BodyData` of the select by key methods of the fake,
+// which are the columns of the key along with the args for their values
+type fakeKeyArgs struct {
+	Columns []string
+	Args []gopkg.DeclVar
+}
+
+// fakeSelectByKeyCode returns the body of the method `methodName` of the
+// fake, which selects the one row with the values of the `Args` in its
+// `BodyData` for the key `Columns`
+func fakeSelectByKeyCode(
+	d pkgDef,
+	modelName string,
+	methodName string,
+	columns []string,
+) string {
+
+	dbModelType := d.Import.Alias + "." + modelName
+
+	return `
+	r, err := f.Select(
+		ctx,
+		map[string]any{
+{{- range $i, $arg := .BodyData.Args}}
+			"{{index $.BodyData.Columns $i}}": {{$arg.Name}},
+{{- end}}
+		},
+	)
+	if err != nil {
+		return ` + dbModelType + `{}, err
+	}
+
+	if len(r) == 0 {
+		return ` + dbModelType + `{}, fmt.Errorf(
+			"` + methodName + `: ` + strings.Join(columns, ", ") + ` ` + strings.TrimSuffix(strings.Repeat("%v, ", len(columns)), ", ") + `: %w",
+{{- range .BodyData.Args}}
+			{{.Name}},
+{{- end}}
+			lib.ErrNotFound,
+		)
+	}
+
+	if len(r) > 1 {
+		return ` + dbModelType + `{}, fmt.Errorf("` + methodName + `: found more than one entry with ` + strings.Join(columns, ", ") + `: %w", lib.ErrTooManyRows)
+	}
+
+	return r[0], nil
+`
+}
+
+// fakeUpdateMethod returns the `update` method of the fake, which must be
+// called under its lock, and which sets the updated_at timestamp and
+// increments the version of the rows it updates, as the SQL `Update` does,
+// unless they are set explicitly
+func fakeUpdateMethod(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) gopkg.DeclFunc {
+
+	dbModelType := d.Import.Alias + "." + modelName
+
+	updatedAtCode := ""
+	for _, field := range modelStruct.Fields {
+		if kind, _ := timestampOf(field); kind != timestampUpdatedAt {
+			continue
+		}
+
+		updatedAtCode = `
+
+			if _, ok := updates["` + columnName(field) + `"]; !ok {
+				d.` + field.Name + ` = ` + d.Dialect.timeNowCode() + `
+			}`
+		break
+	}
+
+	versionCode := ""
+	if f, ok := versionField(modelStruct); ok {
+		versionCode = `
+
+			if _, ok := updates["` + columnName(f) + `"]; !ok {
+				d.` + f.Name + `++
+			}`
+	}
+
+	return gopkg.DeclFunc{
+		Name: "update",
+		Receiver: gopkg.FuncReceiver{
+			VarName: "f",
+			TypeName: "fakeRepository",
+			IsPointer: true,
+		},
+		Args: []gopkg.DeclVar{
+			{
+				Name: "updates",
+				Type: gopkg.TypeMap{
+					KeyType: gopkg.TypeString{},
+					ValueType: gopkg.TypeAny{},
+				},
+			},
+			{
+				Name: "queryParams",
+				Type: gopkg.TypeMap{
+					KeyType: gopkg.TypeString{},
+					ValueType: gopkg.TypeAny{},
+				},
+			},
+			condsArg(),
+		},
+		VariadicLastArg: true,
+		ReturnArgs: tmpl.UnnamedReturnArgs(
+			gopkg.TypeInt64{},
+			gopkg.TypeError{},
+		),
+		BodyTmpl: `
+	if len(updates) == 0 {
+		return 0, nil
+	}
+
+	for k := range updates {
+		if !modelContainsField(k) {
+			return 0, fmt.Errorf("Update: %w", &lib.UnknownFieldError{Field: k})
+		}
+	}
+
+	rows, n, err := lib.FakeUpdate(
+		` + d.Dialect.fakeDialectCode() + `,
+		f.rows,
+		fakeColumnValue,
+		modelContainsField,
+		func(d *` + dbModelType + `) error {
+			for k, v := range updates {
+				err := fakeSetColumn(d, k, v)
+				if err != nil {
+					return err
+				}
+			}` + updatedAtCode + versionCode + `
+
+			return nil
+		},
+		queryParams,
+		conds...,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("Update: %w", err)
+	}
+
+	err = lib.FakeUnique(rows, fakeColumnValue, fakeUniqueKeys)
+	if err != nil {
+		return 0, err
+	}
+
+	f.rows = rows
+	return n, nil
+`,
+	}
+}
+
+// fakeUpdateByKeyCode returns the body of the method `methodName` of the
+// fake, which updates the one row with the key in its `BodyData` (as
+// `[]pkQueryParam`) in the same way as `updateByKeyCode`, checking the
+// version of models with versions under the same lock as the update
+func fakeUpdateByKeyCode(
+	d pkgDef,
+	modelStruct gopkg.TypeStruct,
+	methodName string,
+) string {
+
+	f, ok := versionField(modelStruct)
+	if !ok {
+		return `
+	if len(updates) == 0 {
+		return nil
+	}
+
+	n, err := f.Update(
+		ctx,
+		updates,
+		map[string]any{
+{{- range .BodyData}}
+			"{{.Column}}": {{.Arg}},
+{{- end}}
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return fmt.Errorf("` + methodName + `: %w", lib.ErrNotFound)
+	}
+
+	return nil
+`
+	}
+
+	notDeletedConds := ""
+	if _, ok := softDeleteField(modelStruct); ok {
+		notDeletedConds = ", withDeletedAtCond(nil, lib.OpIsNull)..."
+	}
+
+	return `
+	if len(updates) == 0 {
+		return nil
+	}
+
+	key := map[string]any{
+{{- range .BodyData}}
+		"{{.Column}}": {{.Arg}},
+{{- end}}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	matched, err := lib.FakeWhere(` + d.Dialect.fakeDialectCode() + `, f.rows, fakeColumnValue, modelContainsField, key` + notDeletedConds + `)
+	if err != nil {
+		return err
+	}
+
+	if len(matched) == 0 {
+		return fmt.Errorf("` + methodName + `: %w", lib.ErrNotFound)
+	}
+
+	if f.rows[matched[0]].` + f.Name + ` != ` + keyArgName(f.Name) + ` {
+		return fmt.Errorf("` + methodName + `: %w", lib.ErrConcurrentModification)
+	}
+
+	_, err = f.update(updates, key` + notDeletedConds + `)
+	return err
+`
+}
+
+// fakeDeleteCode returns the body of the method `methodName` of the fake
+// which removes rows from it, which is `Delete`, or `HardDelete` for models
+// with soft deletes
+func fakeDeleteCode(
+	d pkgDef,
+	methodName string,
+) string {
+
+	return `
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rows, n, err := lib.FakeDelete(
+		` + d.Dialect.fakeDialectCode() + `,
+		f.rows,
+		fakeColumnValue,
+		modelContainsField,
+		queryParams,
+		conds...,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("` + methodName + `: %w", err)
+	}
+
+	f.rows = rows
+	return n, nil
+`
+}
+
+// fakeByKeyCode returns the body of the method `methodName` of the fake,
+// which calls its method `fn` with the primary key in its `BodyData` (as
+// `[]pkQueryParam`) in the same way as `byKeyMethod`
+func fakeByKeyCode(
+	methodName string,
+	fn string,
+) string {
+
+	return `
+	n, err := f.` + fn + `(
+		ctx,
+		map[string]any{
+{{- range .BodyData}}
+			"{{.Column}}": {{.Arg}},
+{{- end}}
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return fmt.Errorf("` + methodName + `: %w", lib.ErrNotFound)
+	}
+
+	return nil
+`
+}
+
+// fakeColumn is a column of a model along with the name of its field
+type fakeColumn struct {
+	Column string
+	Field string
+}
+
+// fakeColumns returns the columns of the model along with their fields
+func fakeColumns(
+	modelStruct gopkg.TypeStruct,
+) []fakeColumn {
+
+	columns := make([]fakeColumn, 0, len(modelStruct.Fields))
+	for _, f := range modelStruct.Fields {
+		columns = append(columns, fakeColumn{
+			Column: columnName(f),
+			Field: f.Name,
+		})
+	}
+
+	return columns
+}
+
+// fakeColumnValueMethod returns the `fakeColumnValue` helper, which returns
+// the value of a column of a row, as compared by the queries of the fake
+func fakeColumnValueMethod(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) gopkg.DeclFunc {
+
+	return gopkg.DeclFunc{
+		Name: "fakeColumnValue",
+		Args: []gopkg.DeclVar{
+			{
+				Name: "d",
+				Type: gopkg.TypeNamed{
+					Name: modelName,
+					Import: d.Import.Import,
+				},
+			},
+			{
+				Name: "column",
+				Type: gopkg.TypeString{},
+			},
+		},
+		ReturnArgs: tmpl.UnnamedReturnArgs(
+			gopkg.TypeAny{},
+		),
+		BodyData: fakeColumns(modelStruct),
+		BodyTmpl: `
+	switch column {
+{{- range .BodyData}}
+	case "{{.Column}}":
+		return d.{{.Field}}
+{{- end}}
+	}
+
+	return nil
+`,
+	}
+}
+
+// fakeSetColumnMethod returns the `fakeSetColumn` helper, which sets a column
+// of a row to a value given in the updates of `Update`
+func fakeSetColumnMethod(
+	d pkgDef,
+	modelName string,
+	modelStruct gopkg.TypeStruct,
+) gopkg.DeclFunc {
+
+	return gopkg.DeclFunc{
+		Name: "fakeSetColumn",
+		Args: []gopkg.DeclVar{
+			{
+				Name: "d",
+				Type: gopkg.TypePointer{
+					ValueType: gopkg.TypeNamed{
+						Name: modelName,
+						Import: d.Import.Import,
+					},
+				},
+			},
+			{
+				Name: "column",
+				Type: gopkg.TypeString{},
+			},
+			{
+				Name: "v",
+				Type: gopkg.TypeAny{},
+			},
+		},
+		ReturnArgs: tmpl.UnnamedReturnArgs(
+			gopkg.TypeError{},
+		),
+		BodyData: fakeColumns(modelStruct),
+		BodyTmpl: `
+	switch column {
+{{- range .BodyData}}
+	case "{{.Column}}":
+		return lib.FakeAssign(&d.{{.Field}}, v)
+{{- end}}
+	}
+
+	return &lib.UnknownFieldError{Field: column}
+`,
+	}
+}
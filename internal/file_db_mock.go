@@ -0,0 +1,422 @@
+package internal
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/iancoleman/strcase"
+	"github.com/thecodedproject/gopkg"
+	"github.com/thecodedproject/gopkg/tmpl"
+)
+
+// fileDBMock returns the `db_mock.go` of each model when generated with
+// `--mocks`, which has the `MockRepository` implementation of the model's
+// `Repository`, which returns the values set for the calls expected of it
+// and records the calls made to it, so that tests can check how code uses
+// the repository
+func fileDBMock(d pkgDef) func() ([]gopkg.FileContents, error) {
+
+	return func() ([]gopkg.FileContents, error) {
+
+		if !d.Mocks {
+			return nil, nil
+		}
+
+		files := make([]gopkg.FileContents, 0, len(d.DBDataModels))
+		for _, model := range d.DBDataModels {
+
+			dbcrudDir := strcase.ToSnake(model.Name)
+			dbcrudImport := path.Join(d.Import.Import, dbcrudDir)
+
+			modelName := model.Name
+			modelStruct, ok := model.Type.(gopkg.TypeStruct)
+			if !ok {
+				return nil, errors.New("found datamodel which is not of type struct")
+			}
+
+			keys, err := uniqueKeys(modelStruct)
+			if err != nil {
+				return nil, err
+			}
+
+			crudMethods, _, err := dbCrudMethods(d, modelName, modelStruct, keys)
+			if err != nil {
+				return nil, err
+			}
+
+			types := []gopkg.DeclType{
+				mockRepositoryType(),
+			}
+			functions := []gopkg.DeclFunc{
+				newMockRepositoryMethod(),
+			}
+			for _, m := range repositoryMethods(crudMethods) {
+				mockMethod, err := mockRepositoryMethod(d, m)
+				if err != nil {
+					return nil, err
+				}
+
+				types = append(types, mockCallType(m))
+				functions = append(
+					functions,
+					mockExpectMethod(m),
+					mockMethod,
+					mockCallReturnMethod(m),
+					mockCallTimesMethod(m),
+					mockCallAnyTimesMethod(m),
+				)
+			}
+
+			files = append(files, gopkg.FileContents{
+				Filepath: filepath.Join(d.OutputPath, dbcrudDir, "db_mock.go"),
+				PackageName: dbcrudDir,
+				PackageImportPath: dbcrudImport,
+				Imports: tmpl.UnnamedImports(
+					"github.com/thecodedproject/dbcrudgen/lib",
+				),
+				Vars: []gopkg.DeclVar{
+					mockRepositoryCheckVar(),
+				},
+				Types: types,
+				Functions: functions,
+			})
+		}
+
+		return files, nil
+	}
+}
+
+// mockRepositoryType returns the `MockRepository` struct, which holds the
+// `lib.Mock` that records the expected calls and the calls made; its
+// `Calls` and `Assert...` methods are used to check the calls made
+func mockRepositoryType() gopkg.DeclType {
+
+	return gopkg.DeclType{
+		Name: "MockRepository",
+		Type: gopkg.TypeStruct{
+			Fields: []gopkg.DeclVar{
+				{
+					Name: "Mock",
+					Type: gopkg.TypePointer{
+						ValueType: gopkg.TypeNamed{
+							Name: "Mock",
+							Import: "github.com/thecodedproject/dbcrudgen/lib",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// mockRepositoryCheckVar returns the `_` var which checks that
+// `MockRepository` implements `Repository`
+func mockRepositoryCheckVar() gopkg.DeclVar {
+
+	return gopkg.DeclVar{
+		Name: "_",
+		Type: gopkg.TypeNamed{
+			Name: "Repository",
+		},
+		LiteralValue: "(*MockRepository)(nil)",
+	}
+}
+
+// newMockRepositoryMethod returns the `NewMockRepository` constructor, which
+// fails `t` on unexpected calls, and on expected calls which are not made by
+// the end of the test
+func newMockRepositoryMethod() gopkg.DeclFunc {
+
+	return gopkg.DeclFunc{
+		Name: "NewMockRepository",
+		Args: []gopkg.DeclVar{
+			{
+				Name: "t",
+				Type: gopkg.TypeNamed{
+					Name: "MockT",
+					Import: "github.com/thecodedproject/dbcrudgen/lib",
+				},
+			},
+		},
+		ReturnArgs: tmpl.UnnamedReturnArgs(
+			gopkg.TypePointer{
+				ValueType: gopkg.TypeNamed{
+					Name: "MockRepository",
+				},
+			},
+		),
+		BodyTmpl: `
+	return &MockRepository{
+		Mock: lib.NewMock(t),
+	}
+`,
+	}
+}
+
+// mockCallTypeName returns the name of the type of the expected calls of the
+// CRUD method `name`
+func mockCallTypeName(name string) string {
+
+	return "Mock" + name + "Call"
+}
+
+// mockCallType returns the type of the expected calls of `crudMethod`, which
+// sets the values they return with the types returned by the method
+func mockCallType(
+	crudMethod gopkg.DeclFunc,
+) gopkg.DeclType {
+
+	return gopkg.DeclType{
+		Name: mockCallTypeName(crudMethod.Name),
+		Type: gopkg.TypeStruct{
+			Fields: []gopkg.DeclVar{
+				{
+					Name: "call",
+					Type: gopkg.TypePointer{
+						ValueType: gopkg.TypeNamed{
+							Name: "MockCall",
+							Import: "github.com/thecodedproject/dbcrudgen/lib",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// mockCallReceiver returns the receiver of the methods of the type of the
+// expected calls of the CRUD method `name`
+func mockCallReceiver(name string) gopkg.FuncReceiver {
+
+	return gopkg.FuncReceiver{
+		VarName: "c",
+		TypeName: mockCallTypeName(name),
+		IsPointer: true,
+	}
+}
+
+// mockCallReturnArgs returns the type of the expected calls of the CRUD
+// method `name`, as returned by the methods which build the calls
+func mockCallReturnArgs(name string) []gopkg.DeclVar {
+
+	return tmpl.UnnamedReturnArgs(
+		gopkg.TypePointer{
+			ValueType: gopkg.TypeNamed{
+				Name: mockCallTypeName(name),
+			},
+		},
+	)
+}
+
+// mockArgs returns the args of `crudMethod` which are recorded by the mock,
+// which are the args of the `Repository` method other than the context
+func mockArgs(
+	crudMethod gopkg.DeclFunc,
+) []gopkg.DeclVar {
+
+	args := make([]gopkg.DeclVar, 0, len(crudMethod.Args))
+	for _, a := range repositoryArgs(crudMethod) {
+		if a == ctxArg() {
+			continue
+		}
+
+		args = append(args, a)
+	}
+
+	return args
+}
+
+// mockArgNames returns the names of the args recorded by the mock for
+// `crudMethod`, along with the name of its variadic arg (or "" if it has
+// none)
+func mockArgNames(
+	crudMethod gopkg.DeclFunc,
+) ([]string, string) {
+
+	args := mockArgs(crudMethod)
+
+	names := make([]string, 0, len(args))
+	for _, a := range args {
+		names = append(names, a.Name)
+	}
+
+	if !crudMethod.VariadicLastArg || len(names) == 0 {
+		return names, ""
+	}
+
+	return names[:len(names) - 1], names[len(names) - 1]
+}
+
+// mockExpectMethod returns the `Expect<Method>` method of the mock, which
+// records a call expected of `crudMethod` with the given args (or with any
+// value of the args given as `lib.MockAny`)
+func mockExpectMethod(
+	crudMethod gopkg.DeclFunc,
+) gopkg.DeclFunc {
+
+	args := mockArgs(crudMethod)
+	for i := range args {
+		args[i].Type = gopkg.TypeAny{}
+		if crudMethod.VariadicLastArg && i == len(args) - 1 {
+			args[i].Type = gopkg.TypeArray{
+				ValueType: gopkg.TypeAny{},
+			}
+		}
+	}
+
+	names, variadic := mockArgNames(crudMethod)
+	expectArgs := ""
+	if len(names) > 0 {
+		expectArgs = ", " + strings.Join(names, ", ")
+	}
+	if variadic != "" {
+		expectArgs = ", append([]any{" + strings.Join(names, ", ") + "}, " + variadic + "...)..."
+	}
+
+	return gopkg.DeclFunc{
+		Name: "Expect" + crudMethod.Name,
+		Receiver: gopkg.FuncReceiver{
+			VarName: "m",
+			TypeName: "MockRepository",
+			IsPointer: true,
+		},
+		Args: args,
+		VariadicLastArg: crudMethod.VariadicLastArg,
+		ReturnArgs: mockCallReturnArgs(crudMethod.Name),
+		BodyTmpl: `
+	return &` + mockCallTypeName(crudMethod.Name) + `{
+		call: m.Mock.Expect("` + crudMethod.Name + `"` + expectArgs + `),
+	}
+`,
+	}
+}
+
+// mockRepositoryMethod returns the method of `MockRepository` which records
+// the call of `crudMethod`, and returns the values set for the expected call
+// it matches
+func mockRepositoryMethod(
+	d pkgDef,
+	crudMethod gopkg.DeclFunc,
+) (gopkg.DeclFunc, error) {
+
+	aliases := map[string]string{
+		d.Import.Import: d.Import.Alias,
+		"time": "time",
+		"github.com/thecodedproject/dbcrudgen/lib": "lib",
+	}
+
+	returns := make([]string, 0, len(crudMethod.ReturnArgs))
+	for i, r := range crudMethod.ReturnArgs {
+		typeCode, err := r.Type.FullType(aliases)
+		if err != nil {
+			return gopkg.DeclFunc{}, err
+		}
+
+		returns = append(returns, "lib.MockReturn[" + typeCode + "](returns, " + strconv.Itoa(i) + ")")
+	}
+
+	names, variadic := mockArgNames(crudMethod)
+	calledArgs := ""
+	if len(names) > 0 {
+		calledArgs = ", " + strings.Join(names, ", ")
+	}
+	if variadic != "" {
+		calledArgs = ", lib.MockArgs([]any{" + strings.Join(names, ", ") + "}, " + variadic + ")..."
+	}
+
+	return gopkg.DeclFunc{
+		Name: crudMethod.Name,
+		Receiver: gopkg.FuncReceiver{
+			VarName: "m",
+			TypeName: "MockRepository",
+			IsPointer: true,
+		},
+		Args: repositoryArgs(crudMethod),
+		VariadicLastArg: crudMethod.VariadicLastArg,
+		ReturnArgs: crudMethod.ReturnArgs,
+		BodyTmpl: `
+	returns, err := m.Mock.Called("` + crudMethod.Name + `"` + calledArgs + `)
+	if err != nil {
+		{{FuncReturnDefaultsWithErr}}
+	}
+
+	return ` + strings.Join(returns, ", ") + `
+`,
+	}, nil
+}
+
+// mockCallReturnMethod returns the `Return` method of the expected calls of
+// `crudMethod`, which sets the values returned by the call
+func mockCallReturnMethod(
+	crudMethod gopkg.DeclFunc,
+) gopkg.DeclFunc {
+
+	args := make([]gopkg.DeclVar, 0, len(crudMethod.ReturnArgs))
+	names := make([]string, 0, len(crudMethod.ReturnArgs))
+	for _, r := range crudMethod.ReturnArgs {
+		name := "v"
+		if r.Type == (gopkg.TypeError{}) {
+			name = "err"
+		}
+
+		args = append(args, gopkg.DeclVar{
+			Name: name,
+			Type: r.Type,
+		})
+		names = append(names, name)
+	}
+
+	return gopkg.DeclFunc{
+		Name: "Return",
+		Receiver: mockCallReceiver(crudMethod.Name),
+		Args: args,
+		ReturnArgs: mockCallReturnArgs(crudMethod.Name),
+		BodyTmpl: `
+	c.call.Returns(` + strings.Join(names, ", ") + `)
+	return c
+`,
+	}
+}
+
+// mockCallTimesMethod returns the `Times` method of the expected calls of
+// `crudMethod`, which sets the number of times the call is expected
+func mockCallTimesMethod(
+	crudMethod gopkg.DeclFunc,
+) gopkg.DeclFunc {
+
+	return gopkg.DeclFunc{
+		Name: "Times",
+		Receiver: mockCallReceiver(crudMethod.Name),
+		Args: []gopkg.DeclVar{
+			{
+				Name: "n",
+				Type: gopkg.TypeInt{},
+			},
+		},
+		ReturnArgs: mockCallReturnArgs(crudMethod.Name),
+		BodyTmpl: `
+	c.call.Times(n)
+	return c
+`,
+	}
+}
+
+// mockCallAnyTimesMethod returns the `AnyTimes` method of the expected calls
+// of `crudMethod`, which sets the call to be expected any number of times
+func mockCallAnyTimesMethod(
+	crudMethod gopkg.DeclFunc,
+) gopkg.DeclFunc {
+
+	return gopkg.DeclFunc{
+		Name: "AnyTimes",
+		Receiver: mockCallReceiver(crudMethod.Name),
+		ReturnArgs: mockCallReturnArgs(crudMethod.Name),
+		BodyTmpl: `
+	c.call.AnyTimes()
+	return c
+`,
+	}
+}
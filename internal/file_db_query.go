@@ -0,0 +1,255 @@
+package internal
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+
+	"github.com/iancoleman/strcase"
+	"github.com/thecodedproject/gopkg"
+	"github.com/thecodedproject/gopkg/tmpl"
+)
+
+func fileDBQuery(d pkgDef) func() ([]gopkg.FileContents, error) {
+
+	return func() ([]gopkg.FileContents, error) {
+
+		files := make([]gopkg.FileContents, 0, len(d.DBDataModels))
+		for _, model := range d.DBDataModels {
+
+			dbcrudDir := strcase.ToSnake(model.Name)
+			dbcrudImport := path.Join(d.Import.Import, dbcrudDir)
+
+			modelStruct, ok := model.Type.(gopkg.TypeStruct)
+			if !ok {
+				return nil, errors.New("found datamodel which is not of type struct")
+			}
+
+			functions := []gopkg.DeclFunc{
+				whereFunc(),
+			}
+			for _, field := range modelStruct.Fields {
+				functions = append(functions, queryFieldMethods(d, field)...)
+			}
+			functions = append(functions, queryOrMethod(), queryWithMethod())
+
+			files = append(files, gopkg.FileContents{
+				Filepath: filepath.Join(d.OutputPath, dbcrudDir, "db_query.go"),
+				PackageName: dbcrudDir,
+				PackageImportPath: dbcrudImport,
+				Imports: tmpl.UnnamedImports(
+					"github.com/thecodedproject/dbcrudgen/lib",
+				),
+				Types: []gopkg.DeclType{
+					{
+						Name: "Query",
+						Type: gopkg.TypeArray{
+							ValueType: gopkg.TypeNamed{
+								Name: "Cond",
+								Import: "github.com/thecodedproject/dbcrudgen/lib",
+							},
+						},
+					},
+				},
+				Functions: functions,
+			})
+		}
+
+		return files, nil
+	}
+}
+
+func whereFunc() gopkg.DeclFunc {
+	return gopkg.DeclFunc{
+		Name: "Where",
+		ReturnArgs: tmpl.UnnamedReturnArgs(
+			queryType(),
+		),
+		BodyTmpl: `
+	return nil
+`,
+	}
+}
+
+// queryFieldMethods returns the `Query` methods which add a condition on
+// `field`, one per operator supported by its column, where only nullable
+// columns can be null, and bool columns are not ordered so are only compared
+// for (in)equality
+func queryFieldMethods(
+	d pkgDef,
+	field gopkg.DeclVar,
+) []gopkg.DeclFunc {
+
+	column := columnName(field)
+
+	valueOps := []struct{
+		Suffix string
+		Op string
+	}{
+		{Suffix: "Eq", Op: "lib.OpEq"},
+		{Suffix: "Ne", Op: "lib.OpNe"},
+		{Suffix: "Lt", Op: "lib.OpLt"},
+		{Suffix: "Le", Op: "lib.OpLe"},
+		{Suffix: "Gt", Op: "lib.OpGt"},
+		{Suffix: "Ge", Op: "lib.OpGe"},
+	}
+	if isBoolField(field.Type) {
+		valueOps = valueOps[:2]
+	}
+
+	methods := make([]gopkg.DeclFunc, 0, len(valueOps) + 4)
+	for _, op := range valueOps {
+		methods = append(methods, gopkg.DeclFunc{
+			Name: field.Name + op.Suffix,
+			Receiver: queryReceiver(),
+			Args: []gopkg.DeclVar{
+				{
+					Name: "v",
+					Type: field.Type,
+				},
+			},
+			ReturnArgs: tmpl.UnnamedReturnArgs(
+				queryType(),
+			),
+			BodyTmpl: `
+	return q.with(lib.Cond{Column: "` + column + `", Op: ` + op.Op + `, Value: v})
+`,
+		})
+	}
+
+	if isStringField(field.Type, d.PkgTypes) {
+		methods = append(methods, gopkg.DeclFunc{
+			Name: field.Name + "Like",
+			Receiver: queryReceiver(),
+			Args: []gopkg.DeclVar{
+				{
+					Name: "pattern",
+					Type: gopkg.TypeString{},
+				},
+			},
+			ReturnArgs: tmpl.UnnamedReturnArgs(
+				queryType(),
+			),
+			BodyTmpl: `
+	return q.with(lib.Cond{Column: "` + column + `", Op: lib.OpLike, Value: pattern})
+`,
+		})
+	}
+
+	methods = append(methods, gopkg.DeclFunc{
+		Name: field.Name + "In",
+		Receiver: queryReceiver(),
+		Args: []gopkg.DeclVar{
+			{
+				Name: "v",
+				Type: gopkg.TypeArray{
+					ValueType: field.Type,
+				},
+			},
+		},
+		VariadicLastArg: true,
+		ReturnArgs: tmpl.UnnamedReturnArgs(
+			queryType(),
+		),
+		BodyTmpl: `
+	return q.with(lib.Cond{Column: "` + column + `", Op: lib.OpIn, Value: v})
+`,
+	})
+
+	if !isNullableColumn(field) {
+		return methods
+	}
+
+	return append(
+		methods,
+		gopkg.DeclFunc{
+			Name: field.Name + "IsNull",
+			Receiver: queryReceiver(),
+			ReturnArgs: tmpl.UnnamedReturnArgs(
+				queryType(),
+			),
+			BodyTmpl: `
+	return q.with(lib.Cond{Column: "` + column + `", Op: lib.OpIsNull})
+`,
+		},
+		gopkg.DeclFunc{
+			Name: field.Name + "IsNotNull",
+			Receiver: queryReceiver(),
+			ReturnArgs: tmpl.UnnamedReturnArgs(
+				queryType(),
+			),
+			BodyTmpl: `
+	return q.with(lib.Cond{Column: "` + column + `", Op: lib.OpIsNotNull})
+`,
+		},
+	)
+}
+
+// queryOrMethod returns the `Or` method, which adds a condition matching the
+// rows which satisfy any one of the given queries
+func queryOrMethod() gopkg.DeclFunc {
+	return gopkg.DeclFunc{
+		Name: "Or",
+		Receiver: queryReceiver(),
+		Args: []gopkg.DeclVar{
+			{
+				Name: "alts",
+				Type: gopkg.TypeArray{
+					ValueType: queryType(),
+				},
+			},
+		},
+		VariadicLastArg: true,
+		ReturnArgs: tmpl.UnnamedReturnArgs(
+			queryType(),
+		),
+		BodyTmpl: `
+	conds := make([][]lib.Cond, 0, len(alts))
+	for _, alt := range alts {
+		conds = append(conds, alt)
+	}
+
+	return q.with(lib.Or(conds...))
+`,
+	}
+}
+
+func queryWithMethod() gopkg.DeclFunc {
+	return gopkg.DeclFunc{
+		Name: "with",
+		Receiver: queryReceiver(),
+		Args: []gopkg.DeclVar{
+			{
+				Name: "c",
+				Type: gopkg.TypeNamed{
+					Name: "Cond",
+					Import: "github.com/thecodedproject/dbcrudgen/lib",
+				},
+			},
+		},
+		ReturnArgs: tmpl.UnnamedReturnArgs(
+			queryType(),
+		),
+		BodyTmpl: `
+	// Copy the existing conditions so that queries built from a common base
+	// do not share (and overwrite) the same backing array
+	conds := make(Query, 0, len(q)+1)
+	conds = append(conds, q...)
+
+	return append(conds, c)
+`,
+	}
+}
+
+func queryReceiver() gopkg.FuncReceiver {
+	return gopkg.FuncReceiver{
+		VarName: "q",
+		TypeName: "Query",
+	}
+}
+
+func queryType() gopkg.Type {
+	return gopkg.TypeNamed{
+		Name: "Query",
+	}
+}
@@ -0,0 +1,215 @@
+package internal
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/iancoleman/strcase"
+	"github.com/thecodedproject/gopkg"
+	"github.com/thecodedproject/gopkg/tmpl"
+)
+
+// fileDBRepository returns the `db_repository.go` of each model, which has
+// the `Repository` interface of the model's CRUD methods, so that callers can
+// depend on it rather than on the package level methods, along with the
+// `sqlRepository` implementation of it which calls the methods in
+// `db_crud.go`
+func fileDBRepository(d pkgDef) func() ([]gopkg.FileContents, error) {
+
+	return func() ([]gopkg.FileContents, error) {
+
+		files := make([]gopkg.FileContents, 0, len(d.DBDataModels))
+		for _, model := range d.DBDataModels {
+
+			dbcrudDir := strcase.ToSnake(model.Name)
+			dbcrudImport := path.Join(d.Import.Import, dbcrudDir)
+
+			modelName := model.Name
+			modelStruct, ok := model.Type.(gopkg.TypeStruct)
+			if !ok {
+				return nil, errors.New("found datamodel which is not of type struct")
+			}
+
+			keys, err := uniqueKeys(modelStruct)
+			if err != nil {
+				return nil, err
+			}
+
+			crudMethods, _, err := dbCrudMethods(d, modelName, modelStruct, keys)
+			if err != nil {
+				return nil, err
+			}
+
+			methods := repositoryMethods(crudMethods)
+
+			functions := []gopkg.DeclFunc{
+				newRepositoryMethod(),
+			}
+			for _, m := range methods {
+				functions = append(functions, sqlRepositoryMethod(d, m))
+			}
+
+			files = append(files, gopkg.FileContents{
+				Filepath: filepath.Join(d.OutputPath, dbcrudDir, "db_repository.go"),
+				PackageName: dbcrudDir,
+				PackageImportPath: dbcrudImport,
+				Imports: tmpl.UnnamedImports(
+					"github.com/thecodedproject/dbcrudgen/lib",
+				),
+				Types: []gopkg.DeclType{
+					repositoryType(methods),
+					sqlRepositoryType(),
+				},
+				Functions: functions,
+			})
+		}
+
+		return files, nil
+	}
+}
+
+// repositoryMethods returns the methods of `db_crud.go` which are part of the
+// `Repository` interface, which are all the exported methods other than
+// `CreateTable` (as creating tables is not part of a model's CRUD)
+func repositoryMethods(
+	crudMethods []gopkg.DeclFunc,
+) []gopkg.DeclFunc {
+
+	methods := make([]gopkg.DeclFunc, 0, len(crudMethods))
+	for _, m := range crudMethods {
+		if m.Name == "CreateTable" || !unicode.IsUpper([]rune(m.Name)[0]) {
+			continue
+		}
+
+		methods = append(methods, m)
+	}
+
+	return methods
+}
+
+// repositoryArgs returns the args of `crudMethod` as a method of the
+// `Repository` interface, which are the same args without the `lib.DBTX`
+// (as that is held by the repository)
+func repositoryArgs(
+	crudMethod gopkg.DeclFunc,
+) []gopkg.DeclVar {
+
+	args := make([]gopkg.DeclVar, 0, len(crudMethod.Args))
+	for _, a := range crudMethod.Args {
+		if a == dbArg() {
+			continue
+		}
+
+		args = append(args, a)
+	}
+
+	return args
+}
+
+// repositoryType returns the `Repository` interface, which has a method for
+// each of the CRUD methods of the model
+func repositoryType(
+	methods []gopkg.DeclFunc,
+) gopkg.DeclType {
+
+	funcs := make([]gopkg.DeclFunc, 0, len(methods))
+	for _, m := range methods {
+		funcs = append(funcs, gopkg.DeclFunc{
+			Name: m.Name,
+			Args: repositoryArgs(m),
+			VariadicLastArg: m.VariadicLastArg,
+			ReturnArgs: m.ReturnArgs,
+		})
+	}
+
+	return gopkg.DeclType{
+		Name: "Repository",
+		Type: gopkg.TypeInterface{
+			Funcs: funcs,
+		},
+	}
+}
+
+// sqlRepositoryType returns the `sqlRepository` struct, which wraps the
+// `lib.DBTX` which its methods are run on
+func sqlRepositoryType() gopkg.DeclType {
+
+	return gopkg.DeclType{
+		Name: "sqlRepository",
+		Type: gopkg.TypeStruct{
+			Fields: []gopkg.DeclVar{
+				dbArg(),
+			},
+		},
+	}
+}
+
+// newRepositoryMethod returns the `NewRepository` constructor, which returns
+// the `sqlRepository` on the given `lib.DBTX`
+func newRepositoryMethod() gopkg.DeclFunc {
+
+	return gopkg.DeclFunc{
+		Name: "NewRepository",
+		Args: []gopkg.DeclVar{
+			dbArg(),
+		},
+		ReturnArgs: tmpl.UnnamedReturnArgs(
+			gopkg.TypeNamed{
+				Name: "Repository",
+			},
+		),
+		BodyTmpl: `
+	return &sqlRepository{
+		db: db,
+	}
+`,
+	}
+}
+
+// sqlRepositoryMethod returns the method of `sqlRepository` which calls the
+// CRUD method `crudMethod` with the repository's `lib.DBTX`.
+//
+// With `--db_context` the CRUD methods get the DB from the context they are
+// called with, so the `lib.DBTX` is put on the context, unless the context
+// already has a transaction (from `lib.WithTx`), which the call then joins
+func sqlRepositoryMethod(
+	d pkgDef,
+	crudMethod gopkg.DeclFunc,
+) gopkg.DeclFunc {
+
+	ctxCode := ""
+	if d.UseDBContext {
+		ctxCode = `
+	ctx = lib.ContextWithDBTX(ctx, r.db)`
+	}
+
+	callArgs := make([]string, 0, len(crudMethod.Args))
+	for i, a := range crudMethod.Args {
+		switch {
+		case a == dbArg():
+			callArgs = append(callArgs, "r.db")
+		case crudMethod.VariadicLastArg && i == len(crudMethod.Args) - 1:
+			callArgs = append(callArgs, a.Name + "...")
+		default:
+			callArgs = append(callArgs, a.Name)
+		}
+	}
+
+	return gopkg.DeclFunc{
+		Name: crudMethod.Name,
+		Receiver: gopkg.FuncReceiver{
+			VarName: "r",
+			TypeName: "sqlRepository",
+			IsPointer: true,
+		},
+		Args: repositoryArgs(crudMethod),
+		VariadicLastArg: crudMethod.VariadicLastArg,
+		ReturnArgs: crudMethod.ReturnArgs,
+		BodyTmpl: ctxCode + `
+	return ` + crudMethod.Name + `(` + strings.Join(callArgs, ", ") + `)
+`,
+	}
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"path/filepath"
+
+	"github.com/thecodedproject/gopkg"
+	"github.com/thecodedproject/gopkg/tmpl"
+)
+
+// fileDBSchema returns the package level `db_schema.go`, which has the
+// methods which apply the package `schema.sql` and the migrations (if
+// generated with `--migrations_dir`) embedded by the package `db_embed.go`
+func fileDBSchema(d pkgDef) func() ([]gopkg.FileContents, error) {
+
+	return func() ([]gopkg.FileContents, error) {
+
+		imports := tmpl.UnnamedImports(
+			"github.com/thecodedproject/dbcrudgen/lib",
+		)
+
+		functions := []gopkg.DeclFunc{
+			createAllTablesMethod(d),
+		}
+
+		if d.MigrationsDir != "" {
+			imports = append(imports, tmpl.UnnamedImports("io/fs")...)
+			functions = append(functions, migrateMethod(d))
+		}
+
+		return []gopkg.FileContents{
+			{
+				Filepath: filepath.Join(d.OutputPath, "db_schema.go"),
+				PackageName: d.Import.Alias,
+				PackageImportPath: d.Import.Import,
+				Imports: imports,
+				Functions: functions,
+			},
+		}, nil
+	}
+}
+
+// createAllTablesMethod returns the `CreateAllTables` method, which applies
+// the embedded package schema, creating the tables (and indexes) which do not
+// exist every time it is called.
+//
+// Changes to the tables which do exist are not applied, and are applied with
+// the migrations generated with `--migrations_dir` instead.
+func createAllTablesMethod(
+	d pkgDef,
+) gopkg.DeclFunc {
+
+	return gopkg.DeclFunc{
+		Name: "CreateAllTables",
+		Args: dbMethodArgs(d.UseDBContext),
+		ReturnArgs: tmpl.UnnamedReturnArgs(
+			gopkg.TypeError{},
+		),
+		BodyTmpl: dbContextExtractionCode(d) + `
+	return lib.ExecSchema(ctx, db, Schema)
+`,
+	}
+}
+
+// migrateMethod returns the `Migrate` method, which applies the embedded
+// migrations which have not yet been applied to a DB
+func migrateMethod(
+	d pkgDef,
+) gopkg.DeclFunc {
+
+	return gopkg.DeclFunc{
+		Name: "Migrate",
+		Args: dbMethodArgs(d.UseDBContext),
+		ReturnArgs: tmpl.UnnamedReturnArgs(
+			gopkg.TypeError{},
+		),
+		BodyTmpl: dbContextExtractionCode(d) + `
+	migrations, err := fs.Sub(Migrations, "` + filepath.ToSlash(d.MigrationsDir) + `")
+	if err != nil {
+		return err
+	}
+
+	return lib.ApplyMigrations(
+		ctx,
+		db,
+		` + d.Dialect.placeholdersCode() + `,
+		migrations,
+	)
+`,
+	}
+}
@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"path/filepath"
+
+	"github.com/thecodedproject/gopkg"
+	"github.com/thecodedproject/gopkg/tmpl"
+)
+
+// fileDBSchemaTest returns the package level `db_schema_test.go`, which tests
+// the `Migrate` method of packages generated with `--migrations_dir`
+func fileDBSchemaTest(d pkgDef) func() ([]gopkg.FileContents, error) {
+
+	return func() ([]gopkg.FileContents, error) {
+
+		if d.MigrationsDir == "" {
+			return nil, nil
+		}
+
+		imports := tmpl.UnnamedImports(
+			"context",
+			"path/filepath",
+			"github.com/stretchr/testify/require",
+			"github.com/thecodedproject/dbcrudgen/lib",
+		)
+		imports = append(imports, testDBImports(d)...)
+		imports = append(imports, d.Import)
+
+		functions := []gopkg.DeclFunc{
+			testfuncMigrate(d),
+		}
+
+		if d.Dialect == dialectPostgres {
+			functions = append(functions, testMainPostgres())
+		} else {
+			imports = append(imports, tmpl.UnnamedImports("os")...)
+		}
+
+		return []gopkg.FileContents{
+			{
+				Filepath: filepath.Join(d.OutputPath, "db_schema_test.go"),
+				PackageName: d.Import.Alias + "_test",
+				PackageImportPath: d.Import.Import + "_test",
+				Imports: imports,
+				Functions: functions,
+			},
+		}, nil
+	}
+}
+
+// testfuncMigrate returns the test of `Migrate`, which applies the embedded
+// migrations to an empty DB twice, where the second run applies nothing as
+// every migration is recorded as applied by the first
+func testfuncMigrate(
+	d pkgDef,
+) gopkg.DeclFunc {
+
+	ctxCode := `ctx := context.Background()`
+	ctxAndDbArgs := `ctx, db`
+	if d.UseDBContext {
+		ctxCode = `ctx := lib.ContextWithDB(context.Background(), db)`
+		ctxAndDbArgs = `ctx`
+	}
+
+	return gopkg.DeclFunc{
+		Name: "TestMigrate",
+		Args: []gopkg.DeclVar{
+			testingArg(),
+		},
+		BodyTmpl: `
+	emptySchema := filepath.Join(t.TempDir(), "schema.sql")
+	err := os.WriteFile(emptySchema, nil, 0o644)
+	require.NoError(t, err)
+
+	db := ` + openDBCode(d, "emptySchema") + `
+	` + ctxCode + `
+
+	err = ` + d.Import.Alias + `.Migrate(` + ctxAndDbArgs + `)
+	require.NoError(t, err)
+
+	var applied int64
+	err = db.QueryRowContext(ctx, "select count(*) from " + lib.MigrationsTable).Scan(&applied)
+	require.NoError(t, err)
+	require.True(t, applied > 0)
+
+	err = ` + d.Import.Alias + `.Migrate(` + ctxAndDbArgs + `)
+	require.NoError(t, err)
+
+	var reapplied int64
+	err = db.QueryRowContext(ctx, "select count(*) from " + lib.MigrationsTable).Scan(&reapplied)
+	require.NoError(t, err)
+	require.Equal(t, applied, reapplied)
+`,
+	}
+}
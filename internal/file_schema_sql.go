@@ -2,7 +2,9 @@ package internal
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/pkg/errors"
 
@@ -11,85 +13,227 @@ import (
 	"github.com/thecodedproject/gosql"
 )
 
+type sqlTable struct {
+	Name string
+	Fields []sqlField
+	// PrimaryKey are the columns of the primary key set by `pk` options, which
+	// is empty if the table has an auto increment `id`
+	PrimaryKey []string
+	UniqueKeys []tableKey
+	Indexes []tableKey
+	ForeignKeys []foreignKey
+}
+
+type sqlField struct {
+	Name string
+	Type string
+	PrimaryKey bool
+	AutoIncrement bool
+	Nullable bool
+	Default string
+}
+
 func generateSchemaSql(
 	d pkgDef,
 ) error {
 
 	for _, m := range d.DBDataModels {
 
-		tableSchema := gosql.CreateTable{
-			Name: strcase.ToSnake(m.Name),
+		// The tables referenced by the model's foreign keys are created first
+		// (if they do not exist), so that the schema can be applied on its
+		// own as well as after the schemas of those tables
+		deps, err := modelDependencies(d.DBDataModels, m.Name)
+		if err != nil {
+			return err
 		}
 
-		mStruct, ok := m.Type.(gopkg.TypeStruct)
-		if !ok {
-			return errors.New("found datamodel which is not of type struct")
+		depsSchema, err := schemaForModels(d, deps, true)
+		if err != nil {
+			return err
 		}
 
-		for _, f := range mStruct.Fields {
-			sqlField, err := makeSqlField(f, d.PkgTypes)
-			if err != nil {
-				return errors.Wrap(
-					err,
-					fmt.Sprintf("error making sql field for '%s.%s'", m.Name, f.Name),
-				)
-			}
+		schema, err := schemaForModels(d, []gopkg.DeclType{m}, d.IfNotExists)
+		if err != nil {
+			return err
+		}
 
-			tableSchema.Fields = append(tableSchema.Fields, sqlField)
+		if depsSchema != "" {
+			schema = depsSchema + "\n" + schema
 		}
 
-		err := gosql.GenerateSchema(
+		err = writeSchemaFile(
 			filepath.Join(d.OutputPath, strcase.ToSnake(m.Name), "schema.sql"),
-			[]gosql.Statement{
-				tableSchema,
-			},
+			schema,
 		)
 		if err != nil {
 			return err
 		}
 	}
 
-	return nil
+	// The package schema is applied by `CreateAllTables`, which creates the
+	// tables which do not exist every time it is called
+	models, err := dependencyOrderedModels(d.DBDataModels)
+	if err != nil {
+		return err
+	}
+
+	schema, err := schemaForModels(d, models, true)
+	if err != nil {
+		return err
+	}
+
+	return writeSchemaFile(
+		filepath.Join(d.OutputPath, "schema.sql"),
+		schema,
+	)
+}
+
+// schemaForModels returns the `create table` statements for the tables of
+// `models`, in the order given, which only create the tables (and their
+// indexes) if they do not exist if `ifNotExists` is set
+func schemaForModels(
+	d pkgDef,
+	models []gopkg.DeclType,
+	ifNotExists bool,
+) (string, error) {
+
+	var schema string
+	for _, m := range models {
+		tableSchema, err := makeSqlTable(d, m)
+		if err != nil {
+			return "", err
+		}
+
+		if schema != "" {
+			schema += "\n"
+		}
+		schema += createTableStatement(d.Dialect, tableSchema, ifNotExists)
+	}
+
+	return schema, nil
+}
+
+func makeSqlTable(
+	d pkgDef,
+	m gopkg.DeclType,
+) (sqlTable, error) {
+
+	tableSchema := sqlTable{
+		Name: strcase.ToSnake(m.Name),
+	}
+
+	mStruct, ok := m.Type.(gopkg.TypeStruct)
+	if !ok {
+		return sqlTable{}, errors.New("found datamodel which is not of type struct")
+	}
+
+	for _, f := range mStruct.Fields {
+		sqlField, err := makeSqlField(d.Dialect, f, d.PkgTypes)
+		if err != nil {
+			return sqlTable{}, errors.Wrap(
+				err,
+				fmt.Sprintf("error making sql field for '%s.%s'", m.Name, f.Name),
+			)
+		}
+
+		tableSchema.Fields = append(tableSchema.Fields, sqlField)
+	}
+
+	if hasCustomPrimaryKey(mStruct) {
+		tableSchema.PrimaryKey = primaryKey(mStruct).Columns
+	}
+
+	keys, err := uniqueKeys(mStruct)
+	if err != nil {
+		return sqlTable{}, errors.Wrap(
+			err,
+			fmt.Sprintf("error finding unique keys for '%s'", m.Name),
+		)
+	}
+	tableSchema.UniqueKeys = keys
+
+	tableSchema.Indexes, err = indexes(mStruct)
+	if err != nil {
+		return sqlTable{}, errors.Wrap(
+			err,
+			fmt.Sprintf("error finding indexes for '%s'", m.Name),
+		)
+	}
+
+	tableSchema.ForeignKeys, err = foreignKeys(mStruct)
+	if err != nil {
+		return sqlTable{}, errors.Wrap(
+			err,
+			fmt.Sprintf("error finding foreign keys for '%s'", m.Name),
+		)
+	}
+
+	return tableSchema, nil
 }
 
 func makeSqlField(
+	dialect sqlDialect,
 	goField gopkg.DeclVar,
 	enumTypes []gopkg.DeclType,
-) (gosql.Field, error) {
+) (sqlField, error) {
 
-	var sqlType gosql.Type
-	if t := goField.StructTag.Get("dbcrudgen"); t != "" {
-		var err error
-		sqlType, err = gosql.ParseType(t)
+	opts, err := parseFieldOptions(goField)
+	if err != nil {
+		return sqlField{}, err
+	}
+
+	var sqlType string
+	if opts.Type != "" {
+		_, err := gosql.ParseType(opts.Type)
 		if err != nil {
-			return gosql.Field{}, err
+			return sqlField{}, err
 		}
+		sqlType = opts.Type
 	} else {
-		var err error
-		sqlType, err = sqlTypeFromGoType(goField.Type, enumTypes)
+		sqlType, err = sqlTypeFromGoType(dialect, goField.Type, enumTypes)
+		if err != nil {
+			return sqlField{}, err
+		}
+
+		if opts.Size != 0 {
+			sqlType, err = sizedSqlType(dialect, sqlType, opts.Size)
+			if err != nil {
+				return sqlField{}, err
+			}
+		} else if opts.PKUUID {
+			sqlType = "char(36)"
+		}
+	}
+
+	defaultValue := opts.Default
+	if opts.TimestampDB {
+		defaultValue, err = dialect.currentTimestampDefault(opts.Timestamp)
 		if err != nil {
-			return gosql.Field{}, err
+			return sqlField{}, err
 		}
 	}
 
-	fieldName := strcase.ToSnake(goField.Name)
+	fieldName := columnName(goField)
 	var primaryKey bool
-	if fieldName == "id" {
+	if fieldName == "id" && !opts.PK {
 		primaryKey = true
 	}
 
-	return gosql.Field{
+	return sqlField{
 		Name: fieldName,
 		Type: sqlType,
 		PrimaryKey: primaryKey,
 		AutoIncrement: primaryKey,
+		Nullable: isNullableColumn(goField),
+		Default: defaultValue,
 	}, nil
 }
 
 func sqlTypeFromGoType(
+	dialect sqlDialect,
 	goType gopkg.Type,
 	enumTypes []gopkg.DeclType,
-) (gosql.Type, error) {
+) (string, error) {
 
 	typeStr, err := goType.FullType(
 		map[string]string{
@@ -97,38 +241,118 @@ func sqlTypeFromGoType(
 		},
 	)
 	if err != nil {
-		return nil, err
-	}
-
-	switch typeStr {
-	case "[]byte":
-		return gosql.TypeVarChar{N: 255}, nil
-	case "bool":
-		return gosql.TypeBit{}, nil
-	case "float32":
-		return gosql.TypeFloat{}, nil
-	case "float64":
-		return gosql.TypeDouble{}, nil
-	case "int32":
-		return gosql.TypeInt{}, nil
-	case "int64":
-		return gosql.TypeBigInt{}, nil
-	case "string":
-		return gosql.TypeVarChar{N: 255}, nil
-	case "time.Time":
-		return gosql.TypeDateTime{}, nil
+		return "", err
+	}
+
+	if sqlType, ok := sqlTypes[dialect][typeStr]; ok {
+		return sqlType, nil
+	}
+
+	if valueType, ok := nullableValueType(goType); ok {
+		return sqlTypeFromGoType(dialect, valueType, enumTypes)
 	}
 
 	if t, ok := goType.(gopkg.TypeNamed); ok {
 		declT, err := findDeclType(t, enumTypes)
 		if err != nil {
-			return nil, err
+			return "", err
+		}
+
+		return sqlTypeFromGoType(dialect, declT.Type, enumTypes)
+	}
+
+	return "", errors.New("no conversion from go type `" + typeStr + "` to sql type")
+}
+
+// sizedSqlType returns the varchar `sqlType` with its length set to `size`
+func sizedSqlType(
+	dialect sqlDialect,
+	sqlType string,
+	size int,
+) (string, error) {
+
+	if strings.HasPrefix(sqlType, "varchar(") {
+		return fmt.Sprintf("varchar(%d)", size), nil
+	}
+
+	if dialect == dialectSqlite && sqlType == "text" {
+		// sqlite does not enforce the length of text columns
+		return sqlType, nil
+	}
+
+	return "", errors.New("size can only be set on string fields - column type is '" + sqlType + "'")
+}
+
+// createTableStatement returns the `create table` statement for `t` written
+// in the given dialect, which only creates the table (and its indexes) if it
+// does not exist when `ifNotExists` is set
+func createTableStatement(
+	dialect sqlDialect,
+	t sqlTable,
+	ifNotExists bool,
+) string {
+
+	create := "create table "
+	if ifNotExists {
+		create += "if not exists "
+	}
+
+	defs := make([]string, 0, len(t.Fields) + len(t.UniqueKeys) + len(t.ForeignKeys) + len(t.Indexes) + 1)
+	for _, f := range t.Fields {
+		defs = append(defs, f.Name + " " + dialect.columnDefinition(f))
+	}
+
+	if len(t.PrimaryKey) > 0 {
+		defs = append(defs, "primary key (" + strings.Join(t.PrimaryKey, ", ") + ")")
+	}
+
+	for _, k := range t.UniqueKeys {
+		defs = append(defs, "unique (" + strings.Join(k.Columns, ", ") + ")")
+	}
+
+	for _, k := range t.ForeignKeys {
+		def := "foreign key (" + k.Column + ") references " + k.Table() + " (id)"
+		if k.OnDelete != "" {
+			def += " on delete " + k.OnDelete
 		}
+		defs = append(defs, def)
+	}
+
+	if dialect == dialectMysql {
+		for _, k := range t.Indexes {
+			defs = append(defs, "index " + k.Name + " (" + strings.Join(k.Columns, ", ") + ")")
+		}
+	}
+
+	s := create + t.Name + " (\n  " + strings.Join(defs, ",\n  ") + "\n);\n"
+
+	if dialect != dialectMysql {
+		// Only mysql can declare indexes in `create table`, and the names of
+		// indexes are not scoped to their table in other dialects
+		for _, k := range t.Indexes {
+			s += createIndexStatement(dialect, t.Name, k, ifNotExists)
+		}
+	}
+
+	return s
+}
+
+func writeSchemaFile(
+	filePath string,
+	statements ...string,
+) error {
+
+	err := os.MkdirAll(filepath.Dir(filePath), 0755)
+	if err != nil {
+		return err
+	}
 
-		return sqlTypeFromGoType(declT.Type, enumTypes)
+	var schema string
+	for _, s := range statements {
+		schema += s
 	}
 
-	return nil, errors.New("no conversion from go type `" + typeStr + "` to sql type")
+	return os.WriteFile(filePath, []byte(schema), 0644)
 }
 
 func findDeclType(
@@ -0,0 +1,249 @@
+package internal
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/iancoleman/strcase"
+	"github.com/thecodedproject/gopkg"
+)
+
+// foreignKey is a column of a data model which references the id of another
+// data model, declared with the `references` field option
+type foreignKey struct {
+	// Field is the name of the data model field of the column
+	Field string
+	Column string
+	// Model is the name of the referenced data model
+	Model string
+	// OnDelete is the SQL `on delete` action, if set
+	OnDelete string
+}
+
+// Table returns the name of the referenced table
+func (k foreignKey) Table() string {
+	return strcase.ToSnake(k.Model)
+}
+
+// Name returns the name used for the referenced row in the generated join
+// methods and types, which is the field name without its `ID` suffix (e.g.
+// `Author` for `AuthorID`)
+func (k foreignKey) Name() string {
+
+	if name := strings.TrimSuffix(k.Field, "ID"); name != "" {
+		return name
+	}
+
+	return k.Field
+}
+
+// foreignKeys returns the foreign keys declared on the fields of
+// `modelStruct`
+func foreignKeys(
+	modelStruct gopkg.TypeStruct,
+) ([]foreignKey, error) {
+
+	var keys []foreignKey
+	for _, f := range modelStruct.Fields {
+		opts, err := parseFieldOptions(f)
+		if err != nil {
+			return nil, err
+		}
+
+		if opts.References == "" {
+			continue
+		}
+
+		keys = append(keys, foreignKey{
+			Field: f.Name,
+			Column: columnName(f),
+			Model: opts.References,
+			OnDelete: opts.OnDelete,
+		})
+	}
+
+	return keys, nil
+}
+
+// isForeignKeyField returns true if `f` references another data model
+func isForeignKeyField(f gopkg.DeclVar) bool {
+
+	opts, err := parseFieldOptions(f)
+	if err != nil {
+		return false
+	}
+
+	return opts.References != ""
+}
+
+// isSelfReferenceField returns true if `f` references the data model
+// `modelName` which it is a field of
+func isSelfReferenceField(f gopkg.DeclVar, modelName string) bool {
+
+	opts, err := parseFieldOptions(f)
+	if err != nil {
+		return false
+	}
+
+	return opts.References == modelName
+}
+
+// validateForeignKeys checks that every foreign key references the auto
+// increment id of one of `models` and that the references between the models
+// have no cycles (other than models which reference themselves, with
+// nullable foreign keys so that the first row can be inserted)
+func validateForeignKeys(models []gopkg.DeclType) error {
+
+	modelNames := make(map[string]bool, len(models))
+	customPKs := make(map[string]bool, len(models))
+	for _, m := range models {
+		modelNames[m.Name] = true
+		if mStruct, ok := m.Type.(gopkg.TypeStruct); ok {
+			customPKs[m.Name] = hasCustomPrimaryKey(mStruct)
+		}
+	}
+
+	for _, m := range models {
+		mStruct, ok := m.Type.(gopkg.TypeStruct)
+		if !ok {
+			return errors.New("found datamodel which is not of type struct")
+		}
+
+		for _, f := range mStruct.Fields {
+			if !isForeignKeyField(f) {
+				continue
+			}
+
+			opts, err := parseFieldOptions(f)
+			if err != nil {
+				return err
+			}
+
+			if !modelNames[opts.References] {
+				return errors.New("invalid dbcrudgen tag on " + m.Name + "." + f.Name + ": references unknown data model '" + opts.References + "'")
+			}
+
+			if customPKs[opts.References] {
+				return errors.New("invalid dbcrudgen tag on " + m.Name + "." + f.Name + ": references data model '" + opts.References + "', which has no auto increment id")
+			}
+
+			valueType := f.Type
+			if t, ok := nullableValueType(f.Type); ok {
+				valueType = t
+			}
+
+			if _, ok := valueType.(gopkg.TypeInt64); !ok {
+				return errors.New("invalid dbcrudgen tag on " + m.Name + "." + f.Name + ": foreign keys must be int64 fields")
+			}
+
+			if opts.References == m.Name && !isNullableColumn(f) {
+				return errors.New("invalid dbcrudgen tag on " + m.Name + "." + f.Name + ": foreign keys which reference their own data model must be nullable")
+			}
+
+			if opts.References == m.Name && strings.TrimSuffix(f.Name, "ID") == m.Name {
+				return errors.New("invalid dbcrudgen tag on " + m.Name + "." + f.Name + ": foreign keys which reference their own data model must not be named after it")
+			}
+		}
+
+		_, err := modelDependencies(models, m.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// modelDependencies returns the data models referenced (directly or through
+// other models) by the foreign keys of `modelName`, ordered so that every
+// model comes after the models it references
+//
+// Foreign keys which reference their own model are left out, as they don't
+// affect the order the tables are created in.
+func modelDependencies(
+	models []gopkg.DeclType,
+	modelName string,
+) ([]gopkg.DeclType, error) {
+
+	byName := make(map[string]gopkg.DeclType, len(models))
+	for _, m := range models {
+		byName[m.Name] = m
+	}
+
+	var deps []gopkg.DeclType
+	visited := make(map[string]bool)
+	visiting := make(map[string]bool)
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		if visiting[name] {
+			return errors.New("foreign keys form a cycle: " + strings.Join(append(path, name), " -> "))
+		}
+		if visited[name] {
+			return nil
+		}
+		visiting[name] = true
+
+		mStruct, ok := byName[name].Type.(gopkg.TypeStruct)
+		if !ok {
+			return errors.New("found datamodel which is not of type struct")
+		}
+
+		keys, err := foreignKeys(mStruct)
+		if err != nil {
+			return err
+		}
+
+		for _, k := range keys {
+			if k.Model == name {
+				continue
+			}
+
+			err := visit(k.Model, append(path, name))
+			if err != nil {
+				return err
+			}
+		}
+
+		visiting[name] = false
+		visited[name] = true
+		if name != modelName {
+			deps = append(deps, byName[name])
+		}
+		return nil
+	}
+
+	err := visit(modelName, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return deps, nil
+}
+
+// dependencyOrderedModels returns all of `models`, ordered so that every model
+// comes after the models it references (and otherwise in the order given)
+func dependencyOrderedModels(
+	models []gopkg.DeclType,
+) ([]gopkg.DeclType, error) {
+
+	ordered := make([]gopkg.DeclType, 0, len(models))
+	added := make(map[string]bool, len(models))
+	for _, m := range models {
+		deps, err := modelDependencies(models, m.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, dep := range append(deps, m) {
+			if added[dep.Name] {
+				continue
+			}
+
+			ordered = append(ordered, dep)
+			added[dep.Name] = true
+		}
+	}
+
+	return ordered, nil
+}
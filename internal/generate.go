@@ -14,6 +14,11 @@ var (
 	//publicInsert = flag.Bool("public_insert", "
 
 	useDBContext = flag.Bool("db_context", false, "use DB context in generated methods")
+	dialect = flag.String("dialect", "mysql", "SQL dialect of the generated schema and methods (mysql, postgres or sqlite)")
+	maxRows = flag.String("max_rows", "1000", "max rows returned by the generated select methods before erroring (a positive integer or unlimited)")
+	migrationsDir = flag.String("migrations_dir", "", "directory (relative to the output directory) to write numbered up/down migrations of schema changes to, along with a Migrate method which applies them (no migrations are generated if empty)")
+	ifNotExists = flag.Bool("if_not_exists", false, "create the tables and indexes of the data models in their generated schemas only if they do not exist (the tables they reference, and the tables in the package schema, are always only created if they do not exist)")
+	mocks = flag.Bool("mocks", false, "also generate a db_mock.go for each data model with a MockRepository, which returns the values set for the calls expected of it and records the calls made to it")
 )
 
 type pkgDef struct {
@@ -22,6 +27,12 @@ type pkgDef struct {
 	DBDataModels []gopkg.DeclType
 	PkgTypes []gopkg.DeclType
 	UseDBContext bool
+	Dialect sqlDialect
+	MaxRows int64
+	ModelOptions map[string]modelOptions
+	IfNotExists bool
+	MigrationsDir string
+	Mocks bool
 }
 
 func Generate() error {
@@ -38,11 +49,27 @@ func Generate() error {
 		return err
 	}
 
+	err = generateMigrations(d)
+	if err != nil {
+		return err
+	}
+
+	err = generateEmbedFiles(d)
+	if err != nil {
+		return err
+	}
+
 	var files []gopkg.FileContents
 	files, err = tmpl.AppendFileContents(
 		files,
 		fileDBCrud(d),
+		fileDBQuery(d),
+		fileDBRepository(d),
+		fileDBFake(d),
+		fileDBMock(d),
 		fileDBCrudTest(d),
+		fileDBSchema(d),
+		fileDBSchemaTest(d),
 	)
 	if err != nil {
 		return err
@@ -70,6 +97,31 @@ func createPkgDef() (pkgDef, error) {
 		return pkgDef{}, err
 	}
 
+	err = validateFieldOptions(models)
+	if err != nil {
+		return pkgDef{}, err
+	}
+
+	err = validateForeignKeys(models)
+	if err != nil {
+		return pkgDef{}, err
+	}
+
+	dbDialect, err := parseSqlDialect(*dialect)
+	if err != nil {
+		return pkgDef{}, err
+	}
+
+	defaultMaxRows, err := parseMaxRows(*maxRows)
+	if err != nil {
+		return pkgDef{}, err
+	}
+
+	options, err := findModelOptions(".")
+	if err != nil {
+		return pkgDef{}, err
+	}
+
 	return pkgDef{
 		OutputPath: *outputPath,
 		Import: gopkg.ImportAndAlias{
@@ -79,6 +131,12 @@ func createPkgDef() (pkgDef, error) {
 		DBDataModels: models,
 		PkgTypes: allPkgTypes(currentPkg),
 		UseDBContext: *useDBContext,
+		Dialect: dbDialect,
+		MaxRows: defaultMaxRows,
+		ModelOptions: options,
+		IfNotExists: *ifNotExists,
+		MigrationsDir: *migrationsDir,
+		Mocks: *mocks,
 	}, nil
 }
 
@@ -0,0 +1,503 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// migrationStep is a single change to the schema, with the statements which
+// apply it and revert it
+type migrationStep struct {
+	Up string
+	Down string
+	// Warning is set for changes which may lose data or fail to apply, and is
+	// written as a comment before the up statement
+	Warning string
+	// ByHand is set (instead of the statements) for changes which cannot be
+	// migrated by a generated migration
+	ByHand string
+}
+
+var migrationFileRegexp = regexp.MustCompile(`^([0-9]+)_.*\.up\.sql$`)
+
+// generateMigrations writes a numbered up/down migration to the migrations
+// directory with the changes between the schema of the data models and the
+// schema snapshot of the latest migration, along with a new snapshot.
+//
+// The snapshots are written alongside the migrations and never changed, so
+// that the migrations in the directory are only ever added to.
+//
+// Changes which cannot be migrated by a generated migration fail the
+// generation, and must be migrated by a migration written by hand. The latest
+// migration is taken to be written by hand if it has no snapshot, in which
+// case it is taken to migrate to the schema of the data models and their
+// snapshot is written for it.
+func generateMigrations(
+	d pkgDef,
+) error {
+
+	if d.MigrationsDir == "" {
+		return nil
+	}
+
+	dir := filepath.Join(d.OutputPath, d.MigrationsDir)
+
+	models, err := dependencyOrderedModels(d.DBDataModels)
+	if err != nil {
+		return err
+	}
+
+	tables := make([]sqlTable, 0, len(models))
+	for _, m := range models {
+		t, err := makeSqlTable(d, m)
+		if err != nil {
+			return err
+		}
+
+		tables = append(tables, t)
+	}
+
+	snapshot, err := json.MarshalIndent(tables, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	lastNum, lastPrefix, prevTables, err := latestMigration(dir)
+	if err != nil {
+		return err
+	}
+
+	if lastNum > 0 && prevTables == nil {
+		return writeSchemaFile(lastPrefix + ".schema.json", string(snapshot) + "\n")
+	}
+
+	steps := diffSchema(d.Dialect, prevTables, tables)
+	if len(steps) == 0 {
+		return nil
+	}
+
+	name := "update_schema"
+	if lastNum == 0 {
+		name = "initial_schema"
+	}
+	prefix := filepath.Join(dir, fmt.Sprintf("%04d_%s", lastNum + 1, name))
+
+	var byHand []string
+	for _, s := range steps {
+		if s.ByHand != "" {
+			byHand = append(byHand, s.ByHand)
+		}
+	}
+
+	if len(byHand) > 0 {
+		return errors.New(
+			filepath.Base(prefix) + ": " + strings.Join(byHand, "; ") +
+				"; the changes must be migrated by hand, by writing the migration to " +
+				prefix + ".up.sql and .down.sql and generating again (which writes its schema snapshot)",
+		)
+	}
+
+	var up, down string
+	for i, s := range steps {
+		if s.Warning != "" {
+			fmt.Fprintln(os.Stderr, "warning: " + filepath.Base(prefix) + ": " + s.Warning)
+			up += "-- WARNING: " + s.Warning + "\n"
+		}
+		up += s.Up
+
+		// The down migration reverts the steps in reverse order
+		down += steps[len(steps) - 1 - i].Down
+	}
+
+	err = writeSchemaFile(prefix + ".up.sql", up)
+	if err != nil {
+		return err
+	}
+
+	err = writeSchemaFile(prefix + ".down.sql", down)
+	if err != nil {
+		return err
+	}
+
+	return writeSchemaFile(prefix + ".schema.json", string(snapshot) + "\n")
+}
+
+// latestMigration returns the number of the latest migration in `dir`, the
+// path of its files without their suffixes, and the tables in its schema
+// snapshot (which are nil if it has no snapshot, as it was written by hand),
+// or zero if there are no migrations
+func latestMigration(
+	dir string,
+) (int, string, []sqlTable, error) {
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, "", nil, nil
+	} else if err != nil {
+		return 0, "", nil, err
+	}
+
+	var lastNum int
+	var lastFile string
+	for _, e := range entries {
+		match := migrationFileRegexp.FindStringSubmatch(e.Name())
+		if match == nil {
+			continue
+		}
+
+		num, err := strconv.Atoi(match[1])
+		if err != nil {
+			return 0, "", nil, err
+		}
+
+		if num > lastNum {
+			lastNum = num
+			lastFile = e.Name()
+		}
+	}
+
+	if lastNum == 0 {
+		return 0, "", nil, nil
+	}
+
+	prefix := filepath.Join(dir, strings.TrimSuffix(lastFile, ".up.sql"))
+	snapshotPath := prefix + ".schema.json"
+	buf, err := os.ReadFile(snapshotPath)
+	if os.IsNotExist(err) {
+		return lastNum, prefix, nil, nil
+	} else if err != nil {
+		return 0, "", nil, errors.Wrap(err, "cannot read schema snapshot of latest migration")
+	}
+
+	tables := make([]sqlTable, 0)
+	err = json.Unmarshal(buf, &tables)
+	if err != nil {
+		return 0, "", nil, errors.Wrap(err, "invalid schema snapshot '" + snapshotPath + "'")
+	}
+
+	return lastNum, prefix, tables, nil
+}
+
+// diffSchema returns the steps which change the schema with tables `prev`
+// into the schema with tables `next`
+func diffSchema(
+	dialect sqlDialect,
+	prev []sqlTable,
+	next []sqlTable,
+) []migrationStep {
+
+	prevByName := make(map[string]sqlTable, len(prev))
+	for _, t := range prev {
+		prevByName[t.Name] = t
+	}
+
+	nextByName := make(map[string]sqlTable, len(next))
+	for _, t := range next {
+		nextByName[t.Name] = t
+	}
+
+	var steps []migrationStep
+	for _, t := range next {
+		prevTable, ok := prevByName[t.Name]
+		if !ok {
+			steps = append(steps, migrationStep{
+				Up: createTableStatement(dialect, t, false),
+				Down: "drop table " + t.Name + ";\n",
+			})
+			continue
+		}
+
+		steps = append(steps, diffTable(dialect, prevTable, t)...)
+	}
+
+	// Tables are dropped in reverse order, so that tables are dropped before
+	// the tables they reference
+	for i := len(prev) - 1; i >= 0; i-- {
+		t := prev[i]
+		if _, ok := nextByName[t.Name]; ok {
+			continue
+		}
+
+		steps = append(steps, migrationStep{
+			Up: "drop table " + t.Name + ";\n",
+			Down: createTableStatement(dialect, t, false),
+			Warning: "drops table " + t.Name,
+		})
+	}
+
+	return steps
+}
+
+// diffTable returns the steps which change the columns and indexes of the
+// table `prev` into those of `next`, where indexes are dropped before the
+// columns are changed (as they may be on dropped columns) and created after
+func diffTable(
+	dialect sqlDialect,
+	prev sqlTable,
+	next sqlTable,
+) []migrationStep {
+
+	prevFields := make(map[string]sqlField, len(prev.Fields))
+	for _, f := range prev.Fields {
+		prevFields[f.Name] = f
+	}
+
+	nextFields := make(map[string]sqlField, len(next.Fields))
+	for _, f := range next.Fields {
+		nextFields[f.Name] = f
+	}
+
+	dropIndexes, createIndexes := diffIndexes(dialect, next.Name, prev.Indexes, next.Indexes)
+
+	steps := dropIndexes
+	for _, f := range next.Fields {
+		prevField, ok := prevFields[f.Name]
+		if !ok {
+			step := migrationStep{
+				Up: "alter table " + next.Name + " add column " + f.Name + " " + dialect.columnDefinition(f) + ";\n",
+				Down: "alter table " + next.Name + " drop column " + f.Name + ";\n",
+			}
+			if !f.Nullable && f.Default == "" {
+				step.Warning = "adds not null column " + next.Name + "." + f.Name + " without a default, which fails if the table has rows"
+			}
+
+			steps = append(steps, step)
+			continue
+		}
+
+		if prevField != f {
+			steps = append(steps, modifyColumnStep(dialect, next.Name, prevField, f))
+		}
+	}
+
+	for _, f := range prev.Fields {
+		if _, ok := nextFields[f.Name]; ok {
+			continue
+		}
+
+		steps = append(steps, migrationStep{
+			Up: "alter table " + next.Name + " drop column " + f.Name + ";\n",
+			Down: "alter table " + next.Name + " add column " + f.Name + " " + dialect.columnDefinition(f) + ";\n",
+			Warning: "drops column " + next.Name + "." + f.Name,
+		})
+	}
+
+	steps = append(steps, createIndexes...)
+
+	// Primary keys, unique keys and foreign keys are declared in `create
+	// table` without names, and so cannot be reliably dropped by a generated
+	// migration
+	if strings.Join(prev.PrimaryKey, ",") != strings.Join(next.PrimaryKey, ",") {
+		steps = append(steps, migrationStep{
+			ByHand: "primary key of table " + next.Name + " changed",
+		})
+	}
+
+	if keysString(prev.UniqueKeys) != keysString(next.UniqueKeys) {
+		steps = append(steps, migrationStep{
+			ByHand: "unique keys of table " + next.Name + " changed",
+		})
+	}
+
+	if foreignKeysString(prev.ForeignKeys) != foreignKeysString(next.ForeignKeys) {
+		steps = append(steps, migrationStep{
+			ByHand: "foreign keys of table " + next.Name + " changed",
+		})
+	}
+
+	return steps
+}
+
+// modifyColumnStep returns the step which changes the column `prev` of
+// `table` to `next`
+func modifyColumnStep(
+	dialect sqlDialect,
+	table string,
+	prev sqlField,
+	next sqlField,
+) migrationStep {
+
+	warning := "modifies column " + table + "." + next.Name + ", which may fail or truncate existing values"
+
+	if dialect == dialectMysql {
+		return migrationStep{
+			Up: "alter table " + table + " modify column " + next.Name + " " + dialect.columnDefinition(next) + ";\n",
+			Down: "alter table " + table + " modify column " + prev.Name + " " + dialect.columnDefinition(prev) + ";\n",
+			Warning: warning,
+		}
+	}
+
+	if dialect == dialectPostgres {
+		return migrationStep{
+			Up: postgresAlterColumn(table, prev, next),
+			Down: postgresAlterColumn(table, next, prev),
+			Warning: warning,
+		}
+	}
+
+	// sqlite can only change a column by recreating its table
+	return migrationStep{
+		ByHand: "column " + table + "." + next.Name + " changed from '" + dialect.columnDefinition(prev) +
+			"' to '" + dialect.columnDefinition(next) + "', which sqlite can only migrate by recreating the table",
+	}
+}
+
+// postgresAlterColumn returns the postgres statements which change the type,
+// nullability and default of the column `from` of `table` to those of `to`
+func postgresAlterColumn(
+	table string,
+	from sqlField,
+	to sqlField,
+) string {
+
+	alter := "alter table " + table + " alter column " + to.Name
+
+	var s string
+	if from.Type != to.Type {
+		s += alter + " type " + to.Type + ";\n"
+	}
+
+	if from.Nullable != to.Nullable {
+		if to.Nullable {
+			s += alter + " drop not null;\n"
+		} else {
+			s += alter + " set not null;\n"
+		}
+	}
+
+	if from.Default != to.Default {
+		if to.Default == "" {
+			s += alter + " drop default;\n"
+		} else {
+			s += alter + " set default " + to.Default + ";\n"
+		}
+	}
+
+	return s
+}
+
+// diffIndexes returns the steps which drop and the steps which create the
+// indexes to change the indexes `prev` of `table` into `next`, where indexes
+// with changed columns are dropped and recreated
+func diffIndexes(
+	dialect sqlDialect,
+	table string,
+	prev []tableKey,
+	next []tableKey,
+) ([]migrationStep, []migrationStep) {
+
+	prevByName := make(map[string]tableKey, len(prev))
+	for _, k := range prev {
+		prevByName[k.Name] = k
+	}
+
+	nextByName := make(map[string]tableKey, len(next))
+	for _, k := range next {
+		nextByName[k.Name] = k
+	}
+
+	var drops []migrationStep
+	for _, k := range prev {
+		nextKey, ok := nextByName[k.Name]
+		if ok && strings.Join(nextKey.Columns, ",") == strings.Join(k.Columns, ",") {
+			continue
+		}
+
+		drops = append(drops, migrationStep{
+			Up: dropIndexStatement(dialect, table, k),
+			Down: createIndexStatement(dialect, table, k, false),
+		})
+	}
+
+	var creates []migrationStep
+	for _, k := range next {
+		prevKey, ok := prevByName[k.Name]
+		if ok && strings.Join(prevKey.Columns, ",") == strings.Join(k.Columns, ",") {
+			continue
+		}
+
+		creates = append(creates, migrationStep{
+			Up: createIndexStatement(dialect, table, k, false),
+			Down: dropIndexStatement(dialect, table, k),
+		})
+	}
+
+	return drops, creates
+}
+
+// createIndexStatement returns the statement which creates the index `k` on
+// `table`, outside of the `create table` statement
+func createIndexStatement(
+	dialect sqlDialect,
+	table string,
+	k tableKey,
+	ifNotExists bool,
+) string {
+
+	create := "create index "
+	if ifNotExists {
+		create += "if not exists "
+	}
+
+	return create + indexName(dialect, table, k) + " on " + table +
+		" (" + strings.Join(k.Columns, ", ") + ");\n"
+}
+
+func dropIndexStatement(
+	dialect sqlDialect,
+	table string,
+	k tableKey,
+) string {
+
+	if dialect == dialectMysql {
+		return "drop index " + indexName(dialect, table, k) + " on " + table + ";\n"
+	}
+
+	return "drop index " + indexName(dialect, table, k) + ";\n"
+}
+
+// indexName returns the name of the index `k` on `table`, which is prefixed
+// with the table name in dialects where index names are not scoped to their
+// table
+func indexName(
+	dialect sqlDialect,
+	table string,
+	k tableKey,
+) string {
+
+	if dialect == dialectMysql {
+		return k.Name
+	}
+
+	return table + "_" + k.Name + "_idx"
+}
+
+func keysString(keys []tableKey) string {
+
+	s := make([]string, 0, len(keys))
+	for _, k := range keys {
+		s = append(s, "(" + strings.Join(k.Columns, ",") + ")")
+	}
+	sort.Strings(s)
+
+	return strings.Join(s, ",")
+}
+
+func foreignKeysString(keys []foreignKey) string {
+
+	s := make([]string, 0, len(keys))
+	for _, k := range keys {
+		s = append(s, k.Column + ">" + k.Table() + ":" + k.OnDelete)
+	}
+	sort.Strings(s)
+
+	return strings.Join(s, ",")
+}
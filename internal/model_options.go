@@ -0,0 +1,193 @@
+package internal
+
+import (
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// modelOptions are the options set for a data model in the `dbcrudgen` tag of
+// its embedded `dbcrudgen.DataModel` field, e.g.
+//
+//	type MyModel struct {
+//		dbcrudgen.DataModel `dbcrudgen:"max_rows=100"`
+//	}
+type modelOptions struct {
+	// MaxRows overrides the `--max_rows` flag for the model if non-zero
+	MaxRows int64
+}
+
+// unlimitedRows is the max rows value which allows a select to return any
+// number of rows (the same value as `lib.UnlimitedRows`)
+const unlimitedRows int64 = -1
+
+// parseMaxRows parses a max rows flag or tag value, which is either a positive
+// integer or `unlimited`
+func parseMaxRows(s string) (int64, error) {
+
+	if s == "unlimited" {
+		return unlimitedRows, nil
+	}
+
+	maxRows, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || maxRows <= 0 {
+		return 0, errors.New("max rows must be a positive integer or 'unlimited' - got '" + s + "'")
+	}
+
+	return maxRows, nil
+}
+
+// findModelOptions returns the options of each of the data models declared in
+// the package in `dir`, keyed by the name of the model
+func findModelOptions(dir string) (map[string]modelOptions, error) {
+
+	notTestFile := func(fi fs.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}
+
+	pkgs, err := parser.ParseDir(token.NewFileSet(), dir, notTestFile, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	options := make(map[string]modelOptions)
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				genDecl, ok := decl.(*ast.GenDecl)
+				if !ok || genDecl.Tok != token.TYPE {
+					continue
+				}
+
+				for _, spec := range genDecl.Specs {
+					typeSpec := spec.(*ast.TypeSpec)
+					structType, ok := typeSpec.Type.(*ast.StructType)
+					if !ok {
+						continue
+					}
+
+					tag, ok := dataModelTag(structType)
+					if !ok {
+						continue
+					}
+
+					opts, err := parseModelOptions(tag)
+					if err != nil {
+						return nil, errors.New(typeSpec.Name.Name + ": " + err.Error())
+					}
+
+					options[typeSpec.Name.Name] = opts
+				}
+			}
+		}
+	}
+
+	return options, nil
+}
+
+// dataModelTag returns the `dbcrudgen` tag of the embedded
+// `dbcrudgen.DataModel` field of `s`, if it has one
+func dataModelTag(s *ast.StructType) (string, bool) {
+
+	for _, field := range s.Fields.List {
+		if len(field.Names) != 0 || field.Tag == nil {
+			continue
+		}
+
+		sel, ok := field.Type.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != "DataModel" {
+			continue
+		}
+
+		tag, err := strconv.Unquote(field.Tag.Value)
+		if err != nil {
+			return "", false
+		}
+
+		return reflect.StructTag(tag).Lookup("dbcrudgen")
+	}
+
+	return "", false
+}
+
+func parseModelOptions(tag string) (modelOptions, error) {
+
+	var opts modelOptions
+	for _, opt := range splitTagOptions(tag) {
+		key, val, _ := strings.Cut(opt, "=")
+
+		switch key {
+		case "max_rows":
+			maxRows, err := parseMaxRows(val)
+			if err != nil {
+				return modelOptions{}, err
+			}
+			opts.MaxRows = maxRows
+		default:
+			return modelOptions{}, errors.New("unknown data model option '" + key + "'")
+		}
+	}
+
+	return opts, nil
+}
+
+// splitTagOptions splits a `dbcrudgen` tag into its comma separated options,
+// ignoring commas inside parentheses (e.g. in `decimal(10,2)`) and single
+// quoted strings (e.g. in `default='a,b'`)
+func splitTagOptions(tag string) []string {
+
+	var opts []string
+	depth := 0
+	quoted := false
+	start := 0
+	for i, c := range tag {
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',':
+			if depth == 0 {
+				opts = append(opts, strings.TrimSpace(tag[start:i]))
+				start = i+1
+			}
+		}
+	}
+
+	if last := strings.TrimSpace(tag[start:]); last != "" {
+		opts = append(opts, last)
+	}
+
+	return opts
+}
+
+// maxRows returns the max rows a select on `modelName` may return, or
+// `unlimitedRows` if there is no max
+func (d pkgDef) maxRows(modelName string) int64 {
+
+	if opts := d.ModelOptions[modelName]; opts.MaxRows != 0 {
+		return opts.MaxRows
+	}
+
+	return d.MaxRows
+}
+
+// maxRowsCode returns the go expression used in generated code for the max
+// rows a select on `modelName` may return
+func (d pkgDef) maxRowsCode(modelName string) string {
+
+	maxRows := d.maxRows(modelName)
+	if maxRows == unlimitedRows {
+		return "lib.UnlimitedRows"
+	}
+
+	return strconv.FormatInt(maxRows, 10)
+}
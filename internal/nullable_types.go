@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"github.com/thecodedproject/gopkg"
+)
+
+// sqlNullTypes maps the `database/sql` null types which can be used in data
+// models to the go type of their value and the name of the struct field which
+// holds it
+var sqlNullTypes = map[string]struct{
+	ValueType gopkg.Type
+	ValueField string
+}{
+	"NullBool": {
+		ValueType: gopkg.TypeBool{},
+		ValueField: "Bool",
+	},
+	"NullFloat64": {
+		ValueType: gopkg.TypeFloat64{},
+		ValueField: "Float64",
+	},
+	"NullInt32": {
+		ValueType: gopkg.TypeInt32{},
+		ValueField: "Int32",
+	},
+	"NullInt64": {
+		ValueType: gopkg.TypeInt64{},
+		ValueField: "Int64",
+	},
+	"NullString": {
+		ValueType: gopkg.TypeString{},
+		ValueField: "String",
+	},
+	"NullTime": {
+		ValueType: gopkg.TypeNamed{
+			Name: "Time",
+			Import: "time",
+		},
+		ValueField: "Time",
+	},
+}
+
+// nullableValueType returns the type of the value held by a nullable field
+// type (i.e. `T` for a `*T` or the value type of a `sql.Null*` type), and
+// false if `t` is not nullable
+func nullableValueType(t gopkg.Type) (gopkg.Type, bool) {
+
+	if ptr, ok := t.(gopkg.TypePointer); ok {
+		return ptr.ValueType, true
+	}
+
+	if nullType, ok := sqlNullType(t); ok {
+		return sqlNullTypes[nullType.Name].ValueType, true
+	}
+
+	return nil, false
+}
+
+// sqlNullType returns `t` as a named type if it is one of the supported
+// `database/sql` null types
+func sqlNullType(t gopkg.Type) (gopkg.TypeNamed, bool) {
+
+	named, ok := t.(gopkg.TypeNamed)
+	if !ok || named.Import != "database/sql" {
+		return gopkg.TypeNamed{}, false
+	}
+
+	if _, ok := sqlNullTypes[named.Name]; !ok {
+		return gopkg.TypeNamed{}, false
+	}
+
+	return named, true
+}
+
+// isBoolField returns true if values of `t` are stored in a bool column
+func isBoolField(t gopkg.Type) bool {
+
+	if valueType, ok := nullableValueType(t); ok {
+		t = valueType
+	}
+
+	_, ok := t.(gopkg.TypeBool)
+	return ok
+}
+
+// isStringField returns true if values of `t` are stored in a string column,
+// which are strings, string enums declared in `declTypes`, and nullable
+// versions of either
+func isStringField(t gopkg.Type, declTypes []gopkg.DeclType) bool {
+
+	if valueType, ok := nullableValueType(t); ok {
+		t = valueType
+	}
+
+	if named, ok := t.(gopkg.TypeNamed); ok {
+		declT, err := findDeclType(named, declTypes)
+		if err != nil {
+			return false
+		}
+
+		t = declT.Type
+	}
+
+	_, ok := t.(gopkg.TypeString)
+	return ok
+}
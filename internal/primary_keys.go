@@ -0,0 +1,343 @@
+package internal
+
+import (
+	"strings"
+
+	"github.com/thecodedproject/gopkg"
+)
+
+// primaryKey returns the primary key of a data model, which is made up of
+// the fields tagged `pk` (in the order of the fields), or is the auto
+// increment `ID` if no fields are tagged
+func primaryKey(
+	modelStruct gopkg.TypeStruct,
+) tableKey {
+
+	pk := tableKey{
+		Name: "pk",
+	}
+	for _, f := range modelStruct.Fields {
+		if isPKField(f) {
+			pk.Fields = append(pk.Fields, f.Name)
+			pk.Columns = append(pk.Columns, columnName(f))
+		}
+	}
+
+	if len(pk.Fields) == 0 {
+		pk.Fields = []string{"ID"}
+		pk.Columns = []string{"id"}
+	}
+
+	return pk
+}
+
+// hasCustomPrimaryKey returns true if the primary key of the model is set
+// with `pk` options, rather than being the auto increment `ID`
+func hasCustomPrimaryKey(modelStruct gopkg.TypeStruct) bool {
+
+	for _, f := range modelStruct.Fields {
+		if isPKField(f) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isPKField returns true if `f` is tagged as part of the primary key
+func isPKField(f gopkg.DeclVar) bool {
+
+	opts, err := parseFieldOptions(f)
+	if err != nil {
+		return false
+	}
+
+	return opts.PK
+}
+
+// isUUIDField returns true if `f` is a primary key field which is set to a
+// new UUID when inserted empty
+func isUUIDField(f gopkg.DeclVar) bool {
+
+	opts, err := parseFieldOptions(f)
+	if err != nil {
+		return false
+	}
+
+	return opts.PKUUID
+}
+
+// isAutoIDField returns true if `f` is the `ID` of a model which is assigned
+// by the DB on insert
+func isAutoIDField(f gopkg.DeclVar) bool {
+
+	return f.Name == "ID" && !isPKField(f)
+}
+
+// primaryKeyFields returns the fields of the primary key of the model
+func primaryKeyFields(
+	modelStruct gopkg.TypeStruct,
+) []gopkg.DeclVar {
+
+	pk := primaryKey(modelStruct)
+
+	fields := make([]gopkg.DeclVar, 0, len(pk.Fields))
+	for _, name := range pk.Fields {
+		for _, f := range modelStruct.Fields {
+			if f.Name == name {
+				fields = append(fields, f)
+			}
+		}
+	}
+
+	return fields
+}
+
+// primaryKeyArgs returns the args of the methods which take the primary key
+// of a row, one for each field of the key
+func primaryKeyArgs(
+	modelStruct gopkg.TypeStruct,
+) []gopkg.DeclVar {
+
+	fields := primaryKeyFields(modelStruct)
+
+	args := make([]gopkg.DeclVar, 0, len(fields))
+	for _, f := range fields {
+		args = append(args, gopkg.DeclVar{
+			Name: keyArgName(f.Name),
+			Type: f.Type,
+		})
+	}
+
+	return args
+}
+
+// pkQueryParam is a column of the primary key along with the name of the arg
+// for its value in the methods which take the primary key of a row
+type pkQueryParam struct {
+	Column string
+	Arg string
+}
+
+// pkQueryParams returns the columns of the primary key of the model along
+// with the names of their args (as returned by `primaryKeyArgs`)
+func pkQueryParams(
+	modelStruct gopkg.TypeStruct,
+) []pkQueryParam {
+
+	fields := primaryKeyFields(modelStruct)
+
+	params := make([]pkQueryParam, 0, len(fields))
+	for _, f := range fields {
+		params = append(params, pkQueryParam{
+			Column: columnName(f),
+			Arg: keyArgName(f.Name),
+		})
+	}
+
+	return params
+}
+
+// primaryKeyType returns the type of the primary key returned by the insert
+// methods of models with a custom primary key, which is the type of the key
+// field, or the generated `PK` struct for composite keys
+func primaryKeyType(
+	modelStruct gopkg.TypeStruct,
+) gopkg.Type {
+
+	fields := primaryKeyFields(modelStruct)
+	if len(fields) == 1 {
+		return fields[0].Type
+	}
+
+	return gopkg.TypeNamed{
+		Name: "PK",
+		ValueType: gopkg.TypeStruct{},
+	}
+}
+
+// primaryKeyTypes returns the `PK` struct type, with a field for each field
+// of the key, for models with a composite primary key
+func primaryKeyTypes(
+	modelStruct gopkg.TypeStruct,
+) []gopkg.DeclType {
+
+	fields := primaryKeyFields(modelStruct)
+	if !hasCustomPrimaryKey(modelStruct) || len(fields) == 1 {
+		return nil
+	}
+
+	pkFields := make([]gopkg.DeclVar, 0, len(fields))
+	for _, f := range fields {
+		pkFields = append(pkFields, gopkg.DeclVar{
+			Name: f.Name,
+			Type: f.Type,
+		})
+	}
+
+	return []gopkg.DeclType{
+		{
+			Name: "PK",
+			Type: gopkg.TypeStruct{
+				Fields: pkFields,
+			},
+		},
+	}
+}
+
+// primaryKeyValueCode returns the go expression for the primary key of the
+// model `varName`, as returned by the insert methods, where `pkgPrefix` is
+// prepended to the `PK` type of composite keys
+func primaryKeyValueCode(
+	modelStruct gopkg.TypeStruct,
+	varName string,
+	pkgPrefix string,
+) string {
+
+	fields := primaryKeyFields(modelStruct)
+	if len(fields) == 1 {
+		return varName + "." + fields[0].Name
+	}
+
+	values := make([]string, 0, len(fields))
+	for _, f := range fields {
+		values = append(values, f.Name + ": " + varName + "." + f.Name)
+	}
+
+	return pkgPrefix + "PK{" + strings.Join(values, ", ") + "}"
+}
+
+// primaryKeyZeroCode returns the go expression for the zero value of the
+// primary key of the model, as returned by the insert methods on error
+func primaryKeyZeroCode(
+	modelStruct gopkg.TypeStruct,
+) string {
+
+	return zeroValueCode(primaryKeyType(modelStruct))
+}
+
+// zeroValueCode returns the go expression for the zero value of the type `t`
+// of a primary key field (or of the generated `PK` struct)
+func zeroValueCode(t gopkg.Type) string {
+
+	switch t := t.(type) {
+	case gopkg.TypeString:
+		return `""`
+	case gopkg.TypeBool:
+		return "false"
+	case gopkg.TypeNamed:
+		if _, ok := t.ValueType.(gopkg.TypeStruct); t.ValueType != nil && !ok {
+			return zeroValueCode(t.ValueType)
+		}
+
+		if t.Import == "time" {
+			return "time." + t.Name + "{}"
+		}
+
+		return t.Name + "{}"
+	default:
+		return "0"
+	}
+}
+
+// primaryKeyOrderByCode returns the `[]lib.OrderBy` expression which orders
+// rows by their primary key, where each line after the first is indented by
+// `indent`
+func primaryKeyOrderByCode(
+	modelStruct gopkg.TypeStruct,
+	indent string,
+) string {
+
+	code := "[]lib.OrderBy{\n"
+	for _, c := range primaryKey(modelStruct).Columns {
+		code += indent + "\t{Column: \"" + c + "\"},\n"
+	}
+
+	return code + indent + "}"
+}
+
+// uuidDefaultsCode returns the code which sets each empty UUID primary key
+// field of the model `varName` to a new UUID, indented by `indent`
+func uuidDefaultsCode(
+	modelStruct gopkg.TypeStruct,
+	varName string,
+	indent string,
+) string {
+
+	var code string
+	for _, f := range modelStruct.Fields {
+		if !isUUIDField(f) {
+			continue
+		}
+
+		code += indent + "if " + varName + "." + f.Name + ` == "" {` + "\n" +
+			indent + "\t" + varName + "." + f.Name + " = lib.NewUUID()\n" +
+			indent + "}\n"
+	}
+
+	return code
+}
+
+// pageAfterCode returns the code which checks the keyset pagination options
+// of the `SelectPage` methods, which is `AfterID` for models with an auto
+// increment `id`, or `AfterPK` (of the type of the primary key) for models
+// with a custom primary key, which is added to `conds`
+func pageAfterCode(
+	d pkgDef,
+	modelStruct gopkg.TypeStruct,
+) (string, error) {
+
+	if !hasCustomPrimaryKey(modelStruct) {
+		return `
+	if opts.AfterPK != nil {
+		return nil, errors.New("Select: pagination after a primary key requires a custom primary key, use AfterID")
+	}
+`, nil
+	}
+
+	pkType, err := primaryKeyType(modelStruct).FullType(map[string]string{
+		d.Import.Import: d.Import.Alias,
+		"time": "time",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	fields := primaryKeyFields(modelStruct)
+	values := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if len(fields) == 1 {
+			values = append(values, "after")
+			continue
+		}
+
+		values = append(values, "after." + f.Name)
+	}
+
+	return `
+	if opts.AfterID != 0 {
+		return nil, errors.New("Select: pagination after ID requires an auto increment id, use AfterPK")
+	}
+
+	if opts.AfterPK != nil {
+		after, ok := opts.AfterPK.(` + pkType + `)
+		if !ok {
+			return nil, fmt.Errorf("Select: AfterPK must be a %T", after)
+		}
+
+		if len(opts.OrderBy) > 0 {
+			return nil, errors.New("Select: pagination after a primary key requires the default order")
+		}
+
+		conds = append(
+			[]lib.Cond{
+				lib.KeysetCond(
+					[]string{"` + strings.Join(primaryKey(modelStruct).Columns, `", "`) + `"},
+					` + strings.Join(values, ", ") + `,
+				),
+			},
+			conds...,
+		)
+	}
+`, nil
+}
@@ -0,0 +1,279 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/thecodedproject/gopkg"
+)
+
+// sqlDialect is the flavour of SQL which the generated schema and crud
+// methods are written for
+type sqlDialect string
+
+const (
+	dialectMysql sqlDialect = "mysql"
+	dialectPostgres sqlDialect = "postgres"
+	dialectSqlite sqlDialect = "sqlite"
+)
+
+// sqlTypes maps the go types which can be used in data models to the column
+// type used for them in each dialect
+var sqlTypes = map[sqlDialect]map[string]string{
+	dialectMysql: {
+		"[]byte": "varchar(255)",
+		"bool": "bit",
+		"float32": "float",
+		"float64": "double",
+		"int32": "int",
+		"int64": "bigint",
+		"string": "varchar(255)",
+		"time.Time": "datetime",
+	},
+	dialectPostgres: {
+		"[]byte": "bytea",
+		"bool": "boolean",
+		"float32": "real",
+		"float64": "double precision",
+		"int32": "integer",
+		"int64": "bigint",
+		"string": "varchar(255)",
+		// Postgres keeps microsecond precision by default; limit it to whole
+		// seconds to match mysql's `datetime`
+		"time.Time": "timestamptz(0)",
+	},
+	dialectSqlite: {
+		"[]byte": "blob",
+		"bool": "boolean",
+		"float32": "real",
+		"float64": "real",
+		"int32": "integer",
+		"int64": "integer",
+		"string": "text",
+		"time.Time": "datetime",
+	},
+}
+
+func parseSqlDialect(s string) (sqlDialect, error) {
+
+	d := sqlDialect(s)
+	if _, ok := sqlTypes[d]; !ok {
+		return "", errors.New("unknown sql dialect '" + s + "'")
+	}
+
+	return d, nil
+}
+
+// columnDefinition returns the type and constraints of a column as they
+// appear in a `create table` statement
+func (d sqlDialect) columnDefinition(f sqlField) string {
+
+	if d == dialectPostgres {
+		if f.AutoIncrement && f.Type == "bigint" {
+			return "bigserial primary key"
+		}
+	}
+
+	if d == dialectSqlite && f.AutoIncrement {
+		// sqlite only allows autoincrement on `integer primary key` columns
+		return "integer primary key autoincrement"
+	}
+
+	def := f.Type
+	if f.PrimaryKey {
+		def += " primary key"
+	}
+	if f.AutoIncrement {
+		def += " auto_increment"
+	}
+	if !f.PrimaryKey {
+		if f.Nullable {
+			def += " null"
+		} else {
+			def += " not null"
+		}
+	}
+	if f.Default != "" {
+		def += " default " + f.Default
+	}
+	return def
+}
+
+// selectColumn returns the expression used to select `column` from a table
+func (d sqlDialect) selectColumn(column string, isBool bool) string {
+
+	if d == dialectMysql && isBool {
+		// The golang sql driver doesn't convert bools nicely
+		// Running the select query as:
+		//  `select (my_bool = '1') from my_table`
+		// is the easiest way I've found to solve the issue
+		//
+		// See: https://github.com/go-sql-driver/mysql/issues/440
+		return "(" + column + " = '1')"
+	}
+
+	return column
+}
+
+// insertQuery returns the query used to insert a single row into `table`,
+// which returns the auto increment id of the row in postgres if `returningID`
+// is set
+func (d sqlDialect) insertQuery(table string, columns []string, returningID bool) string {
+
+	if d == dialectPostgres {
+		placeholders := make([]string, 0, len(columns))
+		for i := range columns {
+			placeholders = append(placeholders, "$" + fmt.Sprint(i+1))
+		}
+		query := "insert into " + table + " (" + strings.Join(columns, ", ") +
+			") values (" + strings.Join(placeholders, ", ") + ")"
+		if returningID {
+			query += " returning id"
+		}
+		return query
+	}
+
+	if d == dialectSqlite {
+		placeholders := make([]string, 0, len(columns))
+		for range columns {
+			placeholders = append(placeholders, "?")
+		}
+		return "insert into " + table + " (" + strings.Join(columns, ", ") +
+			") values (" + strings.Join(placeholders, ", ") + ")"
+	}
+
+	sets := make([]string, 0, len(columns))
+	for _, c := range columns {
+		sets = append(sets, c + "=?")
+	}
+	return "insert into " + table + " set " + strings.Join(sets, ", ")
+}
+
+// maxPlaceholders returns the max number of placeholders which can be used in
+// a single query
+func (d sqlDialect) maxPlaceholders() int {
+
+	if d == dialectSqlite {
+		// SQLITE_MAX_VARIABLE_NUMBER, which defaults to 32766 since sqlite 3.32
+		return 32766
+	}
+
+	return 65535
+}
+
+// timeNowCode returns the go expression used in generated code for the
+// current time when setting timestamp columns
+func (d sqlDialect) timeNowCode() string {
+
+	if d == dialectSqlite {
+		// sqlite stores times with their full precision so round them to
+		// the whole seconds kept by the `datetime` columns of other dialects
+		return "time.Now().Round(std_time.Second)"
+	}
+
+	return "time.Now()"
+}
+
+// timeNowImports returns the imports used by `timeNowCode`, which are the
+// `gotest/time` package (so that tests can set the current time), and the
+// standard `time` package (as `std_time`) for the durations it does not have
+func (d sqlDialect) timeNowImports() []gopkg.ImportAndAlias {
+
+	imports := []gopkg.ImportAndAlias{
+		{
+			Import: "github.com/thecodedproject/gotest/time",
+		},
+	}
+
+	if d == dialectSqlite {
+		imports = append(imports, gopkg.ImportAndAlias{
+			Import: "time",
+			Alias: "std_time",
+		})
+	}
+
+	return imports
+}
+
+// currentTimestampDefault returns the column default which sets a timestamp
+// of the kind `timestamp` (`created_at` or `updated_at`) in the DB
+func (d sqlDialect) currentTimestampDefault(timestamp string) (string, error) {
+
+	if timestamp == timestampCreatedAt {
+		return "current_timestamp", nil
+	}
+
+	if d != dialectMysql {
+		return "", errors.New("updated_at=db is only supported by mysql, as other dialects cannot set a column on update")
+	}
+
+	return "current_timestamp on update current_timestamp", nil
+}
+
+// placeholdersCode returns the `lib.Placeholders` value for the dialect, as
+// used in generated code
+func (d sqlDialect) placeholdersCode() string {
+
+	if d == dialectPostgres {
+		return "lib.DollarPlaceholders"
+	}
+
+	return "lib.QuestionPlaceholders"
+}
+
+// fakeDialectCode returns the go expression for the `lib.FakeDialect` which
+// the generated fakes follow
+func (d sqlDialect) fakeDialectCode() string {
+
+	switch d {
+	case dialectPostgres:
+		return "lib.FakePostgres"
+	case dialectSqlite:
+		return "lib.FakeSqlite"
+	default:
+		return "lib.FakeMysql"
+	}
+}
+
+// eqPlaceholderCode returns the go expression which compares the column
+// `column` (a go expression) to the next query arg to be appended to
+// `argsVar`, where a string literal column is joined with the comparison into
+// a single literal
+func (d sqlDialect) eqPlaceholderCode(column string, argsVar string) string {
+
+	eq := "=?"
+	argNum := ""
+	if d == dialectPostgres {
+		eq = "=$"
+		argNum = ` + fmt.Sprint(len(` + argsVar + `)+1)`
+	}
+
+	if strings.HasSuffix(column, `"`) {
+		return strings.TrimSuffix(column, `"`) + eq + `"` + argNum
+	}
+
+	return column + ` + "` + eq + `"` + argNum
+}
+
+// driverErrorsImport returns the import path of the `lib` package which
+// classifies the errors of the driver of the dialect
+func (d sqlDialect) driverErrorsImport() string {
+
+	switch d {
+	case dialectPostgres:
+		return "github.com/thecodedproject/dbcrudgen/lib/postgreserr"
+	case dialectSqlite:
+		return "github.com/thecodedproject/dbcrudgen/lib/sqliteerr"
+	default:
+		return "github.com/thecodedproject/dbcrudgen/lib/mysqlerr"
+	}
+}
+
+// mapDriverErrorCode returns the go expression which maps the driver error
+// `errVar` with `lib.MapDriverError`, as used in generated code
+func (d sqlDialect) mapDriverErrorCode(errVar string) string {
+
+	return "lib.MapDriverError(" + errVar + ", " + path.Base(d.driverErrorsImport()) + ".IsDuplicateKey)"
+}
@@ -0,0 +1,71 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound is returned (wrapped) by the generated methods which
+	// select, update or delete one row by its key when there is no such row
+	ErrNotFound = errors.New("no such row")
+
+	// ErrTooManyRows is returned (wrapped) by the generated select methods
+	// when a query matches more rows than the max rows of the select
+	ErrTooManyRows = errors.New("select query exceeded max rows")
+
+	// ErrUnknownField is matched by `errors.Is` for an `*UnknownFieldError`
+	ErrUnknownField = errors.New("unknown field")
+
+	// ErrDuplicateKey is returned (wrapped along with the driver error) by the
+	// generated methods which insert or update rows when a row would have the
+	// same value of a unique or primary key as another row; see
+	// `MapDriverError`
+	ErrDuplicateKey = errors.New("duplicate key")
+
+	// ErrConcurrentModification is returned by the generated `UpdateByID` (or
+	// `UpdateByPK`) methods of models with a `version` field when the row
+	// exists but its version is not the one given, as it has been updated
+	// since it was read
+	ErrConcurrentModification = errors.New("concurrent modification")
+
+	// ErrNoTx is returned by `InTx` for a `DBTX` which is neither a
+	// transaction nor a `TxBeginner`, and so cannot begin a transaction
+	ErrNoTx = errors.New("db can neither begin nor join a transaction")
+)
+
+// UnknownFieldError is returned (wrapped) when a query, update or order
+// refers to a field which is not a column of the table of the data model
+type UnknownFieldError struct {
+	Field string
+}
+
+func (e *UnknownFieldError) Error() string {
+	return "no such field - " + e.Field
+}
+
+// Is makes `errors.Is(err, ErrUnknownField)` true for any unknown field, so
+// that callers who do not need the field name can match the sentinel
+func (e *UnknownFieldError) Is(target error) bool {
+	return target == ErrUnknownField
+}
+
+// MapDriverError returns `err` wrapped along with `ErrDuplicateKey` if
+// `isDuplicateKey` reports it as a duplicate key error of the driver, so that
+// both `errors.Is(err, ErrDuplicateKey)` and matching the driver error work,
+// or returns `err` as it is otherwise.
+//
+// The generated methods pass the `IsDuplicateKey` of the `mysqlerr`,
+// `postgreserr` or `sqliteerr` package of their dialect, so that they only
+// depend on the driver of their own dialect.
+func MapDriverError(
+	err error,
+	isDuplicateKey func(error) bool,
+) error {
+
+	if err == nil || !isDuplicateKey(err) {
+		return err
+	}
+
+	return fmt.Errorf("%w: %w", ErrDuplicateKey, err)
+}
@@ -0,0 +1,616 @@
+package lib
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// FakeDialect is the SQL dialect which the generated fake repositories
+// follow where the results of a query differ between dialects, which is one
+// of `FakeMysql`, `FakePostgres` or `FakeSqlite`
+//
+// The fakes follow the dialect in:
+//   - `OpLike`, which ignores case in mysql (with its default collations)
+//     and sqlite (for ASCII letters only), but not in postgres
+//   - the order of nulls, which come before every other value in ascending
+//     order in mysql and sqlite, but after them in postgres
+//
+// Other comparisons of strings are of their bytes (as with a binary
+// collation), so the fakes do not follow a mysql column with a case
+// insensitive collation in matching (or treating as duplicate keys) strings
+// which differ only in case.
+type FakeDialect struct {
+	likeFold likeFold
+	nullsLast bool
+}
+
+type likeFold int
+
+const (
+	likeFoldNone likeFold = iota
+	likeFoldASCII
+	likeFoldUnicode
+)
+
+// The dialects followed by the fakes generated for each of the SQL dialects
+var (
+	FakeMysql = FakeDialect{likeFold: likeFoldUnicode}
+	FakePostgres = FakeDialect{nullsLast: true}
+	FakeSqlite = FakeDialect{likeFold: likeFoldASCII}
+)
+
+// FakeWhere returns the indices of the rows in `rows` which are equal to all
+// of `queryParams` and satisfy all of `conds`, matching the rows selected by
+// the where clause returned by `Where`, where `value` returns the value of a
+// column of a row
+//
+// It is used by the generated fake repositories in place of querying a
+// database, and returns the same errors as `Where` for invalid queries.
+func FakeWhere[T any](
+	dialect FakeDialect,
+	rows []T,
+	value func(row T, column string) any,
+	validColumn func(string) bool,
+	queryParams map[string]any,
+	conds ...Cond,
+) ([]int, error) {
+
+	_, _, err := Where(QuestionPlaceholders, validColumn, nil, queryParams, conds...)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]int, 0, len(rows))
+	for i, row := range rows {
+		rowValue := func(column string) any {
+			return value(row, column)
+		}
+
+		if dialect.matchesParams(rowValue, queryParams) && dialect.matchesConds(rowValue, conds) {
+			matched = append(matched, i)
+		}
+	}
+
+	return matched, nil
+}
+
+// FakeSelect returns the page of `rows` set in `opts` which are equal to all
+// of `queryParams` and satisfy all of `conds`, in the same order, and with
+// the same max rows (which is `defaultMaxRows` unless overridden in `opts`),
+// as the rows selected from a database by the generated `SelectPage` methods
+func FakeSelect[T any](
+	dialect FakeDialect,
+	rows []T,
+	value func(row T, column string) any,
+	validColumn func(string) bool,
+	opts SelectOptions,
+	defaultMaxRows int64,
+	queryParams map[string]any,
+	conds ...Cond,
+) ([]T, error) {
+
+	matched, err := FakeWhere(dialect, rows, value, validColumn, queryParams, opts.PageConds(conds)...)
+	if err != nil {
+		return nil, err
+	}
+
+	maxRows, err := opts.MaxRowsOr(defaultMaxRows)
+	if err != nil {
+		return nil, err
+	}
+
+	// The order and limit clause is not used, but is built so that the
+	// options are checked in the same way as for a database
+	_, err = opts.OrderAndLimit(validColumn, maxRows)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]T, 0, len(matched))
+	for _, i := range matched {
+		res = append(res, rows[i])
+	}
+
+	orderBy := []OrderBy{{Column: "id"}}
+	if len(opts.OrderBy) > 0 {
+		orderBy = opts.OrderBy
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		for _, ob := range orderBy {
+			c := dialect.compareForOrder(value(res[i], ob.Column), value(res[j], ob.Column))
+			if c == 0 {
+				continue
+			}
+
+			if ob.Direction == Desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+
+	if opts.Offset >= int64(len(res)) {
+		res = res[:0]
+	} else {
+		res = res[opts.Offset:]
+	}
+
+	if opts.Limit > 0 && opts.Limit < int64(len(res)) {
+		res = res[:opts.Limit]
+	}
+
+	if maxRows != UnlimitedRows && int64(len(res)) > maxRows {
+		return nil, ErrTooManyRows
+	}
+
+	return res, nil
+}
+
+// FakeUpdate returns a copy of `rows` with `update` applied to each row
+// matched by `queryParams` and `conds` (as in `FakeWhere`), along with the
+// number of rows updated
+func FakeUpdate[T any](
+	dialect FakeDialect,
+	rows []T,
+	value func(row T, column string) any,
+	validColumn func(string) bool,
+	update func(row *T) error,
+	queryParams map[string]any,
+	conds ...Cond,
+) ([]T, int64, error) {
+
+	matched, err := FakeWhere(dialect, rows, value, validColumn, queryParams, conds...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	res := append(make([]T, 0, len(rows)), rows...)
+	for _, i := range matched {
+		err := update(&res[i])
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return res, int64(len(matched)), nil
+}
+
+// FakeDelete returns a copy of `rows` without the rows matched by
+// `queryParams` and `conds` (as in `FakeWhere`), along with the number of
+// rows deleted
+func FakeDelete[T any](
+	dialect FakeDialect,
+	rows []T,
+	value func(row T, column string) any,
+	validColumn func(string) bool,
+	queryParams map[string]any,
+	conds ...Cond,
+) ([]T, int64, error) {
+
+	matched, err := FakeWhere(dialect, rows, value, validColumn, queryParams, conds...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	deleted := make(map[int]bool, len(matched))
+	for _, i := range matched {
+		deleted[i] = true
+	}
+
+	res := make([]T, 0, len(rows) - len(matched))
+	for i, row := range rows {
+		if !deleted[i] {
+			res = append(res, row)
+		}
+	}
+
+	return res, int64(len(matched)), nil
+}
+
+// FakeConflict returns the index of the first row in `rows` which has the
+// same values as `d` for all the columns of any one of `keys`, as the row
+// which an insert of `d` would conflict with
+//
+// As in a database, keys with a null value never conflict.
+func FakeConflict[T any](
+	rows []T,
+	value func(row T, column string) any,
+	d T,
+	keys [][]string,
+) (int, bool) {
+
+	for i, row := range rows {
+		for _, key := range keys {
+			dKey, ok := keyString(value, d, key)
+			if !ok {
+				continue
+			}
+
+			if rowKey, ok := keyString(value, row, key); ok && rowKey == dKey {
+				return i, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// FakeUnique checks that no two of `rows` have the same values for all the
+// columns of any one of `keys`, returning an error wrapping
+// `ErrDuplicateKey` if they do
+func FakeUnique[T any](
+	rows []T,
+	value func(row T, column string) any,
+	keys [][]string,
+) error {
+
+	for _, key := range keys {
+		seen := make(map[string]bool, len(rows))
+		for _, row := range rows {
+			k, ok := keyString(value, row, key)
+			if !ok {
+				continue
+			}
+
+			if seen[k] {
+				return fmt.Errorf("%w: %s", ErrDuplicateKey, strings.Join(key, ", "))
+			}
+			seen[k] = true
+		}
+	}
+
+	return nil
+}
+
+// FakeAssign sets the field pointed to by `dst` to `v`, converting `v` in
+// the same way as a value which is written to and then scanned from a
+// database column
+func FakeAssign(dst any, v any) error {
+
+	dv, err := driver.DefaultParameterConverter.ConvertValue(v)
+	if err != nil {
+		return err
+	}
+
+	if scanner, ok := dst.(sql.Scanner); ok {
+		return scanner.Scan(dv)
+	}
+
+	field := reflect.ValueOf(dst).Elem()
+	if dv == nil {
+		switch field.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+			field.Set(reflect.Zero(field.Type()))
+			return nil
+		}
+
+		return errors.New("cannot set non-null field of type " + field.Type().String() + " to null")
+	}
+
+	fieldType := field.Type()
+	if fieldType.Kind() == reflect.Pointer {
+		fieldType = fieldType.Elem()
+	}
+
+	val := reflect.ValueOf(dv)
+	if !val.Type().ConvertibleTo(fieldType) ||
+		// Go converts integers to strings as runes, which a database does not
+		(fieldType.Kind() == reflect.String && val.Kind() != reflect.String && val.Kind() != reflect.Slice) {
+		return fmt.Errorf("cannot set field of type %s to %T", field.Type(), v)
+	}
+	val = val.Convert(fieldType)
+
+	if field.Kind() == reflect.Pointer {
+		p := reflect.New(fieldType)
+		p.Elem().Set(val)
+		val = p
+	}
+
+	field.Set(val)
+	return nil
+}
+
+// keyString returns a string which is equal for two rows only if they have
+// the same values for all the columns of `key`, or false if any of the
+// values is null
+func keyString[T any](
+	value func(row T, column string) any,
+	row T,
+	key []string,
+) (string, bool) {
+
+	var b strings.Builder
+	for _, column := range key {
+		v, err := driver.DefaultParameterConverter.ConvertValue(value(row, column))
+		if err != nil || v == nil {
+			return "", false
+		}
+
+		switch tv := v.(type) {
+		case time.Time:
+			v = tv.UTC().Format(time.RFC3339Nano)
+		case []byte:
+			v = string(tv)
+		}
+
+		fmt.Fprintf(&b, "%q,", fmt.Sprint(v))
+	}
+
+	return b.String(), true
+}
+
+func (d FakeDialect) matchesParams(
+	value func(column string) any,
+	queryParams map[string]any,
+) bool {
+
+	for k, v := range queryParams {
+		if !d.matchesCond(value, Cond{Column: k, Op: OpEq, Value: v}) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (d FakeDialect) matchesConds(
+	value func(column string) any,
+	conds []Cond,
+) bool {
+
+	for _, c := range conds {
+		if !d.matchesCond(value, c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchesCond returns true if the row with column values `value` satisfies
+// `c`, which has already been checked to be valid by `Where`
+func (d FakeDialect) matchesCond(
+	value func(column string) any,
+	c Cond,
+) bool {
+
+	if c.Op == OpOr {
+		for _, alt := range c.Value.([][]Cond) {
+			if d.matchesConds(value, alt) {
+				return true
+			}
+		}
+		return false
+	}
+
+	v := value(c.Column)
+
+	switch c.Op {
+	case OpIsNull:
+		return isNull(v)
+	case OpIsNotNull:
+		return !isNull(v)
+	}
+
+	if isNull(c.Value) {
+		// As in `condTerm`, `OpEq` and `OpNe` check the column is or is not
+		// null, and nothing else matches a null value
+		switch c.Op {
+		case OpEq:
+			return isNull(v)
+		case OpNe:
+			return !isNull(v)
+		}
+		return false
+	}
+
+	// Comparing a null column to a value is never true
+	if isNull(v) {
+		return false
+	}
+
+	switch c.Op {
+	case OpIn:
+		vals := reflect.ValueOf(c.Value)
+		for i := 0; i < vals.Len(); i++ {
+			if cmp, ok := compareValues(v, vals.Index(i).Interface()); ok && cmp == 0 {
+				return true
+			}
+		}
+		return false
+
+	case OpLike:
+		pattern, ok := c.Value.(string)
+		if !ok {
+			return false
+		}
+		return d.likePattern(pattern).MatchString(valueString(v))
+	}
+
+	cmp, ok := compareValues(v, c.Value)
+	if !ok {
+		return false
+	}
+
+	switch c.Op {
+	case OpEq:
+		return cmp == 0
+	case OpNe:
+		return cmp != 0
+	case OpLt:
+		return cmp < 0
+	case OpLe:
+		return cmp <= 0
+	case OpGt:
+		return cmp > 0
+	case OpGe:
+		return cmp >= 0
+	}
+
+	return false
+}
+
+// compareValues compares `a` and `b` as the values they are stored as in a
+// database, returning false if they cannot be compared
+func compareValues(a any, b any) (int, bool) {
+
+	av, err := driver.DefaultParameterConverter.ConvertValue(a)
+	if err != nil {
+		return 0, false
+	}
+
+	bv, err := driver.DefaultParameterConverter.ConvertValue(b)
+	if err != nil {
+		return 0, false
+	}
+
+	if an, ok := numericValue(av); ok {
+		bn, ok := numericValue(bv)
+		if !ok {
+			return 0, false
+		}
+
+		return compareNumbers(an, bn), true
+	}
+
+	switch at := av.(type) {
+	case string, []byte:
+		switch bv.(type) {
+		case string, []byte:
+			return bytes.Compare([]byte(valueString(at)), []byte(valueString(bv))), true
+		}
+
+	case time.Time:
+		if bt, ok := bv.(time.Time); ok {
+			return at.Compare(bt), true
+		}
+	}
+
+	return 0, false
+}
+
+// compareForOrder compares `a` and `b` in the order of an `order by`
+// ascending, where nulls come before every other value, or after them in
+// dialects which order nulls last
+func (d FakeDialect) compareForOrder(a any, b any) int {
+
+	nullCmp := -1
+	if d.nullsLast {
+		nullCmp = 1
+	}
+
+	switch {
+	case isNull(a) && isNull(b):
+		return 0
+	case isNull(a):
+		return nullCmp
+	case isNull(b):
+		return -nullCmp
+	}
+
+	c, _ := compareValues(a, b)
+	return c
+}
+
+// numericValue returns `v` as an int64 (for integers and bools) or a float64
+// if it is a number
+func numericValue(v driver.Value) (any, bool) {
+
+	switch n := v.(type) {
+	case int64, float64:
+		return n, true
+	case bool:
+		if n {
+			return int64(1), true
+		}
+		return int64(0), true
+	}
+
+	return nil, false
+}
+
+// compareNumbers compares the numbers `a` and `b` (as returned by
+// `numericValue`), comparing two integers exactly rather than as floats, as
+// not every int64 is a float64
+func compareNumbers(a any, b any) int {
+
+	ai, aIsInt := a.(int64)
+	bi, bIsInt := b.(int64)
+	if aIsInt && bIsInt {
+		switch {
+		case ai < bi:
+			return -1
+		case ai > bi:
+			return 1
+		}
+		return 0
+	}
+
+	af, bf := toFloat(a), toFloat(b)
+	switch {
+	case af < bf:
+		return -1
+	case af > bf:
+		return 1
+	}
+	return 0
+}
+
+func toFloat(n any) float64 {
+
+	if i, ok := n.(int64); ok {
+		return float64(i)
+	}
+
+	return n.(float64)
+}
+
+func valueString(v any) string {
+
+	switch s := v.(type) {
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	}
+
+	return fmt.Sprint(v)
+}
+
+// likePattern returns the regexp matching the same strings as the SQL
+// `like` pattern `pattern` in the dialect
+func (d FakeDialect) likePattern(pattern string) *regexp.Regexp {
+
+	var expr strings.Builder
+	expr.WriteString("^(?s)")
+	if d.likeFold == likeFoldUnicode {
+		expr.WriteString("(?i)")
+	}
+
+	for _, r := range pattern {
+		switch {
+		case r == '%':
+			expr.WriteString(".*")
+		case r == '_':
+			expr.WriteString(".")
+		case d.likeFold == likeFoldASCII && unicode.IsLetter(r) && r < unicode.MaxASCII:
+			expr.WriteString("[" + string(unicode.ToLower(r)) + string(unicode.ToUpper(r)) + "]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+
+	return regexp.MustCompile(expr.String())
+}
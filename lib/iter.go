@@ -0,0 +1,10 @@
+package lib
+
+import (
+	"errors"
+)
+
+// ErrStopIteration can be returned from the func passed to the generated
+// `ForEach` methods to stop iterating over the rows without returning an
+// error from `ForEach`
+var ErrStopIteration = errors.New("stop iteration")
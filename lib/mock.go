@@ -0,0 +1,289 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ErrUnexpectedCall is returned by the methods of the generated mock
+// repositories when they are called with no matching expected call (which
+// also fails the test the mock was created in)
+var ErrUnexpectedCall = errors.New("unexpected call")
+
+// MockAny matches any value when passed as an arg of an expected call of a
+// `Mock`
+var MockAny = mockAny{}
+
+type mockAny struct{}
+
+// MockT is the part of `*testing.T` which `Mock` uses to fail the test it is
+// created in
+type MockT interface {
+	Helper()
+	Errorf(format string, args ...any)
+	Cleanup(func())
+}
+
+// Mock records the calls expected of the generated mock repositories, along
+// with the values they return, and the calls made to them.
+//
+// The args of calls are compared with `reflect.DeepEqual`, other than args
+// expected to be `MockAny`, so numbers must be expected with the same type
+// as the args of the method (e.g. `int64(1)` rather than `1`).
+type Mock struct {
+	t MockT
+	mu sync.Mutex
+	expected []*MockCall
+	calls []mockCallArgs
+}
+
+// MockCall is a call expected of a `Mock`, which is expected once unless set
+// otherwise with `Times` or `AnyTimes`
+type MockCall struct {
+	mock *Mock
+	method string
+	args []any
+	returns []any
+	minCalls int
+	maxCalls int
+	calls int
+}
+
+type mockCallArgs struct {
+	method string
+	args []any
+}
+
+// NewMock returns a `Mock` which fails `t` when it is called with no matching
+// expected call, or (when `t` finishes) if any expected call was not made
+func NewMock(t MockT) *Mock {
+
+	m := &Mock{
+		t: t,
+	}
+
+	t.Cleanup(func() {
+		m.AssertExpectations()
+	})
+
+	return m
+}
+
+// Expect records a call expected of `method` with `args`
+func (m *Mock) Expect(method string, args ...any) *MockCall {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c := &MockCall{
+		mock: m,
+		method: method,
+		args: args,
+		minCalls: 1,
+		maxCalls: 1,
+	}
+	m.expected = append(m.expected, c)
+
+	return c
+}
+
+// Returns sets the values returned by the call, which are returned by the
+// methods of the generated mocks in the same order
+func (c *MockCall) Returns(returns ...any) *MockCall {
+
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+
+	c.returns = returns
+	return c
+}
+
+// Times sets the number of times the call is expected
+func (c *MockCall) Times(n int) *MockCall {
+
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+
+	c.minCalls = n
+	c.maxCalls = n
+	return c
+}
+
+// AnyTimes sets the call to be expected any number of times (including none)
+func (c *MockCall) AnyTimes() *MockCall {
+
+	c.mock.mu.Lock()
+	defer c.mock.mu.Unlock()
+
+	c.minCalls = 0
+	c.maxCalls = -1
+	return c
+}
+
+// Called records a call of `method` with `args`, and returns the values set
+// to be returned by the first expected call which matches it and has not
+// been made as many times as expected.
+//
+// If there is no such call the test is failed, and `ErrUnexpectedCall` is
+// returned.
+func (m *Mock) Called(method string, args ...any) ([]any, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls = append(m.calls, mockCallArgs{
+		method: method,
+		args: args,
+	})
+
+	for _, c := range m.expected {
+		if c.method != method || !matchesMockArgs(c.args, args) {
+			continue
+		}
+
+		if c.maxCalls >= 0 && c.calls >= c.maxCalls {
+			continue
+		}
+
+		c.calls++
+		return c.returns, nil
+	}
+
+	m.t.Helper()
+	m.t.Errorf("%s(%s): %v", method, mockArgsString(args), ErrUnexpectedCall)
+
+	return nil, fmt.Errorf("%s: %w", method, ErrUnexpectedCall)
+}
+
+// Calls returns the args of each call made of `method`, in the order they
+// were made
+func (m *Mock) Calls(method string) [][]any {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	calls := make([][]any, 0, len(m.calls))
+	for _, c := range m.calls {
+		if c.method == method {
+			calls = append(calls, c.args)
+		}
+	}
+
+	return calls
+}
+
+// AssertCalled fails the test unless `method` has been called with `args`,
+// and returns whether it has
+func (m *Mock) AssertCalled(method string, args ...any) bool {
+
+	for _, callArgs := range m.Calls(method) {
+		if matchesMockArgs(args, callArgs) {
+			return true
+		}
+	}
+
+	m.t.Helper()
+	m.t.Errorf("expected call %s(%s) was not made", method, mockArgsString(args))
+	return false
+}
+
+// AssertNumberOfCalls fails the test unless `method` has been called `n`
+// times, and returns whether it has
+func (m *Mock) AssertNumberOfCalls(method string, n int) bool {
+
+	calls := len(m.Calls(method))
+	if calls == n {
+		return true
+	}
+
+	m.t.Helper()
+	m.t.Errorf("expected %d calls of %s but got %d", n, method, calls)
+	return false
+}
+
+// AssertExpectations fails the test for each expected call which has not
+// been made as many times as expected, and returns whether they all have
+func (m *Mock) AssertExpectations() bool {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.t.Helper()
+
+	ok := true
+	for _, c := range m.expected {
+		if c.calls < c.minCalls {
+			m.t.Errorf(
+				"expected call %s(%s) %d times but got %d",
+				c.method,
+				mockArgsString(c.args),
+				c.minCalls,
+				c.calls,
+			)
+			ok = false
+		}
+	}
+
+	return ok
+}
+
+// MockReturn returns the `i`th of `returns` (as returned by `Mock.Called`)
+// as a `T`, or the zero `T` if it is not set
+func MockReturn[T any](returns []any, i int) T {
+
+	var v T
+	if i < len(returns) && returns[i] != nil {
+		v = returns[i].(T)
+	}
+
+	return v
+}
+
+// MockArgs returns `args` followed by each of `variadic`, so that the
+// variadic args of a method are compared one by one with the args of an
+// expected call
+func MockArgs[T any](args []any, variadic []T) []any {
+
+	for _, v := range variadic {
+		args = append(args, v)
+	}
+
+	return args
+}
+
+func matchesMockArgs(expected []any, actual []any) bool {
+
+	if len(expected) != len(actual) {
+		return false
+	}
+
+	for i := range expected {
+		if expected[i] == MockAny {
+			continue
+		}
+
+		if !reflect.DeepEqual(expected[i], actual[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func mockArgsString(args []any) string {
+
+	s := make([]string, 0, len(args))
+	for _, a := range args {
+		if a == MockAny {
+			s = append(s, "lib.MockAny")
+			continue
+		}
+
+		s = append(s, fmt.Sprintf("%#v", a))
+	}
+
+	return strings.Join(s, ", ")
+}
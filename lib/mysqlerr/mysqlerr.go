@@ -0,0 +1,29 @@
+// Package mysqlerr classifies the errors of the mysql driver
+// (github.com/go-sql-driver/mysql) for the methods generated for mysql
+package mysqlerr
+
+import (
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// The mysql error numbers of duplicate key entries, where the second is
+// returned by some statements in place of the first
+const (
+	erDupEntry = 1062
+	erDupEntryWithKeyName = 1586
+)
+
+// IsDuplicateKey returns true if `err`, or any error it wraps, is a duplicate
+// key error from the mysql driver
+func IsDuplicateKey(err error) bool {
+
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+
+	return mysqlErr.Number == erDupEntry ||
+		mysqlErr.Number == erDupEntryWithKeyName
+}
@@ -0,0 +1,22 @@
+// Package postgreserr classifies the errors of the postgres drivers for the
+// methods generated for postgres
+package postgreserr
+
+import (
+	"errors"
+)
+
+// uniqueViolation is the SQLSTATE of unique key violations
+const uniqueViolation = "23505"
+
+// IsDuplicateKey returns true if `err`, or any error it wraps, is a duplicate
+// key error from the postgres driver.
+//
+// The SQLSTATE of the error is matched, which both lib/pq (`*pq.Error`) and
+// pgx (`*pgconn.PgError`) expose with a `SQLState` method, so that either
+// driver can be used.
+func IsDuplicateKey(err error) bool {
+
+	var stateErr interface{ SQLState() string }
+	return errors.As(err, &stateErr) && stateErr.SQLState() == uniqueViolation
+}
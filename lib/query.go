@@ -0,0 +1,257 @@
+package lib
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Op is the comparison made by a `Cond`
+type Op string
+
+const (
+	OpEq Op = "="
+	OpNe Op = "<>"
+	OpLt Op = "<"
+	OpLe Op = "<="
+	OpGt Op = ">"
+	OpGe Op = ">="
+	OpLike Op = "like"
+	OpIn Op = "in"
+	OpIsNull Op = "is null"
+	OpIsNotNull Op = "is not null"
+	// OpOr matches rows which satisfy any one of a list of condition groups;
+	// see `Or`
+	OpOr Op = "or"
+)
+
+// Cond is a condition on a single column, used to filter the rows matched by
+// the generated Select, Update and Delete methods
+//
+// An `OpEq` or `OpNe` cond with a null value (i.e. nil, a nil pointer or an
+// invalid `sql.Null*`) matches the rows where the column is or is not null.
+type Cond struct {
+	Column string
+	Op Op
+	Value any
+}
+
+// Or returns a condition matching the rows which satisfy all the conditions
+// in at least one of `alts`.
+//
+// An `Or` with no alternatives matches nothing.
+func Or(alts ...[]Cond) Cond {
+	return Cond{
+		Op: OpOr,
+		Value: alts,
+	}
+}
+
+// Placeholders is the style of query arg placeholder used by a SQL dialect
+type Placeholders int
+
+const (
+	// QuestionPlaceholders are the `?` placeholders used by mysql and sqlite
+	QuestionPlaceholders Placeholders = iota
+	// DollarPlaceholders are the numbered `$1` placeholders used by postgres
+	DollarPlaceholders
+)
+
+// next returns the placeholder for the next value to be appended to `args`
+func (p Placeholders) next(args []any) string {
+
+	if p == DollarPlaceholders {
+		return "$" + fmt.Sprint(len(args)+1)
+	}
+
+	return "?"
+}
+
+// Row returns the placeholders for a row of `numColumns` values to be
+// inserted, when `numArgs` values already precede the row in the query
+func (p Placeholders) Row(numArgs int, numColumns int) string {
+
+	placeholders := make([]string, 0, numColumns)
+	for i := 0; i < numColumns; i++ {
+		if p == DollarPlaceholders {
+			placeholders = append(placeholders, "$" + fmt.Sprint(numArgs+i+1))
+		} else {
+			placeholders = append(placeholders, "?")
+		}
+	}
+
+	return "(" + strings.Join(placeholders, ", ") + ")"
+}
+
+// Where returns the where clause matching the rows which are equal to all of
+// `queryParams` and satisfy all of `conds`, along with `args` extended by the
+// values to be passed with the query.
+//
+// The returned clause is empty when there are no params or conds, and
+// `validColumn` is used to check every column queried exists in the table. A
+// null value in `queryParams` matches the rows where the column is null.
+func Where(
+	p Placeholders,
+	validColumn func(string) bool,
+	args []any,
+	queryParams map[string]any,
+	conds ...Cond,
+) (string, []any, error) {
+
+	terms := make([]string, 0, len(queryParams) + len(conds))
+	for k, v := range queryParams {
+		if !validColumn(k) {
+			return "", nil, &UnknownFieldError{Field: k}
+		}
+
+		if isNull(v) {
+			terms = append(terms, k + " is null")
+			continue
+		}
+
+		terms = append(terms, k + "=" + p.next(args))
+		args = append(args, v)
+	}
+
+	for _, c := range conds {
+		var term string
+		var err error
+		term, args, err = condTerm(p, validColumn, c, args)
+		if err != nil {
+			return "", nil, err
+		}
+
+		terms = append(terms, term)
+	}
+
+	if len(terms) == 0 {
+		return "", args, nil
+	}
+
+	return " where " + strings.Join(terms, " and "), args, nil
+}
+
+func condTerm(
+	p Placeholders,
+	validColumn func(string) bool,
+	c Cond,
+	args []any,
+) (string, []any, error) {
+
+	if c.Op == OpOr {
+		return orTerm(p, validColumn, c, args)
+	}
+
+	if !validColumn(c.Column) {
+		return "", nil, &UnknownFieldError{Field: c.Column}
+	}
+
+	switch c.Op {
+	case OpEq, OpNe, OpLt, OpLe, OpGt, OpGe:
+		if isNull(c.Value) {
+			// Comparing to null with `=` or `<>` is never true, so the
+			// column is checked with `is [not] null` instead
+			switch c.Op {
+			case OpEq:
+				return c.Column + " is null", args, nil
+			case OpNe:
+				return c.Column + " is not null", args, nil
+			}
+			return "", nil, errors.New("cannot compare " + c.Column + " to null with " + string(c.Op))
+		}
+
+		term := c.Column + string(c.Op) + p.next(args)
+		return term, append(args, c.Value), nil
+
+	case OpIn:
+		vals := reflect.ValueOf(c.Value)
+		if vals.Kind() != reflect.Slice {
+			return "", nil, errors.New("in condition on " + c.Column + " requires a slice of values")
+		}
+
+		if vals.Len() == 0 {
+			// `in ()` is not valid SQL; an empty list matches nothing
+			return "1=0", args, nil
+		}
+
+		placeholders := make([]string, 0, vals.Len())
+		for i := 0; i < vals.Len(); i++ {
+			placeholders = append(placeholders, p.next(args))
+			args = append(args, vals.Index(i).Interface())
+		}
+		return c.Column + " in (" + strings.Join(placeholders, ", ") + ")", args, nil
+
+	case OpLike:
+		term := c.Column + " like " + p.next(args)
+		return term, append(args, c.Value), nil
+
+	case OpIsNull, OpIsNotNull:
+		return c.Column + " " + string(c.Op), args, nil
+	}
+
+	return "", nil, errors.New("unknown query operator '" + string(c.Op) + "'")
+}
+
+func orTerm(
+	p Placeholders,
+	validColumn func(string) bool,
+	c Cond,
+	args []any,
+) (string, []any, error) {
+
+	alts, ok := c.Value.([][]Cond)
+	if !ok {
+		return "", nil, errors.New("or condition requires a list of condition groups")
+	}
+
+	if len(alts) == 0 {
+		return "1=0", args, nil
+	}
+
+	altTerms := make([]string, 0, len(alts))
+	for _, alt := range alts {
+		if len(alt) == 0 {
+			// An empty group has no conditions to fail, so matches every row
+			altTerms = append(altTerms, "1=1")
+			continue
+		}
+
+		terms := make([]string, 0, len(alt))
+		for _, altCond := range alt {
+			var term string
+			var err error
+			term, args, err = condTerm(p, validColumn, altCond, args)
+			if err != nil {
+				return "", nil, err
+			}
+
+			terms = append(terms, term)
+		}
+
+		altTerms = append(altTerms, "(" + strings.Join(terms, " and ") + ")")
+	}
+
+	return "(" + strings.Join(altTerms, " or ") + ")", args, nil
+}
+
+// isNull returns true if `v` is stored as null in the database
+func isNull(v any) bool {
+
+	if v == nil {
+		return true
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return true
+	}
+
+	if valuer, ok := v.(driver.Valuer); ok {
+		dv, err := valuer.Value()
+		return err == nil && dv == nil
+	}
+
+	return false
+}
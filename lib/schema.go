@@ -0,0 +1,149 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// MigrationsTable is the table in which `ApplyMigration` records the
+// migrations which have been applied to a DB
+const MigrationsTable = "dbcrudgen_migrations"
+
+// ExecSchema runs each of the statements in `schema` (as generated in the
+// `schema.sql` files) on `db` in order.
+//
+// The statements are run one at a time, as not every driver supports running
+// many statements in one call.
+func ExecSchema(
+	ctx context.Context,
+	db DBTX,
+	schema string,
+) error {
+
+	for _, stmt := range schemaStatements(schema) {
+		_, err := db.ExecContext(ctx, stmt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ApplyMigration runs the statements in `schema` on `db` and records the
+// migration `name` as applied in the `MigrationsTable` (which is created if
+// it does not exist), unless it has already been applied, in which case
+// nothing is run.
+//
+// The migration is run and recorded in one transaction (see `InTx`), so that
+// it is not left applied but unrecorded in dialects which support
+// transactional schema changes.
+func ApplyMigration(
+	ctx context.Context,
+	db DBTX,
+	p Placeholders,
+	name string,
+	schema string,
+) error {
+
+	_, err := db.ExecContext(
+		ctx,
+		"create table if not exists " + MigrationsTable + " (" +
+			"name varchar(255) not null primary key, " +
+			"applied_at timestamp not null default current_timestamp" +
+			")",
+	)
+	if err != nil {
+		return err
+	}
+
+	return InTx(ctx, db, func(ctx context.Context, tx DBTX) error {
+
+		var count int64
+		err := tx.QueryRowContext(
+			ctx,
+			"select count(*) from " + MigrationsTable + " where name = " + p.next(nil),
+			name,
+		).Scan(&count)
+		if err != nil {
+			return err
+		}
+
+		if count > 0 {
+			return nil
+		}
+
+		err = ExecSchema(ctx, tx, schema)
+		if err != nil {
+			return fmt.Errorf("apply migration %s: %w", name, err)
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			"insert into " + MigrationsTable + " (name) values " + p.Row(0, 1),
+			name,
+		)
+		return err
+	})
+}
+
+// ApplyMigrations applies each of the `*.up.sql` migrations in `fsys` which
+// have not been applied yet, in order of their file names, where each
+// migration is named after its file name without the `.up.sql` suffix
+func ApplyMigrations(
+	ctx context.Context,
+	db DBTX,
+	p Placeholders,
+	fsys fs.FS,
+) error {
+
+	files, err := fs.Glob(fsys, "*.up.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, f := range files {
+		buf, err := fs.ReadFile(fsys, f)
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimSuffix(path.Base(f), ".up.sql")
+		err = ApplyMigration(ctx, db, p, name, string(buf))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// schemaStatements splits `schema` into its statements, leaving out comment
+// lines
+func schemaStatements(schema string) []string {
+
+	lines := strings.Split(schema, "\n")
+	code := make([]string, 0, len(lines))
+	for _, l := range lines {
+		if strings.HasPrefix(strings.TrimSpace(l), "--") {
+			continue
+		}
+		code = append(code, l)
+	}
+
+	var stmts []string
+	for _, stmt := range strings.Split(strings.Join(code, "\n"), ";\n") {
+		stmt = strings.TrimSuffix(strings.TrimSpace(stmt), ";")
+		if stmt == "" {
+			continue
+		}
+		stmts = append(stmts, stmt)
+	}
+
+	return stmts
+}
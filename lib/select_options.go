@@ -0,0 +1,210 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Direction is the direction in which the rows of a select are ordered
+type Direction string
+
+const (
+	Asc Direction = "asc"
+	Desc Direction = "desc"
+)
+
+// OrderBy orders the rows of a select by the values of `Column`
+//
+// An empty `Direction` orders the rows ascending.
+type OrderBy struct {
+	Column string
+	Direction Direction
+}
+
+// UnlimitedRows is the max rows value which allows a select to return any
+// number of rows
+const UnlimitedRows int64 = -1
+
+// SelectOptions sets the order and the page of the rows returned by the
+// generated `SelectPage` methods
+type SelectOptions struct {
+	// OrderBy lists the columns to order the rows by, the rows are ordered by
+	// `id` (or by the primary key of models with a custom primary key) if it
+	// is empty
+	OrderBy []OrderBy
+
+	// Limit is the max number of rows to select, zero selects all rows
+	Limit int64
+
+	// Offset is the number of rows to skip before selecting
+	Offset int64
+
+	// AfterID selects only the rows with an `id` greater than it, so that
+	// a table can be paged through by passing the ID of the last row of one
+	// page as the `AfterID` of the next (i.e. keyset pagination).
+	//
+	// Only the default order (by `id` ascending) can be used with `AfterID`,
+	// and only for models with an auto increment `id`.
+	AfterID int64
+
+	// AfterPK selects only the rows with a primary key greater than it, in
+	// the same way as `AfterID` but for models with a custom primary key. It
+	// must be of the type of the key returned by the generated insert methods
+	// (the type of the key field, or the generated `PK` struct of composite
+	// keys).
+	//
+	// Only the default order (by the primary key ascending) can be used with
+	// `AfterPK`.
+	AfterPK any
+
+	// MaxRows overrides the max number of rows the select may match before
+	// returning an error (set when generating the methods) if it is non-zero.
+	//
+	// Set to `UnlimitedRows` to allow any number of rows.
+	MaxRows int64
+}
+
+// MaxRowsOr returns the max number of rows the select may match, which is
+// `defaultMaxRows` unless overridden in `o`
+func (o SelectOptions) MaxRowsOr(defaultMaxRows int64) (int64, error) {
+
+	if o.MaxRows == 0 {
+		return defaultMaxRows, nil
+	}
+
+	if o.MaxRows < 0 && o.MaxRows != UnlimitedRows {
+		return 0, errors.New("max rows must be positive or UnlimitedRows")
+	}
+
+	return o.MaxRows, nil
+}
+
+// PageConds returns `conds` extended with the conditions needed to select
+// the page of rows set in `o`
+func (o SelectOptions) PageConds(conds []Cond) []Cond {
+
+	if o.AfterID == 0 {
+		return conds
+	}
+
+	pageConds := make([]Cond, 0, len(conds)+1)
+	pageConds = append(pageConds, conds...)
+
+	return append(pageConds, Cond{
+		Column: "id",
+		Op: OpGt,
+		Value: o.AfterID,
+	})
+}
+
+// KeysetCond returns the condition which matches the rows which come after
+// the row with `values` of `columns` when ordered by `columns` ascending, so
+// that the rows after the last row of one page can be selected with keyset
+// pagination on a key of many columns
+func KeysetCond(columns []string, values ...any) Cond {
+
+	alts := make([][]Cond, 0, len(columns))
+	for i := range columns {
+		alt := make([]Cond, 0, i+1)
+		for j := 0; j < i; j++ {
+			alt = append(alt, Cond{
+				Column: columns[j],
+				Op: OpEq,
+				Value: values[j],
+			})
+		}
+
+		alts = append(alts, append(alt, Cond{
+			Column: columns[i],
+			Op: OpGt,
+			Value: values[i],
+		}))
+	}
+
+	if len(alts) == 1 {
+		return alts[0][0]
+	}
+
+	return Or(alts...)
+}
+
+// OrderAndLimit returns the `order by`, `limit` and `offset` clauses to be
+// appended to a select query to return the rows set in `o`.
+//
+// Unless the limit in `o` is lower, the rows are limited to one more than
+// `maxRows` so that a select exceeding the max can be detected without the
+// database returning all the rows it matches.
+func (o SelectOptions) OrderAndLimit(
+	validColumn func(string) bool,
+	maxRows int64,
+) (string, error) {
+
+	if o.Limit < 0 {
+		return "", errors.New("limit must not be negative")
+	}
+
+	if o.Offset < 0 {
+		return "", errors.New("offset must not be negative")
+	}
+
+	if o.AfterID != 0 && !o.ordersByID() {
+		return "", errors.New("pagination after ID requires ordering by id ascending")
+	}
+
+	orderBy := []OrderBy{{Column: "id"}}
+	if len(o.OrderBy) > 0 {
+		orderBy = o.OrderBy
+	}
+
+	terms := make([]string, 0, len(orderBy))
+	for _, ob := range orderBy {
+		if !validColumn(ob.Column) {
+			return "", fmt.Errorf("order by: %w", &UnknownFieldError{Field: ob.Column})
+		}
+
+		switch ob.Direction {
+		case "", Asc:
+			terms = append(terms, ob.Column)
+		case Desc:
+			terms = append(terms, ob.Column + " desc")
+		default:
+			return "", errors.New("unknown order direction '" + string(ob.Direction) + "'")
+		}
+	}
+
+	clause := " order by " + strings.Join(terms, ", ")
+
+	limit := o.Limit
+	if maxRows != UnlimitedRows && (limit == 0 || limit > maxRows) {
+		limit = maxRows + 1
+	}
+
+	if limit > 0 || o.Offset > 0 {
+		// Not all dialects support an offset without a limit, so the largest
+		// limit is used to select all the rows after the offset
+		if limit == 0 {
+			limit = math.MaxInt64
+		}
+
+		clause += fmt.Sprintf(" limit %d", limit)
+	}
+
+	if o.Offset > 0 {
+		clause += fmt.Sprintf(" offset %d", o.Offset)
+	}
+
+	return clause, nil
+}
+
+func (o SelectOptions) ordersByID() bool {
+
+	if len(o.OrderBy) == 0 {
+		return true
+	}
+
+	return len(o.OrderBy) == 1 &&
+		o.OrderBy[0].Column == "id" &&
+		o.OrderBy[0].Direction != Desc
+}
@@ -0,0 +1,22 @@
+// Package sqliteerr classifies the errors of the sqlite driver
+// (github.com/mattn/go-sqlite3) for the methods generated for sqlite
+package sqliteerr
+
+import (
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// IsDuplicateKey returns true if `err`, or any error it wraps, is a unique or
+// primary key violation from the sqlite driver
+func IsDuplicateKey(err error) bool {
+
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+
+	return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+		sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+}
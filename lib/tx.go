@@ -0,0 +1,148 @@
+package lib
+
+import (
+	"context"
+	sql "database/sql"
+	"errors"
+	"fmt"
+)
+
+// DBTX is the set of `*sql.DB` (and `*sql.Tx`) methods used by the generated
+// methods, so that they can be run either inside or outside of a transaction
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type txContextKeyType struct{}
+
+var TxContextKey = txContextKeyType{}
+
+func ContextWithTx(
+	ctx context.Context,
+	tx *sql.Tx,
+) context.Context {
+	return context.WithValue(ctx, TxContextKey, tx)
+}
+
+// ContextWithDBTX returns `ctx` with `db` on it, as its transaction if `db` is
+// an `*sql.Tx`, unless `ctx` already has a transaction, which the methods
+// generated with `--db_context` then join instead
+func ContextWithDBTX(
+	ctx context.Context,
+	db DBTX,
+) context.Context {
+
+	if _, ok := ctx.Value(TxContextKey).(*sql.Tx); ok {
+		return ctx
+	}
+
+	if tx, ok := db.(*sql.Tx); ok {
+		return ContextWithTx(ctx, tx)
+	}
+
+	return context.WithValue(ctx, DbContextKey, db)
+}
+
+// DBTXFromContext returns the transaction on `ctx` if there is one, otherwise
+// the DB on `ctx`
+func DBTXFromContext(
+	ctx context.Context,
+) (DBTX, error) {
+
+	if tx, ok := ctx.Value(TxContextKey).(*sql.Tx); ok {
+		return tx, nil
+	}
+
+	if db, ok := ctx.Value(DbContextKey).(DBTX); ok {
+		return db, nil
+	}
+
+	return DBFromContext(ctx)
+}
+
+// WithTx runs `fn` in a transaction on `db`, committing the transaction if
+// `fn` returns nil and rolling it back otherwise (including when `fn`
+// panics, in which case the panic is continued after the rollback).
+//
+// The transaction is stored on the context passed to `fn`, so any methods
+// generated with `--db_context` which are called with that context join the
+// transaction. If `ctx` already has a transaction then `fn` joins it instead
+// of starting a new one.
+func WithTx(
+	ctx context.Context,
+	db *sql.DB,
+	fn func(ctx context.Context) error,
+) error {
+
+	if _, ok := ctx.Value(TxContextKey).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	return runTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		return fn(ContextWithTx(ctx, tx))
+	})
+}
+
+// TxBeginner is implemented by a `DBTX` which can begin a transaction, as
+// `*sql.DB` does
+type TxBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// InTx runs `fn` in a transaction on `db`, as `WithTx` does, passing it the
+// transaction (which is also stored on the context passed to `fn`).
+//
+// If `db` is already a `*sql.Tx` then `fn` joins it, otherwise `db` must be a
+// `TxBeginner` (such as a `*sql.DB`) or `ErrNoTx` is returned without
+// running `fn`.
+func InTx(
+	ctx context.Context,
+	db DBTX,
+	fn func(ctx context.Context, tx DBTX) error,
+) error {
+
+	switch db := db.(type) {
+	case *sql.Tx:
+		return fn(ContextWithTx(ctx, db), db)
+	case TxBeginner:
+		return runTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+			return fn(ContextWithTx(ctx, tx), tx)
+		})
+	default:
+		return fmt.Errorf("InTx: %w", ErrNoTx)
+	}
+}
+
+// runTx runs `fn` in a new transaction on `db`, committing the transaction if
+// `fn` returns nil and rolling it back otherwise (including when `fn` panics)
+func runTx(
+	ctx context.Context,
+	db TxBeginner,
+	fn func(ctx context.Context, tx *sql.Tx) error,
+) error {
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	err = fn(ctx, tx)
+	if err != nil {
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			return errors.Join(err, rollbackErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
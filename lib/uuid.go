@@ -0,0 +1,23 @@
+package lib
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// NewUUID returns a new random (version 4) UUID in its canonical string form,
+// as set by the generated `Insert` methods on empty `pk=uuid` fields
+func NewUUID() string {
+
+	var b [16]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		// crypto/rand only fails if the OS has no source of randomness
+		panic("read random bytes for uuid: " + err.Error())
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}